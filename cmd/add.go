@@ -10,6 +10,7 @@ import (
 	"github.com/spf13/cobra"
 	"sm/internal/config"
 	"sm/internal/models"
+	"sm/internal/ssh"
 	"sm/internal/utils"
 )
 
@@ -36,6 +37,30 @@ var addCmd = &cobra.Command{
 		port, _ := cmd.Flags().GetInt("port")
 		key, _ := cmd.Flags().GetString("key")
 		password, _ := cmd.Flags().GetString("pass")
+		keyPassphrase, _ := cmd.Flags().GetString("key-passphrase")
+		strictHostKeyChecking, _ := cmd.Flags().GetString("strict-host-key-checking")
+		forwardAgent, _ := cmd.Flags().GetBool("forward-agent")
+		jumpHosts, _ := cmd.Flags().GetStringSlice("jump")
+		tags, _ := cmd.Flags().GetStringSlice("tag")
+		group, _ := cmd.Flags().GetString("group")
+
+		if !models.ValidHostKeyChecking(strictHostKeyChecking) {
+			return fmt.Errorf("invalid strict host key checking mode: %s. Valid modes are 'yes', 'ask', 'accept-new' and 'no'", strictHostKeyChecking)
+		}
+		if err := validateKeyPassphrase(keyPassphrase); err != nil {
+			return err
+		}
+		tags, err = models.CleanTags(tags)
+		if err != nil {
+			return err
+		}
+		if err := validateGroup(group); err != nil {
+			return err
+		}
+
+		// Only ask for what the group or the top-level defaults do not provide;
+		// inherited values are left empty so that later changes to them apply
+		inherited := cfg.Resolve(models.Connection{Name: name, Group: group})
 
 		// Interactive prompts for missing required fields
 		if host == "" {
@@ -54,7 +79,7 @@ var addCmd = &cobra.Command{
 			}
 		}
 
-		if user == "" {
+		if user == "" && inherited.User == "" {
 			prompt := promptui.Prompt{
 				Label: "User",
 				Validate: func(input string) error {
@@ -70,7 +95,7 @@ var addCmd = &cobra.Command{
 			}
 		}
 
-		if port == 0 {
+		if port == 0 && inherited.Sources["port"] == models.SourceBuiltIn {
 			prompt := promptui.Prompt{
 				Label:   "Port (default: 22)",
 				Default: "22",
@@ -88,31 +113,47 @@ var addCmd = &cobra.Command{
 			port, _ = strconv.Atoi(portStr)
 		}
 
-		// Encrypt password if provided
-		if password != "" {
-			encryptedPass, err := utils.Encrypt(password)
-			if err != nil {
-				return fmt.Errorf("failed to encrypt password: %w", err)
-			}
-			password = encryptedPass
+		// Encrypt password if provided, unless settings.encrypt_passwords is off
+		password, err = utils.SealPassword(password, cfg.Settings.EncryptPasswords)
+		if err != nil {
+			return fmt.Errorf("failed to save password: %w", err)
 		}
 
 		newConn := models.Connection{
-			ID:        cfg.NextID, // Assign the current NextID
 			Name:      name,
 			Host:      host,
 			User:      user,
 			Port:      port,
 			KeyPath:   key,
 			Password:  password,
-			CreatedAt: time.Now().Unix(),
+			Group:     group,
+			Tags:      tags,
+			CreatedAt: time.Now(),
+
+			KeyPassphrase:         keyPassphrase,
+			StrictHostKeyChecking: strictHostKeyChecking,
+			ForwardAgent:          forwardAgent,
+			JumpHosts:             jumpHosts,
 		}
 
-		cfg.Connections[name] = newConn
-		cfg.NextID++ // Increment NextID for the next connection
+		// The config may have changed while prompting, so check again under the lock
+		err = config.Update(func(cfg *models.AppConfig) error {
+			if _, exists := cfg.Connections[name]; exists {
+				return errors.New("connection with this name already exists")
+			}
+
+			// Make sure the jump hosts exist and do not loop back on themselves
+			if _, err := ssh.JumpChain(cfg, &newConn); err != nil {
+				return err
+			}
 
-		if err := config.SaveConfig(cfg); err != nil {
-			return fmt.Errorf("failed to save config: %w", err)
+			newConn.ID = cfg.NextID // Assign the current NextID
+			cfg.Connections[name] = newConn
+			cfg.NextID++ // Increment NextID for the next connection
+			return nil
+		})
+		if err != nil {
+			return err
 		}
 
 		fmt.Printf("Successfully added connection '%s'\n", name)
@@ -127,7 +168,13 @@ func init() {
 	addCmd.Flags().String("user", "", "Username for the connection")
 	addCmd.Flags().IntP("port", "p", 0, "Port number for the connection (default: 22)")
 	addCmd.Flags().String("key", "", "Path to the private SSH key")
-	addCmd.Flags().String("pass", "", "Password for the connection (not recommended, will be stored in plaintext for now)")
+	addCmd.Flags().String("pass", "", "Password for the connection, or a secret reference such as ref:env:NAME (passwords are encrypted unless settings.encrypt_passwords is false)")
+	addCmd.Flags().String("key-passphrase", "", "Secret reference to the passphrase of the private key, such as ref:keyring:NAME")
+	addCmd.Flags().String("strict-host-key-checking", "", "Host key checking mode (yes, ask, accept-new, no). Default: ask")
+	addCmd.Flags().BoolP("forward-agent", "A", false, "Forward the local ssh-agent to the remote host")
+	addCmd.Flags().StringSliceP("jump", "J", nil, "Saved connection(s) to use as jump hosts, in order (repeatable or comma-separated)")
+	addCmd.Flags().String("group", "", "Group to inherit the user, port, key, jump hosts and tags from, such as prod/eu")
+	addCmd.Flags().StringSlice("tag", nil, "Tags for the connection, such as prod or web (repeatable or comma-separated)")
 
 	// Removed MarkFlagRequired for interactive prompts
 }
@@ -0,0 +1,16 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage the configuration file",
+	Long:  `Commands for maintaining the ssh-manager configuration file and its backups.`,
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+}
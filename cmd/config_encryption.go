@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"sm/internal/config"
+	"sm/internal/models"
+	"sm/internal/utils"
+)
+
+// configEncryptionCmd represents the config encryption command
+var configEncryptionCmd = &cobra.Command{
+	Use:   "encryption [keyring|master-password]",
+	Short: "Choose where the key that encrypts saved passwords comes from",
+	Long: `Shows or changes the source of the key that encrypts saved passwords.
+
+  keyring          A random key stored in the OS keyring (the default).
+  master-password  A key derived from a master password with Argon2id. Use this where no
+                   OS keyring is available, such as headless servers and containers.
+                   Run 'sm unlock' to avoid typing the master password for every command.
+
+Saved passwords are re-encrypted with the new key. Running 'sm config encryption
+master-password' again changes the master password.`,
+	Example: `  sm config encryption
+  sm config encryption master-password
+  sm config encryption keyring`,
+	Args:         cobra.MaximumNArgs(1),
+	ValidArgs:    []string{models.KeySourceKeyring, models.KeySourceMasterPassword},
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.GetConfig()
+		if err != nil {
+			return fmt.Errorf("failed to get config: %w", err)
+		}
+		current := cfg.Settings.Encryption
+
+		if len(args) == 0 {
+			return printEncryptionStatus(current)
+		}
+
+		force, _ := cmd.Flags().GetBool("force")
+
+		var settings models.EncryptionSettings
+		var newKey []byte
+		switch args[0] {
+		case models.KeySourceKeyring:
+			if current.KeySource != models.KeySourceMasterPassword {
+				fmt.Println("Passwords are already encrypted with the OS keyring.")
+				return nil
+			}
+			newKey, err = utils.KeyringKey()
+		case models.KeySourceMasterPassword:
+			settings, newKey, err = readNewMasterPassword()
+		default:
+			return fmt.Errorf("invalid key source: %s. Valid sources are '%s' and '%s'", args[0], models.KeySourceKeyring, models.KeySourceMasterPassword)
+		}
+		if err != nil {
+			return err
+		}
+
+		result, err := reencryptPasswords(settings, newKey, force)
+		if err != nil {
+			return err
+		}
+
+		if settings.KeySource == models.KeySourceMasterPassword {
+			fmt.Println("Passwords are now encrypted with the master password. Run 'sm unlock' to cache it for a while.")
+		} else {
+			fmt.Println("Passwords are now encrypted with the OS keyring.")
+		}
+		printReencryptResult(result)
+		return nil
+	},
+}
+
+// printEncryptionStatus describes the current key source.
+func printEncryptionStatus(settings models.EncryptionSettings) error {
+	if settings.KeySource != models.KeySourceMasterPassword {
+		fmt.Println("Passwords are encrypted with a key stored in the OS keyring.")
+		return nil
+	}
+
+	fmt.Println("Passwords are encrypted with a key derived from the master password.")
+	expires, err := utils.AgentExpiry(settings.Salt)
+	if err != nil {
+		return err
+	}
+	if expires.IsZero() {
+		fmt.Println("Locked. Run 'sm unlock' to unlock for a while.")
+	} else {
+		fmt.Printf("Unlocked until %s.\n", expires.Local().Format("15:04:05"))
+	}
+	return nil
+}
+
+func init() {
+	configCmd.AddCommand(configEncryptionCmd)
+
+	configEncryptionCmd.Flags().Bool("force", false, "Remove passwords that cannot be decrypted instead of stopping")
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"sm/internal/config"
+)
+
+// configMigrateCmd represents the config migrate command
+var configMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Upgrade the configuration file to the current schema version",
+	Long: `Upgrades a configuration file written by an older version of sm to the current
+schema, one version at a time. A copy of the original is kept in the backups directory.
+
+sm also does this automatically the first time it loads an older file; use --dry-run
+to see what would change beforehand.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		var result config.MigrationResult
+		var err error
+		if dryRun {
+			result, err = config.PlanMigration()
+		} else {
+			result, err = config.MigrateConfig()
+		}
+		if err != nil {
+			return err
+		}
+
+		if !result.Needed() {
+			fmt.Printf("Config is already at version %d. Nothing to migrate.\n", result.To)
+			return nil
+		}
+
+		if dryRun {
+			fmt.Printf("Config would be migrated from version %d to %d:\n", result.From, result.To)
+		} else {
+			fmt.Printf("Migrated config from version %d to %d:\n", result.From, result.To)
+		}
+		for _, step := range result.Steps {
+			fmt.Println("  " + step)
+		}
+		if len(result.Changes) > 0 {
+			fmt.Println("\nChanges:")
+			for _, change := range result.Changes {
+				fmt.Println("  " + change)
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configMigrateCmd)
+
+	configMigrateCmd.Flags().Bool("dry-run", false, "Show what would change without modifying the file")
+}
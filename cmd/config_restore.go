@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/manifoldco/promptui"
+	"github.com/spf13/cobra"
+	"sm/internal/config"
+)
+
+// configRestoreCmd represents the config restore command
+var configRestoreCmd = &cobra.Command{
+	Use:   "restore [backup]",
+	Short: "Roll the configuration back to an automatic backup",
+	Long: `sm keeps a backup of the configuration file every time it is changed (10 by default;
+set settings.backups to change the count, or to a negative number to disable backups).
+
+Without arguments, restore lets you pick a backup interactively. A backup can also be
+given by its file name or its number in 'sm config restore --list' (1 is the newest).
+The current configuration is backed up before it is replaced, so a restore can be undone.
+Backups written by an older version of sm are upgraded to the current schema.`,
+	Example: `  sm config restore --list
+  sm config restore 2
+  sm config restore config-20240102-150405.000.yaml --yes`,
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		backups, err := config.ListBackups()
+		if err != nil {
+			return err
+		}
+		if len(backups) == 0 {
+			dir, _ := config.BackupDir()
+			fmt.Printf("No backups found in %s\n", dir)
+			return nil
+		}
+
+		if list, _ := cmd.Flags().GetBool("list"); list {
+			printBackups(backups)
+			return nil
+		}
+
+		var backup config.Backup
+		if len(args) == 1 {
+			backup, err = findBackup(backups, args[0])
+			if err != nil {
+				return err
+			}
+		} else {
+			backup, err = selectBackup(backups)
+			if err != nil {
+				return err
+			}
+		}
+
+		if yes, _ := cmd.Flags().GetBool("yes"); !yes {
+			prompt := promptui.Prompt{
+				Label:     fmt.Sprintf("Restore the configuration from %s", backup.Time.Format("2006-01-02 15:04:05")),
+				IsConfirm: true,
+			}
+			if _, err := prompt.Run(); err != nil {
+				if errors.Is(err, promptui.ErrAbort) {
+					fmt.Println("Restore cancelled.")
+					return nil
+				}
+				return fmt.Errorf("prompt failed: %w", err)
+			}
+		}
+
+		restored, err := config.RestoreBackup(backup)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Restored %d connection(s) from %s\n", len(restored.Connections), backup.Name)
+		return nil
+	},
+}
+
+// findBackup returns the backup with the given file name or list number.
+func findBackup(backups []config.Backup, identifier string) (config.Backup, error) {
+	if n, err := strconv.Atoi(identifier); err == nil {
+		if n < 1 || n > len(backups) {
+			return config.Backup{}, fmt.Errorf("backup number must be between 1 and %d", len(backups))
+		}
+		return backups[n-1], nil
+	}
+	for _, b := range backups {
+		if b.Name == identifier {
+			return b, nil
+		}
+	}
+	return config.Backup{}, fmt.Errorf("backup '%s' does not exist. Use --list to see the available backups", identifier)
+}
+
+// selectBackup lets the user pick a backup interactively.
+func selectBackup(backups []config.Backup) (config.Backup, error) {
+	items := make([]string, len(backups))
+	for i, b := range backups {
+		items[i] = fmt.Sprintf("%s  (%s)", b.Time.Format("2006-01-02 15:04:05"), describeBackup(b))
+	}
+
+	prompt := promptui.Select{
+		Label: "Backup to restore",
+		Items: items,
+	}
+	i, _, err := prompt.Run()
+	if err != nil {
+		return config.Backup{}, fmt.Errorf("prompt failed: %w", err)
+	}
+	return backups[i], nil
+}
+
+// printBackups prints the backups as a numbered table, newest first.
+func printBackups(backups []config.Backup) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "#\tTAKEN\tCONTENTS\tFILE")
+	for i, b := range backups {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", i+1, b.Time.Format("2006-01-02 15:04:05"), describeBackup(b), b.Name)
+	}
+	w.Flush()
+}
+
+// describeBackup summarises the contents of a backup.
+func describeBackup(b config.Backup) string {
+	cfg, err := config.LoadBackup(b)
+	if err != nil {
+		return "invalid"
+	}
+	return fmt.Sprintf("%d connections, %d keys", len(cfg.Connections), len(cfg.SSHKeys))
+}
+
+func init() {
+	configCmd.AddCommand(configRestoreCmd)
+
+	configRestoreCmd.Flags().Bool("list", false, "List the available backups")
+	configRestoreCmd.Flags().BoolP("yes", "y", false, "Restore without asking for confirmation")
+}
@@ -4,7 +4,6 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
-	"time"
 
 	"github.com/spf13/cobra"
 	"sm/internal/config"
@@ -24,48 +23,50 @@ var connectCmd = &cobra.Command{
 			return fmt.Errorf("failed to get config: %w", err)
 		}
 
-		identifier := args[0]
-		var conn models.Connection
-		var found bool
-		var connName string // To store the actual name of the found connection
-
-		// Try to parse identifier as an ID
-		id, err := strconv.Atoi(identifier)
-		if err == nil { // Successfully parsed as an integer
-			for name, c := range cfg.Connections {
-				if c.ID == id {
-					conn = c
-					connName = name
-					found = true
-					break
-				}
-			}
+		conn, connName, err := findConnection(cfg, args[0])
+		if err != nil {
+			return err
 		}
 
-		if !found { // If not found by ID, or if identifier was not an integer, try by name
-			conn, found = cfg.Connections[identifier]
-			connName = identifier // If found by name, the identifier is the name
+		recordUse(connName)
+
+		fmt.Println(fmt.Sprintf("Connecting to %s (%s@%s)...", conn.Name, conn.User, conn.Host))
+
+		withTunnels, _ := cmd.Flags().GetBool("tunnels")
+		noShell, _ := cmd.Flags().GetBool("no-shell")
+
+		if !withTunnels && !noShell {
+			// The actual connection logic is in the ssh package
+			if err := ssh.Connect(cfg, &conn); err != nil {
+				// The error from the ssh package is often not very user-friendly
+				// on its own (e.g., "EOF"). We add context here.
+				return fmt.Errorf("ssh connection failed: %w", err)
+			}
+			fmt.Println("Connection closed.")
+			return nil
 		}
 
-		if !found {
-			return errors.New("connection with this name or ID does not exist")
+		if len(conn.Forwards) == 0 {
+			return fmt.Errorf("connection '%s' has no saved tunnels. Use 'sm forward %s --save <name>' to add one", connName, connName)
 		}
 
-		// Update LastUsed time
-		conn.LastUsed = time.Now()
-		cfg.Connections[connName] = conn // Use connName to update the map
-		if err := config.SaveConfig(cfg); err != nil {
-			// Log this error but don't block the connection for it
-			fmt.Println("Warning: could not update last used time:", err)
+		client, err := ssh.Dial(cfg, &conn)
+		if err != nil {
+			return fmt.Errorf("ssh connection failed: %w", err)
 		}
+		defer client.Close()
 
-		fmt.Println(fmt.Sprintf("Connecting to %s (%s@%s)...", conn.Name, conn.User, conn.Host))
+		tunnels, err := ssh.StartTunnels(client, conn.Forwards)
+		if err != nil {
+			return err
+		}
+		defer ssh.CloseAll(tunnels)
 
+		if noShell {
+			return waitForTunnels(client)
+		}
 
-		// The actual connection logic is in the ssh package
-		if err := ssh.Connect(&conn); err != nil {
-			// The error from the ssh package is often not very user-friendly
-			// on its own (e.g., "EOF"). We add context here.
+		if err := ssh.Shell(client, &conn); err != nil {
 			return fmt.Errorf("ssh connection failed: %w", err)
 		}
 
@@ -74,7 +75,39 @@ var connectCmd = &cobra.Command{
 	},
 }
 
+// recordUse updates the last used time and use count of a connection, which
+// rank it in the picker.
+func recordUse(connName string) {
+	if err := config.RecordUse(connName); err != nil {
+		// Log this error but don't block the connection for it
+		fmt.Println("Warning: could not update last used time:", err)
+	}
+}
+
+// findConnection looks up a connection by ID or, failing that, by name.
+// It returns the connection, with the settings it inherits from its groups
+// resolved, together with its key in cfg.Connections.
+func findConnection(cfg *models.AppConfig, identifier string) (models.Connection, string, error) {
+	// Try to parse identifier as an ID
+	if id, err := strconv.Atoi(identifier); err == nil {
+		for name, c := range cfg.Connections {
+			if c.ID == id {
+				return cfg.Resolve(c).Connection, name, nil
+			}
+		}
+	}
+
+	// If not found by ID, or if identifier was not an integer, try by name
+	if conn, found := cfg.Connections[identifier]; found {
+		return cfg.Resolve(conn).Connection, identifier, nil
+	}
+
+	return models.Connection{}, "", errors.New("connection with this name or ID does not exist")
+}
 
 func init() {
 	rootCmd.AddCommand(connectCmd)
+
+	connectCmd.Flags().Bool("tunnels", false, "Bring up the connection's saved port forwards alongside the shell")
+	connectCmd.Flags().Bool("no-shell", false, "Only keep the saved port forwards open, without starting a shell")
 }
@@ -6,6 +6,8 @@ import (
 
 	"github.com/spf13/cobra"
 	"sm/internal/config"
+	"sm/internal/models"
+	"sm/internal/ssh"
 	"sm/internal/utils"
 )
 
@@ -13,50 +15,92 @@ import (
 var editCmd = &cobra.Command{
 	Use:   "edit <name>",
 	Short: "Edit an existing SSH connection",
-	Long:  `Edit an existing SSH connection by providing new values for the fields you want to change.`, 
+	Long:  `Edit an existing SSH connection by providing new values for the fields you want to change.`,
 	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		name := args[0]
 
-		cfg, err := config.GetConfig()
-		if err != nil {
-			return fmt.Errorf("failed to get config: %w", err)
-		}
+		err := config.Update(func(cfg *models.AppConfig) error {
+			conn, exists := cfg.Connections[name]
+			if !exists {
+				return errors.New("connection with this name does not exist")
+			}
 
-		conn, exists := cfg.Connections[name]
-		if !exists {
-			return errors.New("connection with this name does not exist")
-		}
+			if cmd.Flags().Changed("host") {
+				conn.Host, _ = cmd.Flags().GetString("host")
+			}
+			if cmd.Flags().Changed("user") {
+				conn.User, _ = cmd.Flags().GetString("user")
+			}
+			if cmd.Flags().Changed("port") {
+				conn.Port, _ = cmd.Flags().GetInt("port")
+			}
+			if cmd.Flags().Changed("key") {
+				conn.KeyPath, _ = cmd.Flags().GetString("key")
+			}
+			if cmd.Flags().Changed("pass") {
+				// An empty string clears the password
+				password, _ := cmd.Flags().GetString("pass")
+				sealed, err := utils.SealPassword(password, cfg.Settings.EncryptPasswords)
+				if err != nil {
+					return fmt.Errorf("failed to save password: %w", err)
+				}
+				conn.Password = sealed
+			}
+			if cmd.Flags().Changed("key-passphrase") {
+				// An empty string clears the passphrase
+				conn.KeyPassphrase, _ = cmd.Flags().GetString("key-passphrase")
+				if err := validateKeyPassphrase(conn.KeyPassphrase); err != nil {
+					return err
+				}
+			}
 
-		if cmd.Flags().Changed("host") {
-			conn.Host, _ = cmd.Flags().GetString("host")
-		}
-		if cmd.Flags().Changed("user") {
-			conn.User, _ = cmd.Flags().GetString("user")
-		}
-		if cmd.Flags().Changed("port") {
-			conn.Port, _ = cmd.Flags().GetInt("port")
-		}
-		if cmd.Flags().Changed("key") {
-			conn.KeyPath, _ = cmd.Flags().GetString("key")
-		}
-		if cmd.Flags().Changed("pass") {
-			password, _ := cmd.Flags().GetString("pass")
-			if password != "" {
-				encryptedPass, err := utils.Encrypt(password)
+			if cmd.Flags().Changed("strict-host-key-checking") {
+				mode, _ := cmd.Flags().GetString("strict-host-key-checking")
+				if !models.ValidHostKeyChecking(mode) {
+					return fmt.Errorf("invalid strict host key checking mode: %s. Valid modes are 'yes', 'ask', 'accept-new' and 'no'", mode)
+				}
+				conn.StrictHostKeyChecking = mode
+			}
+
+			if cmd.Flags().Changed("forward-agent") {
+				conn.ForwardAgent, _ = cmd.Flags().GetBool("forward-agent")
+			}
+
+			if cmd.Flags().Changed("jump") {
+				conn.JumpHosts, _ = cmd.Flags().GetStringSlice("jump")
+			}
+
+			if cmd.Flags().Changed("group") {
+				// An empty string takes the connection out of its group
+				conn.Group, _ = cmd.Flags().GetString("group")
+				if err := validateGroup(conn.Group); err != nil {
+					return err
+				}
+			}
+
+			if cmd.Flags().Changed("tag") {
+				tags, _ := cmd.Flags().GetStringSlice("tag")
+				cleaned, err := models.CleanTags(tags)
 				if err != nil {
-					return fmt.Errorf("failed to encrypt password: %w", err)
+					return err
 				}
-			conn.Password = encryptedPass
-			} else {
-			conn.Password = "" // Clear password if empty string is provided
+				conn.Tags = cleaned
 			}
-		}
 
-		cfg.Connections[name] = conn
+			// Make sure the jump hosts, including those of the group, exist and
+			// do not loop back on themselves
+			if cmd.Flags().Changed("jump") || cmd.Flags().Changed("group") {
+				if _, err := ssh.JumpChain(cfg, &conn); err != nil {
+					return err
+				}
+			}
 
-		if err := config.SaveConfig(cfg); err != nil {
-			return fmt.Errorf("failed to save config: %w", err)
+			cfg.Connections[name] = conn
+			return nil
+		})
+		if err != nil {
+			return err
 		}
 
 		fmt.Printf("Successfully updated connection '%s'\n", name)
@@ -68,8 +112,14 @@ func init() {
 	rootCmd.AddCommand(editCmd)
 
 	editCmd.Flags().String("host", "", "New host name or IP address")
-	editCmd.Flags().String("user", "", "New username for the connection")
-	editCmd.Flags().IntP("port", "p", 0, "New port number for the connection")
-	editCmd.Flags().String("key", "", "New path to the private SSH key")
-	editCmd.Flags().String("pass", "", "New password for the connection")
-}
\ No newline at end of file
+	editCmd.Flags().String("user", "", "New username for the connection (use \"\" to inherit it from the group)")
+	editCmd.Flags().IntP("port", "p", 0, "New port number for the connection (use 0 to inherit it from the group)")
+	editCmd.Flags().String("key", "", "New path to the private SSH key (use \"\" to inherit it from the group)")
+	editCmd.Flags().String("pass", "", "New password for the connection, or a secret reference such as ref:env:NAME")
+	editCmd.Flags().String("key-passphrase", "", "New secret reference to the passphrase of the private key (use \"\" to clear)")
+	editCmd.Flags().String("strict-host-key-checking", "", "New host key checking mode (yes, ask, accept-new, no)")
+	editCmd.Flags().BoolP("forward-agent", "A", false, "Forward the local ssh-agent to the remote host (use --forward-agent=false to disable)")
+	editCmd.Flags().StringSliceP("jump", "J", nil, "New jump host chain, in order (use --jump \"\" to clear)")
+	editCmd.Flags().String("group", "", "New group to inherit settings from (use \"\" to leave the group)")
+	editCmd.Flags().StringSlice("tag", nil, "New tags for the connection, replacing the current ones (use --tag \"\" to clear; see also 'sm tag')")
+}
@@ -0,0 +1,378 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"sm/internal/config"
+	"sm/internal/models"
+	"sm/internal/ssh"
+)
+
+// sshErrorExitCode is the exit status used when the connection itself fails,
+// matching OpenSSH so scripts can tell it apart from a remote failure.
+const sshErrorExitCode = 255
+
+// execCmd represents the exec command
+var execCmd = &cobra.Command{
+	Use:   "exec [<name_or_id> | --tag <tag>] -- <command> [args...]",
+	Short: "Run a command on one or more saved SSH servers",
+	Long: `Runs a single command on the specified server without an interactive shell.
+The remote stdout and stderr are streamed to the local stdout and stderr, and sm exits
+with the exit status of the remote command (255 if the connection fails).
+
+With --tag, the command is run on every connection carrying all of the given tags,
+using a bounded pool of parallel workers. Each output line is prefixed with the
+connection name, and a summary of exit codes and durations is printed at the end.
+sm then exits with status 1 if the command failed anywhere.
+
+A connection name cannot be combined with --tag, and --tty only applies to a
+single connection with text output, as the other modes do not write to a terminal.`,
+	Example: `  sm exec web -- uptime
+  sm exec db -- 'pg_dump mydb' > mydb.sql
+  sm exec web -t -- htop
+  sm exec --tag web --parallel 20 -- systemctl status nginx
+  sm exec --tag web --fail-fast --format json -- ./deploy.sh`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		tags, _ := cmd.Flags().GetStringSlice("tag")
+		if len(tags) > 0 {
+			return cobra.MinimumNArgs(1)(cmd, args)
+		}
+		return cobra.MinimumNArgs(2)(cmd, args)
+	},
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.GetConfig()
+		if err != nil {
+			return fmt.Errorf("failed to get config: %w", err)
+		}
+
+		tags, _ := cmd.Flags().GetStringSlice("tag")
+		format, _ := cmd.Flags().GetString("format")
+		if format != "text" && format != "json" {
+			return fmt.Errorf("invalid format: %s. Valid formats are 'text' and 'json'", format)
+		}
+
+		forcePTY, _ := cmd.Flags().GetBool("tty")
+		if err := checkExecArgs(cfg, args, cmd.ArgsLenAtDash(), tags, forcePTY, format); err != nil {
+			return err
+		}
+
+		var targets []models.Connection
+		if len(tags) > 0 {
+			targets = connectionsWithTags(cfg, tags)
+			if len(targets) == 0 {
+				return fmt.Errorf("no connections are tagged %s", strings.Join(tags, ", "))
+			}
+		} else {
+			conn, _, err := findConnection(cfg, args[0])
+			if err != nil {
+				return err
+			}
+			targets = []models.Connection{conn}
+			args = args[1:]
+		}
+
+		command := strings.Join(args, " ")
+
+		if len(tags) == 0 && format == "text" {
+			return execSingle(cmd, cfg, &targets[0], command, forcePTY)
+		}
+
+		parallel, _ := cmd.Flags().GetInt("parallel")
+		if parallel < 1 {
+			return errors.New("--parallel must be at least 1")
+		}
+		failFast, _ := cmd.Flags().GetBool("fail-fast")
+
+		results := execParallel(cfg, targets, command, parallel, failFast, format == "json")
+
+		if format == "json" {
+			out, err := json.MarshalIndent(results, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to format to json: %w", err)
+			}
+			fmt.Println(string(out))
+		} else {
+			printExecSummary(results)
+		}
+
+		for _, r := range results {
+			if !r.succeeded() {
+				cmd.SilenceErrors = true
+				return &exitCodeError{code: 1}
+			}
+		}
+		return nil
+	},
+}
+
+// checkExecArgs rejects flag and argument combinations that exec would
+// otherwise silently ignore. dashAt is the number of arguments given before
+// "--", or -1 if there was none.
+func checkExecArgs(cfg *models.AppConfig, args []string, dashAt int, tags []string, forcePTY bool, format string) error {
+	if forcePTY && (len(tags) > 0 || format != "text") {
+		return errors.New("--tty cannot be used with --tag or --format json")
+	}
+	// Anything after "--" is the command, even if it happens to match a name
+	if len(tags) > 0 && dashAt != 0 {
+		if _, name, err := findConnection(cfg, args[0]); err == nil {
+			return fmt.Errorf("'%s' is a saved connection and cannot be combined with --tag; put the command after --", name)
+		}
+	}
+	return nil
+}
+
+// execSingle runs command on a single connection, wiring it straight to the
+// local terminal and exiting with the remote exit status.
+func execSingle(cmd *cobra.Command, cfg *models.AppConfig, conn *models.Connection, command string, forcePTY bool) error {
+	client, err := ssh.Dial(cfg, conn)
+	if err != nil {
+		return &exitCodeError{code: sshErrorExitCode, err: fmt.Errorf("ssh connection failed: %w", err)}
+	}
+	defer client.Close()
+
+	status, err := ssh.Exec(client, conn, command, ssh.ExecOptions{
+		Stdin:    os.Stdin,
+		Stdout:   os.Stdout,
+		Stderr:   os.Stderr,
+		ForcePTY: forcePTY,
+	})
+	if err != nil {
+		return &exitCodeError{code: sshErrorExitCode, err: err}
+	}
+
+	if status != 0 {
+		// The remote command already reported its own failure
+		cmd.SilenceErrors = true
+		return &exitCodeError{code: status}
+	}
+	return nil
+}
+
+// execResult is the outcome of running a command on one connection.
+type execResult struct {
+	Name     string        `json:"name"`
+	Host     string        `json:"host"`
+	ExitCode int           `json:"exit_code"`
+	Duration time.Duration `json:"-"`
+	Millis   int64         `json:"duration_ms"`
+	Stdout   string        `json:"stdout,omitempty"`
+	Stderr   string        `json:"stderr,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Skipped  bool          `json:"skipped,omitempty"`
+}
+
+func (r execResult) succeeded() bool {
+	return r.Error == "" && !r.Skipped && r.ExitCode == 0
+}
+
+// connectionsWithTags returns the connections carrying all of tags, including
+// those inherited from their groups, sorted by name.
+func connectionsWithTags(cfg *models.AppConfig, tags []string) []models.Connection {
+	var matches []models.Connection
+	for _, conn := range cfg.Connections {
+		if conn = cfg.Resolve(conn).Connection; hasAllTags(conn, tags) {
+			matches = append(matches, conn)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Name < matches[j].Name })
+	return matches
+}
+
+// hasAllTags reports whether conn carries every tag in tags.
+func hasAllTags(conn models.Connection, tags []string) bool {
+	for _, want := range tags {
+		found := false
+		for _, have := range conn.Tags {
+			if have == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// execParallel runs command on every target using at most parallel workers.
+// In text mode output is streamed with a name prefix; when capture is set it
+// is collected into the results instead. With failFast, no new connections are
+// started after the first failure. Results are returned in target order.
+func execParallel(cfg *models.AppConfig, targets []models.Connection, command string, parallel int, failFast, capture bool) []execResult {
+	results := make([]execResult, len(targets))
+	jobs := make(chan int)
+
+	width := 0
+	for _, t := range targets {
+		if len(t.Name) > width {
+			width = len(t.Name)
+		}
+	}
+
+	var stdoutMu, stderrMu sync.Mutex
+	var failedMu sync.Mutex
+	failed := false
+
+	var wg sync.WaitGroup
+	for w := 0; w < parallel && w < len(targets); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				conn := targets[i]
+				result := execResult{Name: conn.Name, Host: conn.Host, ExitCode: -1}
+
+				failedMu.Lock()
+				skip := failFast && failed
+				failedMu.Unlock()
+
+				if skip {
+					result.Skipped = true
+				} else {
+					var stdout, stderr io.Writer
+					var stdoutBuf, stderrBuf bytes.Buffer
+					var outPrefix, errPrefix *prefixWriter
+
+					if capture {
+						stdout, stderr = &stdoutBuf, &stderrBuf
+					} else {
+						prefix := fmt.Sprintf("%-*s | ", width, conn.Name)
+						outPrefix = &prefixWriter{mu: &stdoutMu, out: os.Stdout, prefix: prefix}
+						errPrefix = &prefixWriter{mu: &stderrMu, out: os.Stderr, prefix: prefix}
+						stdout, stderr = outPrefix, errPrefix
+					}
+
+					start := time.Now()
+					result.ExitCode, result.Error = execOne(cfg, &conn, command, stdout, stderr)
+					result.Duration = time.Since(start)
+
+					if capture {
+						result.Stdout, result.Stderr = stdoutBuf.String(), stderrBuf.String()
+					} else {
+						outPrefix.Flush()
+						errPrefix.Flush()
+						if result.Error != "" {
+							errPrefix.Write([]byte("error: " + result.Error + "\n"))
+							errPrefix.Flush()
+						}
+					}
+				}
+
+				result.Millis = result.Duration.Milliseconds()
+				results[i] = result
+
+				if !result.succeeded() && !result.Skipped {
+					failedMu.Lock()
+					failed = true
+					failedMu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for i := range targets {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// execOne connects to conn and runs command, returning the exit code and an
+// error message if the command could not be run.
+func execOne(cfg *models.AppConfig, conn *models.Connection, command string, stdout, stderr io.Writer) (int, string) {
+	client, err := ssh.Dial(cfg, conn)
+	if err != nil {
+		return -1, err.Error()
+	}
+	defer client.Close()
+
+	status, err := ssh.Exec(client, conn, command, ssh.ExecOptions{Stdout: stdout, Stderr: stderr})
+	if err != nil {
+		return -1, err.Error()
+	}
+	return status, ""
+}
+
+// printExecSummary prints a table of per-connection results.
+func printExecSummary(results []execResult) {
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tHOST\tEXIT\tDURATION\tSTATUS")
+	for _, r := range results {
+		exit := fmt.Sprintf("%d", r.ExitCode)
+		status := "ok"
+		switch {
+		case r.Skipped:
+			exit, status = "-", "skipped"
+		case r.Error != "":
+			exit, status = "-", "error: "+r.Error
+		case r.ExitCode != 0:
+			status = "failed"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Name, r.Host, exit, r.Duration.Round(time.Millisecond), status)
+	}
+	w.Flush()
+}
+
+// prefixWriter writes complete lines to out, each prefixed with prefix.
+// Writers sharing an output share its mutex, so lines from different
+// connections never interleave mid-line.
+type prefixWriter struct {
+	mu     *sync.Mutex
+	out    io.Writer
+	prefix string
+	buf    []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.writeLine(w.buf[:i+1])
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush writes any trailing partial line.
+func (w *prefixWriter) Flush() {
+	if len(w.buf) > 0 {
+		w.writeLine(append(w.buf, '\n'))
+		w.buf = nil
+	}
+}
+
+func (w *prefixWriter) writeLine(line []byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	io.WriteString(w.out, w.prefix)
+	w.out.Write(line)
+}
+
+func init() {
+	rootCmd.AddCommand(execCmd)
+
+	execCmd.Flags().BoolP("tty", "t", false, "Force allocation of a pseudo-terminal")
+	execCmd.Flags().StringSlice("tag", nil, "Run on every connection with these tags (repeatable or comma-separated)")
+	execCmd.Flags().IntP("parallel", "P", 10, "Maximum number of connections to run on at once")
+	execCmd.Flags().Bool("fail-fast", false, "Stop starting new connections after the first failure")
+	execCmd.Flags().StringP("format", "f", "text", "Output format (text, json)")
+}
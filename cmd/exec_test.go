@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"sm/internal/models"
+)
+
+func TestCheckExecArgs(t *testing.T) {
+	cfg := &models.AppConfig{Connections: map[string]models.Connection{
+		"web": {ID: 4, Name: "web", Host: "10.0.0.1"},
+	}}
+
+	tests := []struct {
+		name   string
+		args   []string
+		dashAt int
+		tags   []string
+		tty    bool
+		format string
+		err    string
+	}{
+		{name: "single connection", args: []string{"web", "uptime"}, dashAt: 1, format: "text"},
+		{name: "tty on a single connection", args: []string{"web", "htop"}, dashAt: 1, tty: true, format: "text"},
+		{name: "tag with the command after --", args: []string{"uptime"}, dashAt: 0, tags: []string{"web"}, format: "text"},
+		{name: "tag with the command and no --", args: []string{"uptime"}, dashAt: -1, tags: []string{"web"}, format: "text"},
+		{name: "a command named like a connection after --", args: []string{"web"}, dashAt: 0, tags: []string{"web"}, format: "text"},
+		{
+			name: "tty with tag", args: []string{"htop"}, dashAt: 0, tags: []string{"web"}, tty: true, format: "text",
+			err: "--tty cannot be used with --tag",
+		},
+		{
+			name: "tty with json", args: []string{"web", "htop"}, dashAt: 1, tty: true, format: "json",
+			err: "--tty cannot be used with --tag or --format json",
+		},
+		{
+			name: "connection name with tag", args: []string{"web", "uptime"}, dashAt: 1, tags: []string{"prod"}, format: "text",
+			err: "'web' is a saved connection and cannot be combined with --tag",
+		},
+		{
+			name: "connection ID with tag and no --", args: []string{"4", "uptime"}, dashAt: -1, tags: []string{"prod"}, format: "text",
+			err: "'web' is a saved connection",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkExecArgs(cfg, tt.args, tt.dashAt, tt.tags, tt.tty, tt.format)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("checkExecArgs failed: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("checkExecArgs error = %v, want it to contain %q", err, tt.err)
+			}
+		})
+	}
+}
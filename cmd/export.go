@@ -1,40 +1,84 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v3"
 	"sm/internal/config"
+	"sm/internal/models"
+	"sm/internal/utils"
 )
 
 // exportCmd represents the export command
 var exportCmd = &cobra.Command{
 	Use:   "export",
-	Short: "Export all connections to a YAML file",
-	Long:  `Exports all saved SSH connections and configurations to a specified YAML file or to standard output.`,
+	Short: "Export all connections to a YAML file or an OpenSSH config",
+	Long: `Exports all saved SSH connections and configurations to a specified YAML file or to standard output.
+
+With --format ssh-config, every connection is written as an OpenSSH Host block instead,
+including its jump hosts, key file and port, with tags and descriptions as comments.
+Passwords and saved tunnels are not exported in this format.
+
+Saved passwords are encrypted with a key that only exists on this machine. To move
+connections with their passwords to another machine, use --encrypt: the passwords are
+decrypted and the whole export is encrypted with a passphrase instead. 'sm import'
+recognizes the bundle, asks for the passphrase and encrypts the passwords with the
+key of the importing machine. Secret references such as ref:env:NAME are exported as
+they are.`,
+	Example: `  sm export -o backup.yaml
+  sm export --encrypt -o laptop.smb
+  sm export --format ssh-config >> ~/.ssh/config`,
+	SilenceUsage: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cfg, err := config.GetConfig()
 		if err != nil {
 			return fmt.Errorf("failed to get config: %w", err)
 		}
 
-		bytes, err := yaml.Marshal(cfg)
-		if err != nil {
-			return fmt.Errorf("failed to marshal config to YAML: %w", err)
+		format, _ := cmd.Flags().GetString("format")
+		encrypt, _ := cmd.Flags().GetBool("encrypt")
+		if encrypt && format != "yaml" {
+			return errors.New("--encrypt is only supported with --format yaml")
+		}
+
+		var bytes []byte
+		switch format {
+		case "yaml":
+			if encrypt {
+				passphraseRef, _ := cmd.Flags().GetString("passphrase")
+				bytes, err = exportBundle(cfg, passphraseRef)
+				if err != nil {
+					return err
+				}
+				break
+			}
+			bytes, err = yaml.Marshal(cfg)
+			if err != nil {
+				return fmt.Errorf("failed to marshal config to YAML: %w", err)
+			}
+		case "ssh-config":
+			bytes = []byte(config.RenderSSHConfig(cfg))
+		default:
+			return fmt.Errorf("invalid format: %s. Valid formats are 'yaml' and 'ssh-config'", format)
 		}
 
 		outputFile, _ := cmd.Flags().GetString("output")
 
 		if outputFile != "" {
-			err = ioutil.WriteFile(outputFile, bytes, 0644)
+			// The export holds passwords, encrypted or not
+			err = ioutil.WriteFile(outputFile, bytes, 0600)
 			if err != nil {
 				return fmt.Errorf("failed to write to output file %s: %w", outputFile, err)
 			}
 			fmt.Printf("Successfully exported configuration to %s\n", outputFile)
 		} else {
-			fmt.Println(string(bytes))
+			fmt.Print(string(bytes))
 		}
 
 		return nil
@@ -45,4 +89,73 @@ func init() {
 	rootCmd.AddCommand(exportCmd)
 
 	exportCmd.Flags().StringP("output", "o", "", "Output file path for the backup (default is standard output)")
-}
\ No newline at end of file
+	exportCmd.Flags().StringP("format", "f", "yaml", "Output format (yaml, ssh-config)")
+	exportCmd.Flags().Bool("encrypt", false, "Encrypt the export with a passphrase, with passwords readable on another machine")
+	exportCmd.Flags().String("passphrase", "", "Secret reference to the passphrase for --encrypt, such as ref:env:NAME (default: ask)")
+}
+
+// exportBundle decrypts the saved passwords of cfg and encrypts the result
+// with a passphrase.
+func exportBundle(cfg *models.AppConfig, passphraseRef string) ([]byte, error) {
+	portable := *cfg
+	portable.Connections = make(map[string]models.Connection, len(cfg.Connections))
+	// The key source of this machine means nothing on another one
+	portable.Settings.Encryption = models.EncryptionSettings{}
+
+	var keyringRefs []string
+	for name, conn := range cfg.Connections {
+		if utils.IsSecretRef(conn.Password) {
+			if scheme, _, _ := utils.ParseSecretRef(conn.Password); scheme == "keyring" {
+				keyringRefs = append(keyringRefs, name)
+			}
+		} else if conn.Password != "" {
+			plaintext, status, err := checkPassword(conn.Password)
+			if status == passwordUndecryptable || status == "" {
+				return nil, fmt.Errorf("failed to decrypt the saved password of %s (see 'sm secrets verify'): %w", name, err)
+			}
+			conn.Password = plaintext
+		}
+		portable.Connections[name] = conn
+	}
+
+	passphrase, err := bundlePassphrase(passphraseRef, true)
+	if err != nil {
+		return nil, err
+	}
+	bytes, err := config.EncryptBundle(&portable, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keyringRefs) > 0 {
+		sort.Strings(keyringRefs)
+		fmt.Fprintf(os.Stderr, "Note: the passwords of %s refer to this machine's keyring. Save them on the other machine with 'sm secrets set'.\n", strings.Join(keyringRefs, ", "))
+	}
+	return bytes, nil
+}
+
+// bundlePassphrase resolves the passphrase of an export bundle from a secret
+// reference, or asks for it, twice when confirm is set.
+func bundlePassphrase(ref string, confirm bool) (string, error) {
+	if ref != "" {
+		return utils.ResolveSecret(ref)
+	}
+
+	passphrase, err := utils.ReadPassword("Bundle passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return "", errors.New("passphrase cannot be empty")
+	}
+	if confirm {
+		repeat, err := utils.ReadPassword("Repeat bundle passphrase: ")
+		if err != nil {
+			return "", err
+		}
+		if passphrase != repeat {
+			return "", errors.New("passphrases do not match")
+		}
+	}
+	return passphrase, nil
+}
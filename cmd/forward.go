@@ -0,0 +1,237 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	gossh "golang.org/x/crypto/ssh"
+	"sm/internal/config"
+	"sm/internal/models"
+	"sm/internal/ssh"
+)
+
+// forwardCmd represents the forward command
+var forwardCmd = &cobra.Command{
+	Use:   "forward <name_or_id>",
+	Short: "Forward ports through a saved SSH server",
+	Long: `Opens local (-L), remote (-R) and dynamic SOCKS5 (-D) port forwards through the
+specified server and keeps them open until interrupted. Forward specs use OpenSSH syntax.
+
+Without any -L, -R, -D or --tunnel flags, all of the connection's saved tunnels are started.
+Use --save to store a single forward on the connection under a name.`,
+	Example: `  sm forward db -L 8080:db.internal:5432
+  sm forward web -R 9000:localhost:3000 -D 1080
+  sm forward db -L 5432:localhost:5432 --save postgres
+  sm forward db --tunnel postgres`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.GetConfig()
+		if err != nil {
+			return fmt.Errorf("failed to get config: %w", err)
+		}
+
+		conn, connName, err := findConnection(cfg, args[0])
+		if err != nil {
+			return err
+		}
+
+		if list, _ := cmd.Flags().GetBool("list"); list {
+			return listForwards(conn)
+		}
+
+		if name, _ := cmd.Flags().GetString("delete"); name != "" {
+			return deleteForward(connName, name)
+		}
+
+		forwards, err := forwardsFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		// Validate every spec before connecting
+		for _, f := range forwards {
+			if _, err := ssh.ParseForward(f); err != nil {
+				return err
+			}
+		}
+
+		if name, _ := cmd.Flags().GetString("save"); name != "" {
+			conn, err = saveForward(connName, name, forwards)
+			if err != nil {
+				return err
+			}
+		}
+
+		selected, _ := cmd.Flags().GetStringSlice("tunnel")
+		for _, name := range selected {
+			f, found := findForward(conn, name)
+			if !found {
+				return fmt.Errorf("connection '%s' has no saved tunnel named '%s'", connName, name)
+			}
+			forwards = append(forwards, f)
+		}
+
+		if len(forwards) == 0 && len(selected) == 0 {
+			forwards = conn.Forwards
+		}
+		if len(forwards) == 0 {
+			return errors.New("no forwards given. Use -L, -R or -D, or save tunnels with --save")
+		}
+
+		fmt.Printf("Connecting to %s (%s@%s)...\n", conn.Name, conn.User, conn.Host)
+		client, err := ssh.Dial(cfg, &conn)
+		if err != nil {
+			return fmt.Errorf("ssh connection failed: %w", err)
+		}
+		defer client.Close()
+
+		tunnels, err := ssh.StartTunnels(client, forwards)
+		if err != nil {
+			return err
+		}
+		defer ssh.CloseAll(tunnels)
+
+		return waitForTunnels(client)
+	},
+}
+
+// forwardsFromFlags collects the -L, -R and -D specs given on the command line.
+func forwardsFromFlags(cmd *cobra.Command) ([]models.Forward, error) {
+	var forwards []models.Forward
+	for _, forwardType := range []string{models.ForwardLocal, models.ForwardRemote, models.ForwardDynamic} {
+		// The flags are named after the forward types
+		specs, err := cmd.Flags().GetStringArray(forwardType)
+		if err != nil {
+			return nil, err
+		}
+		for _, spec := range specs {
+			forwards = append(forwards, models.Forward{Type: forwardType, Spec: spec})
+		}
+	}
+	return forwards, nil
+}
+
+// findForward returns the saved forward with the given name.
+func findForward(conn models.Connection, name string) (models.Forward, bool) {
+	for _, f := range conn.Forwards {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return models.Forward{}, false
+}
+
+// saveForward stores a single forward on the connection under name and
+// returns the updated connection.
+func saveForward(connName, name string, forwards []models.Forward) (models.Connection, error) {
+	if len(forwards) != 1 {
+		return models.Connection{}, errors.New("--save requires exactly one -L, -R or -D forward")
+	}
+
+	var conn models.Connection
+	err := config.Update(func(cfg *models.AppConfig) error {
+		var exists bool
+		conn, exists = cfg.Connections[connName]
+		if !exists {
+			return fmt.Errorf("connection '%s' does not exist", connName)
+		}
+		if _, exists := findForward(conn, name); exists {
+			return fmt.Errorf("connection '%s' already has a tunnel named '%s'", connName, name)
+		}
+
+		f := forwards[0]
+		f.Name = name
+		conn.Forwards = append(conn.Forwards, f)
+		cfg.Connections[connName] = conn
+		return nil
+	})
+	if err != nil {
+		return models.Connection{}, err
+	}
+	fmt.Printf("Saved tunnel '%s' on connection '%s'\n", name, connName)
+	return conn, nil
+}
+
+// deleteForward removes the named forward from the connection.
+func deleteForward(connName, name string) error {
+	err := config.Update(func(cfg *models.AppConfig) error {
+		conn := cfg.Connections[connName]
+
+		var kept []models.Forward
+		for _, f := range conn.Forwards {
+			if f.Name != name {
+				kept = append(kept, f)
+			}
+		}
+		if len(kept) == len(conn.Forwards) {
+			return fmt.Errorf("connection '%s' has no saved tunnel named '%s'", connName, name)
+		}
+
+		conn.Forwards = kept
+		cfg.Connections[connName] = conn
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Removed tunnel '%s' from connection '%s'\n", name, connName)
+	return nil
+}
+
+// listForwards prints the connection's saved forwards.
+func listForwards(conn models.Connection) error {
+	if len(conn.Forwards) == 0 {
+		fmt.Printf("Connection '%s' has no saved tunnels.\n", conn.Name)
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTYPE\tSPEC")
+	for _, f := range conn.Forwards {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", f.Name, f.Type, f.Spec)
+	}
+	w.Flush()
+	return nil
+}
+
+// waitForTunnels keeps the client alive until the user interrupts or the
+// server goes away.
+func waitForTunnels(client *gossh.Client) error {
+	fmt.Println("Tunnels are up. Press Ctrl+C to stop.")
+
+	go ssh.KeepAlive(client)
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- client.Wait()
+	}()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+
+	select {
+	case <-interrupt:
+		fmt.Println("\nStopping tunnels.")
+		return nil
+	case err := <-closed:
+		return fmt.Errorf("connection lost: %w", err)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(forwardCmd)
+
+	forwardCmd.Flags().StringArrayP("local", "L", nil, "Local forward [bind_address:]port:host:hostport (repeatable)")
+	forwardCmd.Flags().StringArrayP("remote", "R", nil, "Remote forward [bind_address:]port:host:hostport (repeatable)")
+	forwardCmd.Flags().StringArrayP("dynamic", "D", nil, "Dynamic SOCKS5 forward [bind_address:]port (repeatable)")
+	forwardCmd.Flags().StringSlice("tunnel", nil, "Start the saved tunnel with this name (repeatable)")
+	forwardCmd.Flags().String("save", "", "Save the given forward on the connection under this name")
+	forwardCmd.Flags().String("delete", "", "Delete the saved tunnel with this name")
+	forwardCmd.Flags().Bool("list", false, "List the connection's saved tunnels")
+}
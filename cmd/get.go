@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"github.com/pkg/sftp"
+	"github.com/spf13/cobra"
+	"sm/internal/ssh"
+)
+
+// getCmd represents the get command
+var getCmd = &cobra.Command{
+	Use:   "get <name_or_id> <remote>... <local>",
+	Short: "Download files from a saved SSH server",
+	Long: `Copies files from the specified server to the local machine over SFTP. Remote paths
+may be glob patterns. When several files are given, the local destination must be an
+existing directory.`,
+	Example: `  sm get web /var/log/nginx/access.log .
+  sm get web -r -p /etc/nginx ./nginx-backup
+  sm get web '/var/log/*.gz' ./logs/
+  sm get db --resume /backups/dump.sql.gz .`,
+	Args:         cobra.MinimumNArgs(3),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts := transferOptions(cmd)
+
+		return withSFTP(args[0], func(sc *sftp.Client) error {
+			return ssh.Download(sc, args[1:len(args)-1], args[len(args)-1], opts)
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(getCmd)
+
+	addTransferFlags(getCmd)
+}
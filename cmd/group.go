@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"sm/internal/models"
+)
+
+// groupCmd represents the group command
+var groupCmd = &cobra.Command{
+	Use:   "group",
+	Short: "Manage connection groups and the settings they share",
+	Long: `Groups are named by paths such as prod/eu/db and can set the user, port, key,
+jump hosts and tags of the connections in them. A connection in prod/eu/db
+inherits each of these it does not set itself from prod/eu/db, then prod/eu,
+then prod, and finally from default_user, default_port and default_key_path in
+the configuration file. Tags are added up from every level.
+
+Put a connection in a group with 'sm add --group' or 'sm edit --group', see
+the hierarchy with 'sm list --tree', and where each value of a connection
+comes from with 'sm show'.`,
+}
+
+// validateGroup checks a group path given on the command line. The empty
+// string, for no group, is accepted.
+func validateGroup(path string) error {
+	if path != "" && !models.ValidGroup(path) {
+		return fmt.Errorf("invalid group '%s': use names separated by slashes, such as prod/eu, without spaces, commas, quotes, parentheses or glob characters", path)
+	}
+	return nil
+}
+
+// inGroup reports whether conn is in group or in one of its subgroups.
+func inGroup(conn models.Connection, group string) bool {
+	return conn.Group == group || strings.HasPrefix(conn.Group, group+"/")
+}
+
+func init() {
+	rootCmd.AddCommand(groupCmd)
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"sm/internal/config"
+)
+
+// groupListCmd represents the list command for groups
+var groupListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List groups and their settings",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.GetConfig()
+		if err != nil {
+			return fmt.Errorf("failed to get config: %w", err)
+		}
+
+		if len(cfg.Groups) == 0 {
+			fmt.Println("No groups found. Use 'sm group set' to create one.")
+			return nil
+		}
+
+		paths := make([]string, 0, len(cfg.Groups))
+		for path := range cfg.Groups {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "GROUP\tUSER\tPORT\tKEY PATH\tJUMP HOSTS\tTAGS\tCONNECTIONS")
+		for _, path := range paths {
+			group := cfg.Groups[path]
+			port := ""
+			if group.Port != 0 {
+				port = fmt.Sprint(group.Port)
+			}
+			members := 0
+			for _, conn := range cfg.Connections {
+				if inGroup(conn, path) {
+					members++
+				}
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d\n", path, group.User, port, group.KeyPath,
+				strings.Join(group.JumpHosts, ","), strings.Join(group.Tags, ","), members)
+		}
+		w.Flush()
+
+		return nil
+	},
+}
+
+func init() {
+	groupCmd.AddCommand(groupListCmd)
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"sm/internal/config"
+	"sm/internal/models"
+	"sm/internal/ssh"
+)
+
+// groupRmCmd represents the rm command for groups
+var groupRmCmd = &cobra.Command{
+	Use:   "rm <group>",
+	Short: "Remove the settings of a group",
+	Long: `Removes the settings of a group. Its connections stay in the group and inherit
+from the groups above it instead; use 'sm edit --group' to move them.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := args[0]
+
+		members := 0
+		err := config.Update(func(cfg *models.AppConfig) error {
+			if _, exists := cfg.Groups[path]; !exists {
+				return errors.New("group with this name does not exist")
+			}
+			delete(cfg.Groups, path)
+
+			members = 0
+			for name, conn := range cfg.Connections {
+				if !inGroup(conn, path) {
+					continue
+				}
+				members++
+				if _, err := ssh.JumpChain(cfg, &conn); err != nil {
+					return fmt.Errorf("%s: %w", name, err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Successfully removed group '%s'\n", path)
+		if members > 0 {
+			fmt.Printf("Its %d connection(s) now inherit from the groups above it.\n", members)
+		}
+		return nil
+	},
+}
+
+func init() {
+	groupCmd.AddCommand(groupRmCmd)
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"sm/internal/config"
+	"sm/internal/models"
+	"sm/internal/ssh"
+)
+
+// groupSetCmd represents the set command for groups
+var groupSetCmd = &cobra.Command{
+	Use:   "set <group>",
+	Short: "Create a group or change its settings",
+	Long: `Creates a group, or changes the settings of an existing one. Only the given
+flags are changed; pass an empty value to stop setting a field, so that it is
+inherited from the groups above.
+
+Examples:
+  sm group set prod --user deploy --jump bastion --tag prod
+  sm group set prod/eu --key ~/.ssh/id_eu
+  sm group set prod/eu/db --port 5022
+  sm group set prod --jump ""`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := args[0]
+		if path == "" {
+			return errors.New("group cannot be empty")
+		}
+		if err := validateGroup(path); err != nil {
+			return err
+		}
+
+		created := false
+		err := config.Update(func(cfg *models.AppConfig) error {
+			group, exists := cfg.Groups[path]
+			created = !exists
+
+			if cmd.Flags().Changed("user") {
+				group.User, _ = cmd.Flags().GetString("user")
+			}
+			if cmd.Flags().Changed("port") {
+				group.Port, _ = cmd.Flags().GetInt("port")
+				if group.Port < 0 || group.Port > 65535 {
+					return errors.New("invalid port number")
+				}
+			}
+			if cmd.Flags().Changed("key") {
+				group.KeyPath, _ = cmd.Flags().GetString("key")
+			}
+			if cmd.Flags().Changed("jump") {
+				group.JumpHosts, _ = cmd.Flags().GetStringSlice("jump")
+			}
+			if cmd.Flags().Changed("tag") {
+				tags, _ := cmd.Flags().GetStringSlice("tag")
+				cleaned, err := models.CleanTags(tags)
+				if err != nil {
+					return err
+				}
+				group.Tags = cleaned
+			}
+
+			if cfg.Groups == nil {
+				cfg.Groups = make(map[string]models.Group)
+			}
+			cfg.Groups[path] = group
+
+			for _, hop := range group.JumpHosts {
+				if _, exists := cfg.Connections[hop]; !exists {
+					return fmt.Errorf("jump host '%s' does not exist", hop)
+				}
+			}
+			// Make sure the jump hosts the connections now inherit exist and
+			// do not loop back on themselves
+			for name, conn := range cfg.Connections {
+				if !inGroup(conn, path) {
+					continue
+				}
+				if _, err := ssh.JumpChain(cfg, &conn); err != nil {
+					return fmt.Errorf("%s: %w", name, err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if created {
+			fmt.Printf("Successfully created group '%s'\n", path)
+		} else {
+			fmt.Printf("Successfully updated group '%s'\n", path)
+		}
+		return nil
+	},
+}
+
+func init() {
+	groupCmd.AddCommand(groupSetCmd)
+
+	groupSetCmd.Flags().String("user", "", "Username for the connections in the group")
+	groupSetCmd.Flags().IntP("port", "p", 0, "Port number for the connections in the group (use 0 to unset)")
+	groupSetCmd.Flags().String("key", "", "Path to the private SSH key for the connections in the group")
+	groupSetCmd.Flags().StringSliceP("jump", "J", nil, "Saved connection(s) to use as jump hosts, in order (repeatable or comma-separated)")
+	groupSetCmd.Flags().StringSlice("tag", nil, "Tags added to every connection in the group (repeatable or comma-separated)")
+}
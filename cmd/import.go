@@ -1,64 +1,342 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
 
+	"github.com/manifoldco/promptui"
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v3"
 	"sm/internal/config"
 	"sm/internal/models"
+	"sm/internal/utils"
+)
+
+// Import sources accepted by --from.
+const (
+	importFromYAML      = "yaml"
+	importFromSSHConfig = "ssh-config"
 )
 
 // importCmd represents the import command
 var importCmd = &cobra.Command{
-	Use:   "import",
-	Short: "Import connections from a YAML file",
-	Long:  `Imports SSH connections from a specified YAML file, merging them with the existing configuration.`,
+	Use:   "import [path]",
+	Short: "Import connections from a YAML file or ~/.ssh/config",
+	Long: `Imports SSH connections and keys from a specified YAML file, merging them with the existing
+configuration. Settings are only imported with --include-settings, and a warning
+lists those that differ from yours otherwise. The encryption key source of this
+machine is always kept.
+
+With --from ssh-config, every concrete Host block of an OpenSSH client config (default
+~/.ssh/config) becomes a connection. HostName, User, Port, IdentityFile, ProxyJump,
+LocalForward, ForwardAgent and StrictHostKeyChecking are imported, Include directives
+are followed, and defaults from wildcard blocks such as 'Host *' are applied to each host.
+A preview, with the differences from existing connections, is shown before anything is saved.
+
+--strategy decides what happens to a name that already exists with different values:
+  skip       keep the existing connection (default)
+  overwrite  replace it, keeping its ID and creation date
+  rename     import under the first free name, such as web-2
+  newest     keep whichever was used or created last; keys keep the existing one
+Identical connections are left alone. New connections are given fresh IDs.
+--dry-run prints what would change, field by field, without saving anything.
+
+Bundles written by 'sm export --encrypt' are recognized automatically. Their passwords
+are encrypted with this machine's key as they are imported.
+
+Secret references that run a command when they are resolved, such as ref:cmd:... or
+a provider from settings.secret_providers, would run that command on the next
+connect. Connections with such references, and new secret providers in included
+settings, are refused unless --allow-command-secrets is given; --dry-run lists them.`,
+	Example: `  sm import -i backup.yaml
+  sm import laptop.smb
+  sm import --from ssh-config
+  sm import --from ssh-config ~/work/ssh_config --yes
+  sm import backup.yaml --strategy rename --dry-run
+  sm import laptop.smb --include-settings`,
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		from, _ := cmd.Flags().GetString("from")
 		inputFile, _ := cmd.Flags().GetString("input")
-		if inputFile == "" {
-			return fmt.Errorf("input file must be specified with --input or -i")
+		if len(args) > 0 {
+			inputFile = args[0]
 		}
 
-		bytes, err := ioutil.ReadFile(inputFile)
-		if err != nil {
-			return fmt.Errorf("failed to read input file %s: %w", inputFile, err)
+		opts := importOptions{}
+		opts.Strategy, _ = cmd.Flags().GetString("strategy")
+		opts.DryRun, _ = cmd.Flags().GetBool("dry-run")
+		opts.Yes, _ = cmd.Flags().GetBool("yes")
+		opts.AllowCommandSecrets, _ = cmd.Flags().GetBool("allow-command-secrets")
+		opts.IncludeSettings, _ = cmd.Flags().GetBool("include-settings")
+		if err := validateStrategy(opts.Strategy); err != nil {
+			return err
 		}
 
-		var importedCfg models.AppConfig
-		if err := yaml.Unmarshal(bytes, &importedCfg); err != nil {
-			return fmt.Errorf("failed to parse YAML from input file: %w", err)
+		switch from {
+		case importFromYAML:
+			if inputFile == "" {
+				return fmt.Errorf("input file must be specified with --input or -i")
+			}
+			passphraseRef, _ := cmd.Flags().GetString("passphrase")
+			return importYAML(inputFile, passphraseRef, opts)
+		case importFromSSHConfig:
+			if inputFile == "" {
+				path, err := config.DefaultSSHConfigPath()
+				if err != nil {
+					return err
+				}
+				inputFile = path
+			}
+			return importSSHConfig(inputFile, opts)
 		}
+		return fmt.Errorf("invalid source: %s. Valid sources are '%s' and '%s'", from, importFromYAML, importFromSSHConfig)
+	},
+}
 
-		currentCfg, err := config.GetConfig()
+// importOptions are the flags shared by all import sources.
+type importOptions struct {
+	Strategy            string
+	DryRun              bool
+	Yes                 bool
+	AllowCommandSecrets bool
+	IncludeSettings     bool
+}
+
+// importYAML merges the connections and keys of an sm YAML backup, or of an
+// encrypted export bundle, into the configuration, along with its settings
+// if they are included.
+func importYAML(inputFile, passphraseRef string, opts importOptions) error {
+	bytes, err := ioutil.ReadFile(inputFile)
+	if err != nil {
+		return fmt.Errorf("failed to read input file %s: %w", inputFile, err)
+	}
+
+	// The passwords of a bundle are in plaintext, even if they look encrypted
+	bundle := config.IsBundle(bytes)
+	// A file without settings has the defaults, as a new configuration does
+	importedCfg := models.AppConfig{Settings: models.Settings{EncryptPasswords: true}}
+	if bundle {
+		passphrase, err := bundlePassphrase(passphraseRef, false)
+		if err != nil {
+			return err
+		}
+		decrypted, err := config.DecryptBundle(bytes, passphrase)
 		if err != nil {
-			return fmt.Errorf("failed to get current config: %w", err)
+			return err
 		}
+		importedCfg = *decrypted
+	} else if err := yaml.Unmarshal(bytes, &importedCfg); err != nil {
+		return fmt.Errorf("failed to parse YAML from input file: %w", err)
+	}
 
-		importedCount := 0
-		skippedCount := 0
-		for name, conn := range importedCfg.Connections {
-			if _, exists := currentCfg.Connections[name]; exists {
-				skippedCount++
-				continue
-			}
-			currentCfg.Connections[name] = conn
-			importedCount++
+	set := newImportSet(&importedCfg, bundle)
+	set.AllowCommandSecrets = opts.AllowCommandSecrets
+	set.IncludeSettings = opts.IncludeSettings
+	if len(set.Connections) == 0 && len(set.Keys) == 0 && !set.IncludeSettings {
+		fmt.Printf("No connections or keys found in %s\n", inputFile)
+		return nil
+	}
+	if opts.DryRun {
+		return previewImport(set, opts.Strategy)
+	}
+	return applyImport(set, opts.Strategy)
+}
+
+// importNeedsKey reports whether importing set needs the encryption key: to
+// encrypt plaintext passwords, or to find out whether unmarked passwords were
+// encrypted by an older version of sm. All passwords of a bundle are plaintext.
+func importNeedsKey(set importSet, encrypt bool) bool {
+	for _, conn := range set.Connections {
+		switch {
+		case conn.Password == "" || utils.IsSecretRef(conn.Password):
+		case !set.PlaintextPasswords && utils.IsEncrypted(conn.Password):
+		case encrypt:
+			return true
+		case !set.PlaintextPasswords && utils.MaybeUnmarkedCiphertext(conn.Password):
+			return true
 		}
+	}
+	return false
+}
+
+// previewImport prints what importing set would do without saving anything.
+func previewImport(set importSet, strategy string) error {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return fmt.Errorf("failed to get config: %w", err)
+	}
+	conns, keys, err := mergeImport(cfg, set, strategy, false)
+	if err != nil {
+		return err
+	}
+	settings, err := mergeSettings(cfg, set, false)
+	if err != nil {
+		return err
+	}
+	printMergePlan("Connections", conns)
+	printMergePlan("Keys", keys)
+	printSettingsPlan(set, settings)
+	printCommandSecrets(set, cfg.Settings)
+	fmt.Printf("\nDry run, nothing was saved. Connections: %s\n", mergeSummary(conns))
+	if len(keys) > 0 {
+		fmt.Printf("Keys: %s\n", mergeSummary(keys))
+	}
+	return nil
+}
 
-		if err := config.SaveConfig(currentCfg); err != nil {
-			return fmt.Errorf("failed to save updated config: %w", err)
+// applyImport merges set into the configuration and reports what was done.
+// The merge is worked out again under the config lock, so it reflects any
+// change made since a preview.
+func applyImport(set importSet, strategy string) error {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return fmt.Errorf("failed to get config: %w", err)
+	}
+	if importNeedsKey(set, cfg.Settings.EncryptPasswords) {
+		// Unlock the key before taking the config lock, as it may ask for the master password
+		if _, err := utils.EncryptionKey(); err != nil {
+			return fmt.Errorf("failed to get the encryption key: %w", err)
 		}
+	}
 
-		fmt.Printf("Import complete. Added: %d, Skipped: %d\n", importedCount, skippedCount)
+	var conns, keys []mergeAction
+	var settings []fieldChange
+	current := cfg.Settings
+	err = config.Update(func(cfg *models.AppConfig) error {
+		var err error
+		current = cfg.Settings
+		if conns, keys, err = mergeImport(cfg, set, strategy, true); err != nil {
+			return err
+		}
+		// Imported passwords are saved under the current settings
+		settings, err = mergeSettings(cfg, set, true)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	printMergePlan("Connections", conns)
+	printMergePlan("Keys", keys)
+	printSettingsPlan(set, settings)
+	printCommandSecrets(set, current)
+	fmt.Printf("\nImport complete. Connections: %s\n", mergeSummary(conns))
+	if len(keys) > 0 {
+		fmt.Printf("Keys: %s\n", mergeSummary(keys))
+	}
+	return nil
+}
+
+// importSSHConfig previews the hosts of an OpenSSH config file and, once
+// confirmed, merges them into the configuration.
+func importSSHConfig(inputFile string, opts importOptions) error {
+	sshConfig, err := config.ParseSSHConfig(inputFile)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return fmt.Errorf("failed to get current config: %w", err)
+	}
+
+	conns, warnings := config.SSHConfigConnections(sshConfig, cfg)
+	warnings = append(sshConfig.Warnings, warnings...)
+	if len(conns) == 0 {
+		fmt.Printf("No hosts found in %s\n", inputFile)
 		return nil
-	},
+	}
+
+	set := importSet{Connections: conns}
+	actions, _, err := mergeImport(cfg, set, opts.Strategy, false)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tHOST\tUSER\tPORT\tKEY\tJUMP\tFORWARDS\tSTATUS")
+	for i, conn := range conns {
+		status := actions[i].Result
+		switch {
+		case status == mergeRename:
+			status = "rename to " + actions[i].Target
+		case actions[i].Reason != "":
+			status = fmt.Sprintf("%s (%s)", status, actions[i].Reason)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t%d\t%s\n",
+			conn.Name, conn.Host, conn.User, conn.Port, conn.KeyPath,
+			strings.Join(conn.JumpHosts, ","), len(conn.Forwards), status)
+	}
+	w.Flush()
+
+	var changed []mergeAction
+	for _, action := range actions {
+		if len(action.Changes) > 0 {
+			changed = append(changed, action)
+		}
+	}
+	if len(changed) > 0 {
+		fmt.Println()
+		printMergePlan("Differences from existing connections", changed)
+	}
+	if len(warnings) > 0 {
+		fmt.Println("\nWarnings:")
+		for _, warning := range warnings {
+			fmt.Println("  " + warning)
+		}
+	}
+
+	if opts.DryRun {
+		fmt.Printf("\nDry run, nothing was saved. %s\n", mergeSummary(actions))
+		return nil
+	}
+	if !changesAnything(actions) {
+		fmt.Println("\nNothing to import.")
+		return nil
+	}
+
+	if !opts.Yes {
+		counts := countResults(actions)
+		prompt := promptui.Prompt{
+			Label:     fmt.Sprintf("Import %d connection(s)", counts[mergeAdd]+counts[mergeOverwrite]+counts[mergeRename]),
+			IsConfirm: true,
+		}
+		if _, err := prompt.Run(); err != nil {
+			if errors.Is(err, promptui.ErrAbort) {
+				fmt.Println("Import cancelled.")
+				return nil
+			}
+			return fmt.Errorf("prompt failed: %w", err)
+		}
+	}
+
+	err = config.Update(func(cfg *models.AppConfig) error {
+		var err error
+		actions, _, err = mergeImport(cfg, set, opts.Strategy, true)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Import complete. %s\n", mergeSummary(actions))
+	return nil
 }
 
 func init() {
 	rootCmd.AddCommand(importCmd)
 
-	importCmd.Flags().StringP("input", "i", "", "Input file path for the backup (required)")
-	importCmd.MarkFlagRequired("input")
+	importCmd.Flags().StringP("input", "i", "", "Input file path for the backup")
+	importCmd.Flags().String("from", importFromYAML, "Source format (yaml, ssh-config)")
+	importCmd.Flags().BoolP("yes", "y", false, "Import without asking for confirmation")
+	importCmd.Flags().String("strategy", strategySkip, "What to do with names that already exist (skip, overwrite, rename, newest)")
+	importCmd.Flags().Bool("dry-run", false, "Show what would be imported without saving anything")
+	importCmd.Flags().Bool("allow-command-secrets", false, "Import secret references that run a command, such as ref:cmd:..., or a provider from settings.secret_providers")
+	importCmd.Flags().Bool("include-settings", false, "Replace your settings with those of the import, apart from the encryption key source")
+	importCmd.Flags().String("passphrase", "", "Secret reference to the passphrase of an encrypted bundle, such as ref:env:NAME (default: ask)")
 }
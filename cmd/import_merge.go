@@ -0,0 +1,595 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"sm/internal/models"
+	"sm/internal/ssh"
+	"sm/internal/utils"
+)
+
+// Strategies for imported names that already exist, accepted by --strategy.
+const (
+	strategySkip      = "skip"      // Keep the existing item
+	strategyOverwrite = "overwrite" // Replace the existing item
+	strategyRename    = "rename"    // Import under a new name, such as web-2
+	strategyNewest    = "newest"    // Keep whichever was used or created last
+)
+
+var importStrategies = []string{strategySkip, strategyOverwrite, strategyRename, strategyNewest}
+
+// Results of merging one imported item.
+const (
+	mergeAdd       = "add"
+	mergeUnchanged = "unchanged"
+	mergeSkip      = "skip"
+	mergeOverwrite = "overwrite"
+	mergeRename    = "rename"
+)
+
+// fieldChange is a difference between an existing item and an imported one.
+type fieldChange struct {
+	Field, Old, New string
+}
+
+// mergeAction describes what importing one connection or key does.
+type mergeAction struct {
+	Name    string // Name in the import
+	Target  string // Name it is saved under
+	Result  string // One of the merge* values
+	Reason  string // Why the existing item was kept
+	Changes []fieldChange
+}
+
+// importSet is what an import brings in.
+type importSet struct {
+	Connections []models.Connection
+	Keys        []models.SSHKey
+	// Groups are added if they do not exist yet; existing groups are kept
+	Groups map[string]models.Group
+	// PlaintextPasswords is set when passwords are known to be plaintext,
+	// as in export bundles, even if they look encrypted.
+	PlaintextPasswords bool
+	// AllowCommandSecrets lets connections with secret references that run
+	// a command, and secret providers, be imported (--allow-command-secrets).
+	AllowCommandSecrets bool
+	// Settings are those of the imported config, if it has any. They only
+	// replace the current settings with IncludeSettings (--include-settings).
+	Settings        *models.Settings
+	IncludeSettings bool
+}
+
+// newImportSet collects the connections, keys and settings of an imported
+// config, sorted by name. The map keys are the names.
+func newImportSet(cfg *models.AppConfig, plaintextPasswords bool) importSet {
+	settings := cfg.Settings
+	set := importSet{Groups: cfg.Groups, PlaintextPasswords: plaintextPasswords, Settings: &settings}
+	for name, conn := range cfg.Connections {
+		conn.Name = name
+		set.Connections = append(set.Connections, conn)
+	}
+	for name, key := range cfg.SSHKeys {
+		key.Name = name
+		set.Keys = append(set.Keys, key)
+	}
+	sort.Slice(set.Connections, func(i, j int) bool { return set.Connections[i].Name < set.Connections[j].Name })
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Name < set.Keys[j].Name })
+	return set
+}
+
+// validateStrategy checks a --strategy value.
+func validateStrategy(strategy string) error {
+	for _, s := range importStrategies {
+		if s == strategy {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid strategy: %s. Valid strategies are %s", strategy, strings.Join(importStrategies, ", "))
+}
+
+// mergeImport works out what importing set into cfg does under strategy and,
+// if apply is set, does it. Planning and applying share this code so that a
+// dry run shows exactly what an import would do.
+func mergeImport(cfg *models.AppConfig, set importSet, strategy string, apply bool) (conns, keys []mergeAction, err error) {
+	// Renamed items must not take the name of an existing item, nor of one
+	// that comes later in the import
+	taken := make(map[string]bool, len(cfg.Connections)+len(set.Connections))
+	for name := range cfg.Connections {
+		taken[name] = true
+	}
+	for _, imported := range set.Connections {
+		taken[imported.Name] = true
+	}
+	renamed := make(map[string]string)
+	targets := make(map[string]bool)
+
+	for _, imported := range set.Connections {
+		action := mergeAction{Name: imported.Name, Target: imported.Name, Result: mergeAdd}
+		existing, exists := cfg.Connections[imported.Name]
+		if exists {
+			action.Changes = diffConnections(existing, imported, set.PlaintextPasswords)
+			action.Result, action.Reason = resolveConflict(strategy, len(action.Changes) == 0, recency(existing), recency(imported))
+		}
+		if action.Result == mergeRename {
+			action.Target = freeName(imported.Name, taken)
+			renamed[imported.Name] = action.Target
+			taken[action.Target] = true
+		}
+		if err := claimTarget(targets, action); err != nil {
+			return nil, nil, err
+		}
+		conns = append(conns, action)
+	}
+
+	takenKeys := make(map[string]bool, len(cfg.SSHKeys)+len(set.Keys))
+	for name := range cfg.SSHKeys {
+		takenKeys[name] = true
+	}
+	for _, imported := range set.Keys {
+		takenKeys[imported.Name] = true
+	}
+	keyTargets := make(map[string]bool)
+	for _, imported := range set.Keys {
+		action := mergeAction{Name: imported.Name, Target: imported.Name, Result: mergeAdd}
+		if existing, exists := cfg.SSHKeys[imported.Name]; exists {
+			action.Changes = diffKeys(existing, imported)
+			// Keys have no dates, so with newest the existing key is kept
+			keyStrategy := strategy
+			if keyStrategy == strategyNewest {
+				keyStrategy = strategySkip
+			}
+			action.Result, action.Reason = resolveConflict(keyStrategy, len(action.Changes) == 0, time.Time{}, time.Time{})
+		}
+		if action.Result == mergeRename {
+			action.Target = freeName(imported.Name, takenKeys)
+			takenKeys[action.Target] = true
+		}
+		if err := claimTarget(keyTargets, action); err != nil {
+			return nil, nil, err
+		}
+		keys = append(keys, action)
+	}
+
+	if !apply {
+		return conns, keys, nil
+	}
+
+	if !set.AllowCommandSecrets {
+		var refused []string
+		for i, action := range conns {
+			if changesConfig(action) && len(commandSecrets(set.Connections[i])) > 0 {
+				refused = append(refused, action.Name)
+			}
+		}
+		if len(refused) > 0 {
+			return nil, nil, fmt.Errorf("refusing to import %s: their secret references run commands on the next connect. See them with --dry-run, and use --allow-command-secrets if you trust them", strings.Join(refused, ", "))
+		}
+	}
+
+	for i, action := range conns {
+		if !changesConfig(action) {
+			continue
+		}
+		conn := set.Connections[i]
+		conn.Name = action.Target
+		// Jump hosts from the same import follow them when they are renamed
+		conn.JumpHosts = append([]string(nil), conn.JumpHosts...)
+		for j, jump := range conn.JumpHosts {
+			if target, ok := renamed[jump]; ok {
+				conn.JumpHosts[j] = target
+			}
+		}
+		conn.Password, err = sealImportedPassword(conn.Password, set.PlaintextPasswords, cfg.Settings.EncryptPasswords)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to save password for %s: %w", conn.Name, err)
+		}
+
+		if action.Result == mergeOverwrite {
+			// Keep the identity of the connection that is replaced
+			existing := cfg.Connections[action.Target]
+			conn.ID = existing.ID
+			conn.CreatedAt = existing.CreatedAt
+			if existing.LastUsed.After(conn.LastUsed) {
+				conn.LastUsed = existing.LastUsed
+			}
+			if existing.UseCount > conn.UseCount {
+				conn.UseCount = existing.UseCount
+			}
+		} else {
+			conn.ID = cfg.NextID
+			cfg.NextID++
+			if conn.CreatedAt.IsZero() {
+				conn.CreatedAt = time.Now()
+			}
+		}
+		cfg.Connections[conn.Name] = conn
+	}
+
+	if cfg.SSHKeys == nil {
+		cfg.SSHKeys = make(map[string]models.SSHKey)
+	}
+	for i, action := range keys {
+		if !changesConfig(action) {
+			continue
+		}
+		key := set.Keys[i]
+		key.Name = action.Target
+		cfg.SSHKeys[key.Name] = key
+	}
+
+	for path, group := range set.Groups {
+		if _, exists := cfg.Groups[path]; exists {
+			continue
+		}
+		if cfg.Groups == nil {
+			cfg.Groups = make(map[string]models.Group)
+		}
+		cfg.Groups[path] = group
+	}
+
+	// Jump hosts may be missing from a bundle or form a cycle with saved
+	// connections, which would otherwise only show on the next connect
+	for _, action := range conns {
+		if !changesConfig(action) {
+			continue
+		}
+		conn := cfg.Connections[action.Target]
+		if _, err := ssh.JumpChain(cfg, &conn); err != nil {
+			return nil, nil, fmt.Errorf("cannot import %s: %w", action.Name, err)
+		}
+	}
+	return conns, keys, nil
+}
+
+// mergeSettings lists the settings in which set differs from cfg and, if
+// apply is set and the settings are included, replaces those of cfg. The
+// encryption key source belongs to this machine and is always kept. New or
+// changed secret providers run commands, so they are refused unless command
+// secrets are allowed.
+func mergeSettings(cfg *models.AppConfig, set importSet, apply bool) ([]fieldChange, error) {
+	if set.Settings == nil {
+		return nil, nil
+	}
+	changes := diffSettings(cfg.Settings, *set.Settings)
+	if !apply || !set.IncludeSettings || len(changes) == 0 {
+		return changes, nil
+	}
+
+	if schemes := changedProviders(cfg.Settings, *set.Settings); len(schemes) > 0 && !set.AllowCommandSecrets {
+		return nil, fmt.Errorf("refusing to import settings.secret_providers %s: they run commands on the next connect. See them with --dry-run, and use --allow-command-secrets if you trust them", strings.Join(schemes, ", "))
+	}
+	settings := *set.Settings
+	settings.Encryption = cfg.Settings.Encryption
+	cfg.Settings = settings
+	return changes, nil
+}
+
+// diffSettings lists the settings in which imported differs from existing,
+// apart from the encryption key source.
+func diffSettings(existing, imported models.Settings) []fieldChange {
+	var changes []fieldChange
+	diff := func(field, old, new string) {
+		if old != new {
+			changes = append(changes, fieldChange{field, old, new})
+		}
+	}
+	diff("encrypt_passwords", strconv.FormatBool(existing.EncryptPasswords), strconv.FormatBool(imported.EncryptPasswords))
+	diff("log_connections", strconv.FormatBool(existing.LogConnections), strconv.FormatBool(imported.LogConnections))
+	diff("log_path", existing.LogPath, imported.LogPath)
+	diff("editor", existing.Editor, imported.Editor)
+	diff("backups", strconv.Itoa(existing.Backups), strconv.Itoa(imported.Backups))
+	diff("secret_providers", describeExtra(existing.SecretProviders), describeExtra(imported.SecretProviders))
+	return changes
+}
+
+// changedProviders returns the sorted schemes of the secret providers in
+// imported that are not in existing, or run a different command there.
+func changedProviders(existing, imported models.Settings) []string {
+	var schemes []string
+	for scheme, command := range imported.SecretProviders {
+		if current, ok := existing.SecretProviders[scheme]; !ok || current != command {
+			schemes = append(schemes, scheme)
+		}
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// sealImportedPassword prepares an imported password for the configuration.
+// Passwords marked as encrypted are kept unless plaintext is set. Unmarked
+// passwords that an older version of sm encrypted with this machine's key
+// are decrypted first; any other unmarked value is a plaintext password.
+func sealImportedPassword(value string, plaintext, encrypt bool) (string, error) {
+	if !plaintext && utils.IsEncrypted(value) {
+		return value, nil
+	}
+	if !plaintext && utils.MaybeUnmarkedCiphertext(value) {
+		decrypted, err := utils.DecryptUnmarked(value)
+		if err == nil {
+			value = decrypted
+		} else if !errors.Is(err, utils.ErrUndecryptable) {
+			return "", err
+		}
+	}
+	return utils.SealPassword(value, encrypt)
+}
+
+// claimTarget records the name that action saves an item under, and fails if
+// another item of the same import is already saved under it.
+func claimTarget(targets map[string]bool, action mergeAction) error {
+	if !changesConfig(action) {
+		return nil
+	}
+	if targets[action.Target] {
+		return fmt.Errorf("cannot import %s: another imported item is already saved as %s", action.Name, action.Target)
+	}
+	targets[action.Target] = true
+	return nil
+}
+
+// resolveConflict decides what happens to an imported item whose name exists.
+func resolveConflict(strategy string, identical bool, existing, imported time.Time) (result, reason string) {
+	if identical {
+		return mergeUnchanged, ""
+	}
+	switch strategy {
+	case strategyOverwrite:
+		return mergeOverwrite, ""
+	case strategyRename:
+		return mergeRename, ""
+	case strategyNewest:
+		if imported.After(existing) {
+			return mergeOverwrite, "imported one is newer"
+		}
+		return mergeSkip, "existing one is newer"
+	default:
+		return mergeSkip, "already exists"
+	}
+}
+
+// recency is when a connection was last used or, failing that, created.
+func recency(conn models.Connection) time.Time {
+	if conn.LastUsed.After(conn.CreatedAt) {
+		return conn.LastUsed
+	}
+	return conn.CreatedAt
+}
+
+// freeName returns name with the first free numeric suffix, such as web-2.
+func freeName(name string, taken map[string]bool) string {
+	for i := 2; ; i++ {
+		candidate := name + "-" + strconv.Itoa(i)
+		if !taken[candidate] {
+			return candidate
+		}
+	}
+}
+
+// diffConnections lists the fields in which imported differs from existing.
+// Identity and usage fields (ID, dates) are not compared, and passwords are
+// compared by their plaintext where possible but never shown.
+func diffConnections(existing, imported models.Connection, plaintextPasswords bool) []fieldChange {
+	var changes []fieldChange
+	diff := func(field, old, new string) {
+		if old != new {
+			changes = append(changes, fieldChange{field, old, new})
+		}
+	}
+	diff("host", existing.Host, imported.Host)
+	diff("port", strconv.Itoa(existing.Port), strconv.Itoa(imported.Port))
+	diff("user", existing.User, imported.User)
+	diff("key_path", existing.KeyPath, imported.KeyPath)
+	if !samePassword(existing.Password, imported.Password, plaintextPasswords) {
+		changes = append(changes, fieldChange{"password", describeSecret(existing.Password), describeSecret(imported.Password)})
+	}
+	diff("key_passphrase", existing.KeyPassphrase, imported.KeyPassphrase)
+	diff("description", existing.Description, imported.Description)
+	diff("group", existing.Group, imported.Group)
+	diff("tags", strings.Join(existing.Tags, ","), strings.Join(imported.Tags, ","))
+	diff("strict_host_key_checking", existing.StrictHostKeyChecking, imported.StrictHostKeyChecking)
+	diff("forward_agent", strconv.FormatBool(existing.ForwardAgent), strconv.FormatBool(imported.ForwardAgent))
+	diff("jump_hosts", strings.Join(existing.JumpHosts, ","), strings.Join(imported.JumpHosts, ","))
+	diff("forwards", describeForwards(existing.Forwards), describeForwards(imported.Forwards))
+	diff("extra", describeExtra(existing.Extra), describeExtra(imported.Extra))
+	return changes
+}
+
+// diffKeys lists the fields in which an imported key differs from existing.
+func diffKeys(existing, imported models.SSHKey) []fieldChange {
+	var changes []fieldChange
+	if existing.Path != imported.Path {
+		changes = append(changes, fieldChange{"path", existing.Path, imported.Path})
+	}
+	if existing.Type != imported.Type {
+		changes = append(changes, fieldChange{"type", existing.Type, imported.Type})
+	}
+	return changes
+}
+
+// samePassword reports whether two saved passwords are the same secret. The
+// same password encrypted twice gives different ciphertexts, so encrypted
+// passwords are decrypted to compare them.
+func samePassword(existing, imported string, importedPlaintext bool) bool {
+	if existing == imported {
+		return true
+	}
+	plain := func(value string, isPlaintext bool) (string, bool) {
+		if isPlaintext || !utils.IsEncrypted(value) {
+			return value, true
+		}
+		p, err := utils.Decrypt(value)
+		return p, err == nil
+	}
+	a, okA := plain(existing, false)
+	b, okB := plain(imported, importedPlaintext)
+	return okA && okB && a == b
+}
+
+// describeSecret shows what kind of password a connection has without
+// revealing it.
+func describeSecret(value string) string {
+	switch {
+	case value == "":
+		return ""
+	case utils.IsSecretRef(value):
+		return value
+	default:
+		return "(hidden)"
+	}
+}
+
+func describeForwards(forwards []models.Forward) string {
+	parts := make([]string, len(forwards))
+	for i, f := range forwards {
+		parts[i] = fmt.Sprintf("%s=%s:%s", f.Name, f.Type, f.Spec)
+	}
+	return strings.Join(parts, ",")
+}
+
+func describeExtra(extra map[string]string) string {
+	parts := make([]string, 0, len(extra))
+	for k, v := range extra {
+		parts = append(parts, k+"="+v)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+// printMergePlan shows what an import does, one line per item with the
+// changed fields of the items that differ.
+func printMergePlan(title string, actions []mergeAction) {
+	if len(actions) == 0 {
+		return
+	}
+	symbols := map[string]string{
+		mergeAdd:       "+",
+		mergeUnchanged: "=",
+		mergeSkip:      "-",
+		mergeOverwrite: "~",
+		mergeRename:    "+",
+	}
+	names := make([]string, len(actions))
+	width := 0
+	for i, action := range actions {
+		names[i] = action.Name
+		if action.Result == mergeRename {
+			names[i] = fmt.Sprintf("%s -> %s", action.Name, action.Target)
+		}
+		if len(names[i]) > width {
+			width = len(names[i])
+		}
+	}
+
+	fmt.Printf("%s:\n", title)
+	for i, action := range actions {
+		result := action.Result
+		if action.Reason != "" {
+			result = fmt.Sprintf("%s (%s)", result, action.Reason)
+		}
+		fmt.Printf("  %s %-*s   %s\n", symbols[action.Result], width, names[i], result)
+		for _, c := range action.Changes {
+			fmt.Printf("      %s: %s -> %s\n", c.Field, quoteEmpty(c.Old), quoteEmpty(c.New))
+		}
+	}
+}
+
+// quoteEmpty makes empty values visible in a diff.
+func quoteEmpty(s string) string {
+	if s == "" {
+		return `""`
+	}
+	return s
+}
+
+// countResults counts the actions by result.
+func countResults(actions []mergeAction) map[string]int {
+	counts := make(map[string]int)
+	for _, action := range actions {
+		counts[action.Result]++
+	}
+	return counts
+}
+
+// mergeSummary describes the outcome of an import in one line.
+func mergeSummary(actions []mergeAction) string {
+	counts := countResults(actions)
+	return fmt.Sprintf("Added: %d, Overwritten: %d, Renamed: %d, Unchanged: %d, Skipped: %d",
+		counts[mergeAdd], counts[mergeOverwrite], counts[mergeRename], counts[mergeUnchanged], counts[mergeSkip])
+}
+
+// changesConfig reports whether applying action changes the config.
+func changesConfig(action mergeAction) bool {
+	return action.Result == mergeAdd || action.Result == mergeOverwrite || action.Result == mergeRename
+}
+
+// changesAnything reports whether applying actions would change the config.
+func changesAnything(actions ...[]mergeAction) bool {
+	for _, list := range actions {
+		for _, action := range list {
+			if changesConfig(action) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// commandSecrets describes the secret references of conn that run a command
+// when they are resolved, such as ref:cmd:... passwords.
+func commandSecrets(conn models.Connection) []string {
+	var refs []string
+	if utils.IsSecretRef(conn.Password) && utils.RunsCommand(conn.Password) {
+		refs = append(refs, "password "+conn.Password)
+	}
+	if conn.KeyPassphrase != "" && utils.RunsCommand(conn.KeyPassphrase) {
+		refs = append(refs, "key passphrase "+conn.KeyPassphrase)
+	}
+	return refs
+}
+
+// printSettingsPlan shows the settings in which the import differs from
+// current, with a warning if they are left out.
+func printSettingsPlan(set importSet, changes []fieldChange) {
+	if len(changes) == 0 {
+		return
+	}
+	if set.IncludeSettings {
+		fmt.Println("Settings:")
+	} else {
+		fmt.Println("\nWarning: these settings differ from yours and are not imported without --include-settings:")
+	}
+	for _, c := range changes {
+		fmt.Printf("  %s: %s -> %s\n", c.Field, quoteEmpty(c.Old), quoteEmpty(c.New))
+	}
+}
+
+// printCommandSecrets lists the secret references of the imported
+// connections that run a command, and the new or changed secret providers of
+// included settings, which are only imported with --allow-command-secrets.
+func printCommandSecrets(set importSet, current models.Settings) {
+	var lines []string
+	for _, conn := range set.Connections {
+		for _, ref := range commandSecrets(conn) {
+			lines = append(lines, fmt.Sprintf("  %s: %s", conn.Name, ref))
+		}
+	}
+	if set.IncludeSettings && set.Settings != nil {
+		for _, scheme := range changedProviders(current, *set.Settings) {
+			lines = append(lines, fmt.Sprintf("  settings.secret_providers.%s: %s", scheme, set.Settings.SecretProviders[scheme]))
+		}
+	}
+	if len(lines) == 0 {
+		return
+	}
+	if set.AllowCommandSecrets {
+		fmt.Println("\nSecret references that run commands, allowed by --allow-command-secrets:")
+	} else {
+		fmt.Println("\nSecret references that run commands, which are refused without --allow-command-secrets:")
+	}
+	fmt.Println(strings.Join(lines, "\n"))
+}
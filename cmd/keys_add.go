@@ -28,25 +28,22 @@ var keysAddCmd = &cobra.Command{
 			return fmt.Errorf("key file does not exist at path: %s", path)
 		}
 
-		cfg, err := config.GetConfig()
+		err := config.Update(func(cfg *models.AppConfig) error {
+			if _, exists := cfg.SSHKeys[name]; exists {
+				return errors.New("SSH key with this name already exists")
+			}
+
+			newKey := models.SSHKey{
+				Name: name,
+				Path: path,
+				Type: "unknown", // We don't parse key type here, user can edit later if needed
+			}
+
+			cfg.SSHKeys[name] = newKey
+			return nil
+		})
 		if err != nil {
-			return fmt.Errorf("failed to get config: %w", err)
-		}
-
-		if _, exists := cfg.SSHKeys[name]; exists {
-			return errors.New("SSH key with this name already exists")
-		}
-
-		newKey := models.SSHKey{
-			Name: name,
-			Path: path,
-			Type: "unknown", // We don't parse key type here, user can edit later if needed
-		}
-
-		cfg.SSHKeys[name] = newKey
-
-		if err := config.SaveConfig(cfg); err != nil {
-			return fmt.Errorf("failed to save config: %w", err)
+			return err
 		}
 
 		fmt.Printf("Successfully added SSH key '%s'\n", name)
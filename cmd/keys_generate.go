@@ -84,10 +84,12 @@ var keysGenerateCmd = &cobra.Command{
 			Type: keyType,
 		}
 
-		cfg.SSHKeys[name] = newKey
-
-		if err := config.SaveConfig(cfg); err != nil {
-			return fmt.Errorf("failed to save config: %w", err)
+		err = config.Update(func(cfg *models.AppConfig) error {
+			cfg.SSHKeys[name] = newKey
+			return nil
+		})
+		if err != nil {
+			return err
 		}
 
 		fmt.Printf("Successfully generated %s key '%s' at %s\n", keyType, name, privateKeyPath)
@@ -2,20 +2,45 @@ package cmd
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"sort"
+	"strings"
 	"text/tabwriter"
 	"time"
 
 	"github.com/spf13/cobra"
 	"sm/internal/config"
+	"sm/internal/models"
+	"sm/internal/query"
 )
 
+// listSorts are the orders accepted by 'sm list --sort'.
+var listSorts = []string{"name", "id", "last-used", "created"}
+
 // listCmd represents the list command
 var listCmd = &cobra.Command{
-	Use:   "list",
+	Use:   "list [filter...]",
 	Short: "List all saved SSH connections",
-	Long:  `List all SSH connections saved in the configuration file.`,
+	Long: `List all SSH connections saved in the configuration file.
+
+The connections can be narrowed down with --tag, --host-glob and --user, and
+with a filter expression made of field:pattern terms combined with AND, OR,
+NOT and parentheses. Patterns are case-insensitive globs, and a pattern
+without a field matches the name, the host or a tag. The fields are name,
+host, user, tag, port, id, desc and group; group:prod also matches the
+subgroups of prod. Values inherited from groups are taken into account.
+
+With --tree, the connections are shown under their groups.
+
+Examples:
+  sm list --tag prod --user root
+  sm list --host-glob '10.0.*'
+  sm list 'tag:prod AND user:root'
+  sm list 'host:*.internal AND NOT (tag:old OR tag:test)'
+  sm list --tree group:prod`,
+	SilenceUsage: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cfg, err := config.GetConfig()
 		if err != nil {
@@ -23,40 +48,126 @@ var listCmd = &cobra.Command{
 		}
 
 		format, _ := cmd.Flags().GetString("format")
+		sortBy, _ := cmd.Flags().GetString("sort")
+		tags, _ := cmd.Flags().GetStringSlice("tag")
+		hostGlob, _ := cmd.Flags().GetString("host-glob")
+		user, _ := cmd.Flags().GetString("user")
+		tree, _ := cmd.Flags().GetBool("tree")
+
+		if format != "table" && format != "json" {
+			return fmt.Errorf("invalid format: %s. avalid formats are 'table' and 'json'", format)
+		}
+		if tree && format != "table" {
+			return errors.New("--tree can only be used with the table format")
+		}
+		// JSON is an object keyed by name, as in the configuration file, so
+		// its connections are always in name order
+		if format == "json" && sortBy != "name" {
+			return errors.New("--sort can only be used with the table format; json output is in name order")
+		}
+
+		var filter query.Expr
+		if len(args) > 0 {
+			filter, err = query.Parse(strings.Join(args, " "))
+			if err != nil {
+				return err
+			}
+		}
 
 		if len(cfg.Connections) == 0 {
 			fmt.Println("No connections found. Use 'ssh-manager add' to create one.")
 			return nil
 		}
 
+		var conns []models.Connection
+		for _, conn := range cfg.Connections {
+			conn = cfg.Resolve(conn).Connection
+			switch {
+			case !hasAllTags(conn, tags):
+			case hostGlob != "" && !query.Glob(hostGlob, conn.Host):
+			case user != "" && !query.Glob(user, conn.User):
+			case filter != nil && !filter.Match(conn):
+			default:
+				conns = append(conns, conn)
+			}
+		}
+		if err := sortConnections(conns, sortBy); err != nil {
+			return err
+		}
+
 		switch format {
 		case "json":
-			out, err := json.MarshalIndent(cfg.Connections, "", "  ")
+			byName := make(map[string]models.Connection, len(conns))
+			for _, conn := range conns {
+				byName[conn.Name] = conn
+			}
+			out, err := json.MarshalIndent(byName, "", "  ")
 			if err != nil {
 				return fmt.Errorf("failed to format to json: %w", err)
 			}
 			fmt.Println(string(out))
 		case "table":
+			if len(conns) == 0 {
+				fmt.Println("No connections match the filter.")
+				return nil
+			}
 			w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
-			fmt.Fprintln(w, "ID\tNAME\tUSER\tHOST\tPORT\tKEY PATH\tCREATED AT")
-			for _, conn := range cfg.Connections {
+			if tree {
+				filtered := len(args) > 0 || len(tags) > 0 || hostGlob != "" || user != ""
+				printTree(w, buildTree(cfg, conns, !filtered))
+				w.Flush()
+				return nil
+			}
+			fmt.Fprintln(w, "ID\tNAME\tUSER\tHOST\tPORT\tTAGS\tKEY PATH\tCREATED AT")
+			for _, conn := range conns {
 				createdAtStr := "n/a"
-				if conn.CreatedAt != 0 {
-					createdAtStr = time.Unix(conn.CreatedAt, 0).Format(time.RFC3339)
+				if !conn.CreatedAt.IsZero() {
+					createdAtStr = conn.CreatedAt.Format(time.RFC3339)
 				}
-				fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%s\t%s\n", conn.ID, conn.Name, conn.User, conn.Host, conn.Port, conn.KeyPath, createdAtStr)
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n", conn.ID, conn.Name, conn.User, conn.Host, conn.Port, strings.Join(conn.Tags, ","), conn.KeyPath, createdAtStr)
 			}
 			w.Flush()
-		default:
-			return fmt.Errorf("invalid format: %s. avalid formats are 'table' and 'json'", format)
 		}
 
 		return nil
 	},
 }
 
+// sortConnections sorts conns by one of listSorts. The most recently used or
+// created connections come first, and ties are broken by name.
+func sortConnections(conns []models.Connection, by string) error {
+	var less func(a, b models.Connection) bool
+	switch by {
+	case "name":
+		less = func(a, b models.Connection) bool { return false }
+	case "id":
+		less = func(a, b models.Connection) bool { return a.ID < b.ID }
+	case "last-used":
+		less = func(a, b models.Connection) bool { return a.LastUsed.After(b.LastUsed) }
+	case "created":
+		less = func(a, b models.Connection) bool { return a.CreatedAt.After(b.CreatedAt) }
+	default:
+		return fmt.Errorf("invalid sort order: %s. Valid orders are %s", by, strings.Join(listSorts, ", "))
+	}
+	sort.Slice(conns, func(i, j int) bool {
+		if less(conns[i], conns[j]) {
+			return true
+		}
+		if less(conns[j], conns[i]) {
+			return false
+		}
+		return conns[i].Name < conns[j].Name
+	})
+	return nil
+}
+
 func init() {
 	rootCmd.AddCommand(listCmd)
 
 	listCmd.Flags().StringP("format", "f", "table", "Output format (table, json)")
-}
\ No newline at end of file
+	listCmd.Flags().StringP("sort", "s", "name", "Sort order of the table (name, id, last-used, created); last-used and created list the newest first")
+	listCmd.Flags().StringSlice("tag", nil, "Only list connections with these tags (repeatable or comma-separated)")
+	listCmd.Flags().String("host-glob", "", "Only list connections whose host matches this glob, such as '*.example.com'")
+	listCmd.Flags().String("user", "", "Only list connections with this user (globs are allowed)")
+	listCmd.Flags().Bool("tree", false, "Show the connections under their groups")
+}
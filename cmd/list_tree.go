@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"sm/internal/models"
+)
+
+// groupNode is a group in the tree printed by 'sm list --tree'.
+type groupNode struct {
+	name     string
+	settings *models.Group // Nil if no settings are saved for the group
+	children map[string]*groupNode
+	conns    []models.Connection
+}
+
+// child returns the subgroup of n called name, adding it if needed.
+func (n *groupNode) child(name string) *groupNode {
+	if n.children == nil {
+		n.children = make(map[string]*groupNode)
+	}
+	c, ok := n.children[name]
+	if !ok {
+		c = &groupNode{name: name}
+		n.children[name] = c
+	}
+	return c
+}
+
+// node returns the node of the group path below n, adding it if needed.
+func (n *groupNode) node(path string) *groupNode {
+	if path == "" {
+		return n
+	}
+	for _, name := range strings.Split(path, "/") {
+		n = n.child(name)
+	}
+	return n
+}
+
+// buildTree arranges conns, which keep their order, under their groups. The
+// groups of cfg without any of conns are only included with allGroups.
+func buildTree(cfg *models.AppConfig, conns []models.Connection, allGroups bool) *groupNode {
+	root := &groupNode{}
+	for _, conn := range conns {
+		n := root.node(conn.Group)
+		n.conns = append(n.conns, conn)
+	}
+	for path, group := range cfg.Groups {
+		if !allGroups && !root.has(path) {
+			continue
+		}
+		group := group
+		root.node(path).settings = &group
+	}
+	return root
+}
+
+// has reports whether the group path is already in the tree below n.
+func (n *groupNode) has(path string) bool {
+	for _, name := range strings.Split(path, "/") {
+		c, ok := n.children[name]
+		if !ok {
+			return false
+		}
+		n = c
+	}
+	return true
+}
+
+// printTree prints the groups and connections below root, subgroups first,
+// as tab-separated lines for a tabwriter.
+func printTree(w io.Writer, root *groupNode) {
+	printNode(w, root, "", true)
+}
+
+func printNode(w io.Writer, n *groupNode, prefix string, top bool) {
+	names := make([]string, 0, len(n.children))
+	for name := range n.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	count := len(names) + len(n.conns)
+	branch := func(i int) (string, string) {
+		switch {
+		case top:
+			return "", ""
+		case i == count-1:
+			return "└── ", "    "
+		default:
+			return "├── ", "│   "
+		}
+	}
+
+	for i, name := range names {
+		c := n.children[name]
+		first, rest := branch(i)
+		fmt.Fprintf(w, "%s%s/\t%s\n", prefix+first, name, describeGroup(c.settings))
+		printNode(w, c, prefix+rest, false)
+	}
+	for i, conn := range n.conns {
+		first, _ := branch(len(names) + i)
+		fmt.Fprintf(w, "%s%s\t%s@%s:%d\n", prefix+first, conn.Name, conn.User, conn.Host, conn.Port)
+	}
+}
+
+// describeGroup lists the settings of a group, such as "user=deploy port=2222".
+func describeGroup(g *models.Group) string {
+	if g == nil {
+		return ""
+	}
+	var parts []string
+	if g.User != "" {
+		parts = append(parts, "user="+g.User)
+	}
+	if g.Port != 0 {
+		parts = append(parts, fmt.Sprintf("port=%d", g.Port))
+	}
+	if g.KeyPath != "" {
+		parts = append(parts, "key="+g.KeyPath)
+	}
+	if len(g.JumpHosts) > 0 {
+		parts = append(parts, "jump="+strings.Join(g.JumpHosts, ","))
+	}
+	if len(g.Tags) > 0 {
+		parts = append(parts, "tags="+strings.Join(g.Tags, ","))
+	}
+	return strings.Join(parts, " ")
+}
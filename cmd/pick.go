@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
+	"sm/internal/config"
+	"sm/internal/models"
+	"sm/internal/ssh"
+	"sm/internal/ui"
+)
+
+// pickCmd represents the pick command
+var pickCmd = &cobra.Command{
+	Use:   "pick [query]",
+	Short: "Choose a connection with a fuzzy finder and connect to it",
+	Long: `Opens a full-screen fuzzy finder over the saved connections and connects to the one
+chosen with Enter. The query matches the name, host, user, tags and description, and
+every word of it must match. Connections you use often and recently are listed first.
+
+Running sm without arguments in a terminal does the same.
+
+Keys: type to filter, Up/Down or Ctrl+P/Ctrl+N to move, Enter to connect, Esc to cancel.`,
+	Example: `  sm pick
+  sm pick prod web`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return pickAndConnect(strings.Join(args, " "))
+	},
+}
+
+// pickAndConnect lets the user choose a connection, starting with query, and
+// connects to it.
+func pickAndConnect(query string) error {
+	if !isInteractive() {
+		return fmt.Errorf("the picker needs a terminal. Use 'sm connect <name_or_id>' instead")
+	}
+
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return fmt.Errorf("failed to get config: %w", err)
+	}
+	if len(cfg.Connections) == 0 {
+		fmt.Println("No connections saved yet. Add one with 'sm add <name>'.")
+		return nil
+	}
+
+	conns := make([]models.Connection, 0, len(cfg.Connections))
+	for name, conn := range cfg.Connections {
+		conn.Name = name
+		conns = append(conns, cfg.Resolve(conn).Connection)
+	}
+	conn, ok, err := ui.Pick(conns, query)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+
+	recordUse(conn.Name)
+	fmt.Printf("Connecting to %s (%s@%s)...\n", conn.Name, conn.User, conn.Host)
+	if err := ssh.Connect(cfg, &conn); err != nil {
+		return fmt.Errorf("ssh connection failed: %w", err)
+	}
+	fmt.Println("Connection closed.")
+	return nil
+}
+
+// isInteractive reports whether sm is attached to a terminal, so that
+// full-screen views can be shown.
+func isInteractive() bool {
+	return terminal.IsTerminal(int(os.Stdin.Fd())) && terminal.IsTerminal(int(os.Stdout.Fd()))
+}
+
+func init() {
+	rootCmd.AddCommand(pickCmd)
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pkg/sftp"
+	"github.com/spf13/cobra"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/terminal"
+	"sm/internal/config"
+	"sm/internal/ssh"
+)
+
+// putCmd represents the put command
+var putCmd = &cobra.Command{
+	Use:   "put <name_or_id> <local>... <remote>",
+	Short: "Upload files to a saved SSH server",
+	Long: `Copies local files to the specified server over SFTP. Local paths may be glob
+patterns. When several files are given, the remote destination must be an existing directory.`,
+	Example: `  sm put web ./site.tar.gz /tmp/
+  sm put web -r -p ./public /var/www/
+  sm put web '*.log' logs/
+  sm put web --resume big.iso ~/big.iso`,
+	Args:         cobra.MinimumNArgs(3),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts := transferOptions(cmd)
+
+		return withSFTP(args[0], func(sc *sftp.Client) error {
+			return ssh.Upload(sc, args[1:len(args)-1], args[len(args)-1], opts)
+		})
+	},
+}
+
+// transferOptions reads the flags shared by put and get.
+func transferOptions(cmd *cobra.Command) ssh.TransferOptions {
+	recursive, _ := cmd.Flags().GetBool("recursive")
+	preserve, _ := cmd.Flags().GetBool("preserve")
+	resume, _ := cmd.Flags().GetBool("resume")
+	quiet, _ := cmd.Flags().GetBool("quiet")
+
+	return ssh.TransferOptions{
+		Recursive: recursive,
+		Preserve:  preserve,
+		Resume:    resume,
+		Progress:  !quiet && terminal.IsTerminal(int(os.Stderr.Fd())),
+	}
+}
+
+// withSFTP connects to the named connection and runs fn with an SFTP session.
+func withSFTP(identifier string, fn func(sc *sftp.Client) error) error {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return fmt.Errorf("failed to get config: %w", err)
+	}
+
+	conn, _, err := findConnection(cfg, identifier)
+	if err != nil {
+		return err
+	}
+
+	client, err := ssh.Dial(cfg, &conn)
+	if err != nil {
+		return fmt.Errorf("ssh connection failed: %w", err)
+	}
+	defer client.Close()
+
+	return withSFTPClient(client, fn)
+}
+
+// withSFTPClient runs fn with an SFTP session over an established client.
+func withSFTPClient(client *gossh.Client, fn func(sc *sftp.Client) error) error {
+	sc, err := ssh.NewSFTPClient(client)
+	if err != nil {
+		return err
+	}
+	defer sc.Close()
+
+	return fn(sc)
+}
+
+// addTransferFlags registers the flags shared by put and get.
+func addTransferFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolP("recursive", "r", false, "Copy directories recursively")
+	cmd.Flags().BoolP("preserve", "p", false, "Preserve permissions and modification times")
+	cmd.Flags().BoolP("resume", "c", false, "Resume partially transferred files")
+	cmd.Flags().BoolP("quiet", "q", false, "Do not show progress bars")
+}
+
+func init() {
+	rootCmd.AddCommand(putCmd)
+
+	addTransferFlags(putCmd)
+}
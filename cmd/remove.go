@@ -8,6 +8,7 @@ import (
 	"github.com/manifoldco/promptui"
 	"github.com/spf13/cobra"
 	"sm/internal/config"
+	"sm/internal/models"
 )
 
 // removeCmd represents the remove command
@@ -49,6 +50,15 @@ var removeCmd = &cobra.Command{
 			return errors.New("connection with this name or ID does not exist")
 		}
 
+		// Warn about connections that use this one as a jump host
+		for name, c := range cfg.Connections {
+			for _, jump := range c.JumpHosts {
+				if jump == connName {
+					fmt.Printf("Warning: connection '%s' uses '%s' as a jump host\n", name, connName)
+				}
+			}
+		}
+
 		prompt := promptui.Prompt{
 			Label:     fmt.Sprintf("Are you sure you want to remove connection '%s'", connName),
 			IsConfirm: true,
@@ -66,10 +76,15 @@ var removeCmd = &cobra.Command{
 			return fmt.Errorf("prompt failed: %w", err)
 		}
 
-		delete(cfg.Connections, connName)
-
-		if err := config.SaveConfig(cfg); err != nil {
-			return fmt.Errorf("failed to save config: %w", err)
+		err = config.Update(func(cfg *models.AppConfig) error {
+			if _, exists := cfg.Connections[connName]; !exists {
+				return errors.New("connection with this name or ID does not exist")
+			}
+			delete(cfg.Connections, connName)
+			return nil
+		})
+		if err != nil {
+			return err
 		}
 
 		fmt.Printf("Successfully removed connection '%s'\n", connName)
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
@@ -37,18 +38,24 @@ quickly connect to your remote servers via SSH.`, // Corrected: Removed unnecess
 				return fmt.Errorf("failed to get config: %w", err)
 			}
 
-			conn, exists := cfg.Connections[connName]
+			saved, exists := cfg.Connections[connName]
 			if exists {
+				conn := cfg.Resolve(saved).Connection
 				// This is the shorthand. Execute the connect command logic directly.
+				recordUse(connName)
 				fmt.Printf("Connecting to %s (%s@%s)... (shorthand)\n", conn.Name, conn.User, conn.Host)
-				if err := ssh.Connect(&conn); err != nil {
+				if err := ssh.Connect(cfg, &conn); err != nil {
 					return fmt.Errorf("ssh connection failed: %w", err)
 				}
 				fmt.Println("Connection closed.")
 				return nil
 			}
 		}
-		// If no connection name is provided or found, show help
+		// Without arguments, choose a connection in the picker
+		if len(args) == 0 && isInteractive() {
+			return pickAndConnect("")
+		}
+		// If no connection name is found, show help
 		return cmd.Help()
 	},
 }
@@ -58,10 +65,32 @@ quickly connect to your remote servers via SSH.`, // Corrected: Removed unnecess
 func Execute() {
 	err := rootCmd.Execute()
 	if err != nil {
+		var exitErr *exitCodeError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.code)
+		}
 		os.Exit(1)
 	}
 }
 
+// exitCodeError makes sm exit with a specific status, e.g. the exit status
+// of a remote command.
+type exitCodeError struct {
+	code int
+	err  error
+}
+
+func (e *exitCodeError) Error() string {
+	if e.err == nil {
+		return fmt.Sprintf("exit status %d", e.code)
+	}
+	return e.err.Error()
+}
+
+func (e *exitCodeError) Unwrap() error {
+	return e.err
+}
+
 func init() {
 
 cobra.OnInitialize(initConfig)
@@ -69,35 +98,34 @@ cobra.OnInitialize(initConfig)
 	// Here you will define your flags and configuration settings.
 	// Cobra supports a global flag that will be valid for all
 	// subcommands, e.g:
-	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.sm/config.yaml)")
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $SM_CONFIG, else $XDG_CONFIG_HOME/sm/config.yaml or $HOME/.config/sm/config.yaml); sm keeps its backups, lock and known hosts in the default directory either way")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
 
-// initConfig reads in config file and ENV variables if set.
+// initConfig resolves the config file and ENV variables if set. The file is
+// resolved by the config package, so that loading and saving always agree.
 func initConfig() {
 	if cfgFile != "" {
 		// Use config file from the flag.
-		viper.SetConfigFile(cfgFile)
-	} else {
-		// Find home directory.
-		home, err := os.UserHomeDir()
-		cobra.CheckErr(err)
-
-		// Search config in home directory with name ".sm" (without extension).
-		viper.AddConfigPath(fmt.Sprintf("%s/.sm", home))
-		viper.AddConfigPath(fmt.Sprintf("%s/.config/sm", home))
-		viper.SetConfigType("yaml")
-		viper.SetConfigName("config")
+		config.SetConfigFile(cfgFile)
+	} else if from, err := config.MigrateLegacyConfig(); err != nil {
+		fmt.Fprintln(os.Stderr, "Warning: could not migrate the old config:", err)
+	} else if from != "" {
+		configDir, _ := config.ConfigDir()
+		fmt.Fprintf(os.Stderr, "Moved configuration from %s to %s\n", from, configDir)
 	}
 
+	configFile, err := config.ConfigFile()
+	cobra.CheckErr(err)
+	viper.SetConfigFile(configFile)
+	viper.SetConfigType("yaml")
+
 	viper.SetEnvPrefix("SM")
 	viper.AutomaticEnv()
 
 	// If a config file is found, read it in.
-	if err := viper.ReadInConfig(); err == nil {
-		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
-	}
+	viper.ReadInConfig()
 }
@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"sm/internal/config"
+	"sm/internal/models"
+	"sm/internal/utils"
+)
+
+// secretsCmd represents the secrets command
+var secretsCmd = &cobra.Command{
+	Use:   "secrets",
+	Short: "Check and re-encrypt saved passwords, and manage secret references",
+	Long: `Verifies that saved passwords can be decrypted, rotates the key that encrypts them,
+and saves secrets in the OS keyring for ref:keyring: references.`,
+}
+
+// Results of checking a saved password.
+const (
+	passwordOK            = "ok"
+	passwordPlaintext     = "not encrypted"
+	passwordUndecryptable = "cannot decrypt"
+	passwordReference     = "reference"
+)
+
+// checkPassword tries to decrypt a saved password and reports its status.
+// Only passwords marked as encrypted are decrypted, and secret references are
+// not resolved. Errors that are not about the password
+// itself, such as a locked master password or an unavailable keyring, are
+// returned.
+func checkPassword(value string) (plaintext, status string, err error) {
+	if utils.IsSecretRef(value) {
+		return "", passwordReference, nil
+	}
+	if !utils.IsEncrypted(value) {
+		return value, passwordPlaintext, nil
+	}
+	plaintext, err = utils.Decrypt(value)
+	switch {
+	case err == nil:
+		return plaintext, passwordOK, nil
+	case !errors.Is(err, utils.ErrUndecryptable):
+		return "", "", err
+	default:
+		return "", passwordUndecryptable, err
+	}
+}
+
+// passwordNames returns the names of the connections with a saved password, sorted.
+func passwordNames(cfg *models.AppConfig) []string {
+	var names []string
+	for name, conn := range cfg.Connections {
+		if conn.Password != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// needsEncryptionKey reports whether cfg has a saved password that is not a
+// secret reference, so the encryption key is needed to work on it.
+func needsEncryptionKey(cfg *models.AppConfig) bool {
+	for _, conn := range cfg.Connections {
+		if conn.Password != "" && !utils.IsSecretRef(conn.Password) {
+			return true
+		}
+	}
+	return false
+}
+
+// reencryptResult describes what reencryptPasswords changed.
+type reencryptResult struct {
+	Reencrypted int
+	Plaintext   []string // Left as they are
+	Removed     []string // Could not be decrypted and were removed
+}
+
+// reencryptPasswords re-encrypts every saved password with newKey and saves
+// settings as the new key source, in a single config update. It fails if a
+// password cannot be decrypted, unless force is set, which removes it.
+func reencryptPasswords(settings models.EncryptionSettings, newKey []byte, force bool) (reencryptResult, error) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return reencryptResult{}, fmt.Errorf("failed to get config: %w", err)
+	}
+	if needsEncryptionKey(cfg) {
+		// Unlock the current key before taking the config lock, as it may
+		// ask for the master password
+		if _, err := utils.EncryptionKey(); err != nil {
+			return reencryptResult{}, fmt.Errorf("failed to get the current encryption key: %w", err)
+		}
+	}
+
+	var result reencryptResult
+	err = config.Update(func(cfg *models.AppConfig) error {
+		result = reencryptResult{}
+		var undecryptable []string
+		for _, name := range passwordNames(cfg) {
+			conn := cfg.Connections[name]
+			plaintext, status, err := checkPassword(conn.Password)
+			if err != nil && status == "" {
+				return err
+			}
+
+			switch status {
+			case passwordReference:
+				continue
+			case passwordPlaintext:
+				result.Plaintext = append(result.Plaintext, name)
+				continue
+			case passwordUndecryptable:
+				if !force {
+					undecryptable = append(undecryptable, name)
+					continue
+				}
+				conn.Password = ""
+				result.Removed = append(result.Removed, name)
+			default:
+				conn.Password, err = utils.EncryptWithKey(newKey, plaintext)
+				if err != nil {
+					return fmt.Errorf("failed to encrypt password for %s: %w", name, err)
+				}
+				result.Reencrypted++
+			}
+			cfg.Connections[name] = conn
+		}
+		if len(undecryptable) > 0 {
+			return fmt.Errorf("cannot decrypt the saved password of %s. Save them again with 'sm edit <name> --pass', or use --force to remove them", strings.Join(undecryptable, ", "))
+		}
+
+		cfg.Settings.Encryption = settings
+		return nil
+	})
+	return result, err
+}
+
+// printReencryptResult summarizes a re-encryption.
+func printReencryptResult(result reencryptResult) {
+	fmt.Printf("Re-encrypted %d password(s).\n", result.Reencrypted)
+	if len(result.Plaintext) > 0 {
+		fmt.Printf("Left %d password(s) that were not encrypted as they are (see 'sm secrets encrypt-all'): %s\n", len(result.Plaintext), strings.Join(result.Plaintext, ", "))
+	}
+	if len(result.Removed) > 0 {
+		fmt.Printf("Removed %d password(s) that could not be decrypted: %s\n", len(result.Removed), strings.Join(result.Removed, ", "))
+	}
+}
+
+// readNewMasterPassword asks for a new master password twice and derives a
+// key from it with a fresh salt.
+func readNewMasterPassword() (models.EncryptionSettings, []byte, error) {
+	password, err := utils.ReadPassword("New master password: ")
+	if err != nil {
+		return models.EncryptionSettings{}, nil, err
+	}
+	if password == "" {
+		return models.EncryptionSettings{}, nil, errors.New("master password cannot be empty")
+	}
+	confirm, err := utils.ReadPassword("Repeat new master password: ")
+	if err != nil {
+		return models.EncryptionSettings{}, nil, err
+	}
+	if password != confirm {
+		return models.EncryptionSettings{}, nil, errors.New("passwords do not match")
+	}
+	return utils.NewMasterKey(password)
+}
+
+// validateKeyPassphrase makes sure a key passphrase is given as a secret
+// reference, so that it is never saved in the config file.
+func validateKeyPassphrase(value string) error {
+	if value == "" {
+		return nil
+	}
+	if err := utils.ValidateSecretRef(value); err != nil {
+		return fmt.Errorf("the key passphrase must be a secret reference: %w", err)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(secretsCmd)
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"sm/internal/config"
+	"sm/internal/models"
+	"sm/internal/utils"
+)
+
+// secretsEncryptAllCmd represents the secrets encrypt-all command
+var secretsEncryptAllCmd = &cobra.Command{
+	Use:   "encrypt-all",
+	Short: "Encrypt every saved password that is not encrypted yet",
+	Long: `Converts saved passwords in place: plaintext passwords are encrypted, and
+passwords encrypted by older versions of sm are re-encrypted so they carry the
+enc:v1: marker and the ID of their key. Passwords that are already marked are left
+as they are, and so are secret references such as ref:env:NAME.
+
+An unmarked value counts as encrypted by an older version only if it decrypts
+with the current key. Any other value is a plaintext password, even if it looks
+like a ciphertext, and is encrypted as such.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.GetConfig()
+		if err != nil {
+			return fmt.Errorf("failed to get config: %w", err)
+		}
+		if needsEncryptionKey(cfg) {
+			// Unlock the key before taking the config lock, as it may ask for the master password
+			if _, err := utils.EncryptionKey(); err != nil {
+				return fmt.Errorf("failed to get the encryption key: %w", err)
+			}
+		}
+
+		var encrypted, converted, lookalikes []string
+		err = config.Update(func(cfg *models.AppConfig) error {
+			encrypted, converted, lookalikes = nil, nil, nil
+			for _, name := range passwordNames(cfg) {
+				conn := cfg.Connections[name]
+				if utils.IsEncrypted(conn.Password) || utils.IsSecretRef(conn.Password) {
+					continue
+				}
+
+				plaintext, err := utils.DecryptUnmarked(conn.Password)
+				switch {
+				case err == nil:
+					converted = append(converted, name)
+				case !errors.Is(err, utils.ErrUndecryptable):
+					return err
+				default:
+					plaintext = conn.Password
+					encrypted = append(encrypted, name)
+					if utils.MaybeUnmarkedCiphertext(conn.Password) {
+						lookalikes = append(lookalikes, name)
+					}
+				}
+
+				conn.Password, err = utils.Encrypt(plaintext)
+				if err != nil {
+					return fmt.Errorf("failed to encrypt password for %s: %w", name, err)
+				}
+				cfg.Connections[name] = conn
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if len(encrypted)+len(converted) == 0 {
+			fmt.Println("Every saved password is already encrypted or a secret reference.")
+		}
+		if len(encrypted) > 0 {
+			fmt.Printf("Encrypted %d plaintext password(s): %s\n", len(encrypted), strings.Join(encrypted, ", "))
+		}
+		if len(lookalikes) > 0 {
+			fmt.Printf("Of these, %s looked like an old ciphertext but did not decrypt with the current key, so it was taken as the password.\n", strings.Join(lookalikes, ", "))
+		}
+		if len(converted) > 0 {
+			fmt.Printf("Converted %d password(s) encrypted by an older version: %s\n", len(converted), strings.Join(converted, ", "))
+		}
+		if !cfg.Settings.EncryptPasswords {
+			fmt.Println("Note: settings.encrypt_passwords is false, so new passwords are still saved in plaintext.")
+		}
+		return nil
+	},
+}
+
+func init() {
+	secretsCmd.AddCommand(secretsEncryptAllCmd)
+}
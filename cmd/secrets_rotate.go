@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"sm/internal/config"
+	"sm/internal/models"
+	"sm/internal/utils"
+)
+
+// secretsRotateCmd represents the secrets rotate command
+var secretsRotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Re-encrypt saved passwords with a new key",
+	Long: `Generates a new encryption key and re-encrypts every saved password with it
+in a single config update.
+
+With the OS keyring, the new key replaces the old one in the keyring and the old key
+is removed afterwards. Keep it with --keep-old-key to read passwords in config backups
+made before the rotation. With a master password, you are asked for a new one.
+
+Passwords that cannot be decrypted stop the rotation. Find them with
+'sm secrets verify', or use --force to remove them.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		force, _ := cmd.Flags().GetBool("force")
+		keepOld, _ := cmd.Flags().GetBool("keep-old-key")
+
+		cfg, err := config.GetConfig()
+		if err != nil {
+			return fmt.Errorf("failed to get config: %w", err)
+		}
+
+		if cfg.Settings.Encryption.KeySource == models.KeySourceMasterPassword {
+			settings, newKey, err := readNewMasterPassword()
+			if err != nil {
+				return err
+			}
+			result, err := reencryptPasswords(settings, newKey, force)
+			if err != nil {
+				return err
+			}
+			printReencryptResult(result)
+			fmt.Println("Changed the master password. Run 'sm unlock' to cache the new one.")
+			return nil
+		}
+
+		oldKey, err := utils.KeyringKey()
+		if err != nil {
+			return err
+		}
+		newKey, err := utils.NewKey()
+		if err != nil {
+			return err
+		}
+
+		// Keep both keys under their IDs first, so every password can still be
+		// decrypted if sm is interrupted before the rotation completes
+		if err := utils.SaveKeyringKey(oldKey); err != nil {
+			return err
+		}
+		if err := utils.SaveKeyringKey(newKey); err != nil {
+			return err
+		}
+
+		result, err := reencryptPasswords(cfg.Settings.Encryption, newKey, force)
+		if err != nil {
+			utils.DeleteKeyringKey(utils.KeyID(newKey))
+			return err
+		}
+		if err := utils.SetKeyringKey(newKey); err != nil {
+			return err
+		}
+
+		printReencryptResult(result)
+		oldID, newID := utils.KeyID(oldKey), utils.KeyID(newKey)
+		if keepOld {
+			fmt.Printf("Rotated the encryption key from %s to %s. The old key was kept in the keyring.\n", oldID, newID)
+			return nil
+		}
+		if err := utils.DeleteKeyringKey(oldID); err != nil {
+			return err
+		}
+		fmt.Printf("Rotated the encryption key from %s to %s and removed the old key.\n", oldID, newID)
+		return nil
+	},
+}
+
+func init() {
+	secretsCmd.AddCommand(secretsRotateCmd)
+
+	secretsRotateCmd.Flags().Bool("force", false, "Remove passwords that cannot be decrypted instead of stopping")
+	secretsRotateCmd.Flags().Bool("keep-old-key", false, "Keep the old key in the keyring, to read passwords in older config backups")
+}
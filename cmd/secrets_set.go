@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
+	"sm/internal/utils"
+)
+
+// secretsSetCmd represents the secrets set command
+var secretsSetCmd = &cobra.Command{
+	Use:   "set <name>",
+	Short: "Save a secret in the OS keyring for ref:keyring: references",
+	Long: `Saves a secret in the OS keyring, so a connection can refer to it as
+ref:keyring:<name> instead of keeping the password in the config file. The secret
+is read from the terminal without echoing it, or from standard input when it is
+piped.`,
+	Example: `  sm secrets set db-prod
+  sm edit db --pass ref:keyring:db-prod
+  sm edit web --key-passphrase ref:keyring:deploy-key
+  sm secrets set db-prod --delete`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+
+		if remove, _ := cmd.Flags().GetBool("delete"); remove {
+			if err := utils.DeleteKeyringSecret(name); err != nil {
+				return err
+			}
+			fmt.Printf("Removed secret '%s' from the keyring\n", name)
+			return nil
+		}
+
+		secret, err := readSecret(name)
+		if err != nil {
+			return err
+		}
+		if secret == "" {
+			return errors.New("secret cannot be empty")
+		}
+		if err := utils.SetKeyringSecret(name, secret); err != nil {
+			return err
+		}
+		fmt.Printf("Saved secret '%s' in the keyring. Use it as ref:keyring:%s\n", name, name)
+		return nil
+	},
+}
+
+// readSecret reads a secret from the terminal, or the first line of stdin
+// when it is not a terminal.
+func readSecret(name string) (string, error) {
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("failed to read secret from stdin: %w", err)
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	secret, err := utils.ReadPassword(fmt.Sprintf("Secret for %s: ", name))
+	if err != nil {
+		return "", err
+	}
+	confirm, err := utils.ReadPassword("Repeat secret: ")
+	if err != nil {
+		return "", err
+	}
+	if secret != confirm {
+		return "", errors.New("secrets do not match")
+	}
+	return secret, nil
+}
+
+func init() {
+	secretsCmd.AddCommand(secretsSetCmd)
+
+	secretsSetCmd.Flags().Bool("delete", false, "Remove the secret from the keyring instead")
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"sm/internal/config"
+	"sm/internal/utils"
+)
+
+// secretsVerifyCmd represents the secrets verify command
+var secretsVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check that every saved password can be decrypted",
+	Long: `Tries to decrypt every saved password and reports the ones that cannot be
+decrypted, with the ID of the key that encrypted them. Exits with status 1 if any
+password cannot be decrypted.
+
+Secret references such as ref:env:NAME are listed without being resolved. Use
+--resolve to check that they resolve too, including the references to key
+passphrases. This may run helpers such as pass or cmd: commands.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		resolve, _ := cmd.Flags().GetBool("resolve")
+
+		cfg, err := config.GetConfig()
+		if err != nil {
+			return fmt.Errorf("failed to get config: %w", err)
+		}
+
+		names := passwordNames(cfg)
+		if resolve {
+			names = nil
+			for name, conn := range cfg.Connections {
+				if conn.Password != "" || conn.KeyPassphrase != "" {
+					names = append(names, name)
+				}
+			}
+			sort.Strings(names)
+		}
+		if len(names) == 0 {
+			fmt.Println("No saved passwords.")
+			return nil
+		}
+
+		// The key is only needed for encrypted passwords, not for references
+		var currentID string
+		for _, name := range names {
+			if value := cfg.Connections[name].Password; utils.IsEncrypted(value) {
+				key, err := utils.EncryptionKey()
+				if err != nil {
+					return fmt.Errorf("failed to get the current encryption key: %w", err)
+				}
+				currentID = utils.KeyID(key)
+				break
+			}
+		}
+
+		failed, retired := 0, 0
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "NAME\tKEY\tSTATUS")
+		for _, name := range names {
+			conn := cfg.Connections[name]
+			if conn.Password != "" {
+				_, status, err := checkPassword(conn.Password)
+				if status == "" {
+					w.Flush()
+					return err
+				}
+
+				keyID := utils.CiphertextKeyID(conn.Password)
+				switch {
+				case status == passwordUndecryptable:
+					failed++
+					status = err.Error()
+				case status == passwordOK && keyID != "" && keyID != currentID:
+					retired++
+					status = "ok (old key)"
+				case status == passwordReference:
+					scheme, _, _ := utils.ParseSecretRef(conn.Password)
+					status = verifyReference(conn.Password, scheme, resolve, &failed)
+				}
+				if keyID == "" {
+					keyID = "-"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\n", name, keyID, status)
+			}
+
+			if resolve && conn.KeyPassphrase != "" {
+				scheme, _, _ := utils.ParseSecretRef(conn.KeyPassphrase)
+				status := verifyReference(conn.KeyPassphrase, scheme, resolve, &failed)
+				fmt.Fprintf(w, "%s (key passphrase)\t-\t%s\n", name, status)
+			}
+		}
+		w.Flush()
+
+		if currentID != "" {
+			fmt.Printf("\nCurrent key: %s\n", currentID)
+		}
+		if retired > 0 {
+			fmt.Printf("%d password(s) use an old key. Run 'sm secrets rotate' to re-encrypt them.\n", retired)
+		}
+		if failed > 0 {
+			return &exitCodeError{code: 1, err: fmt.Errorf("%d secret(s) cannot be read. Fix the references, or save the passwords again with 'sm edit <name> --pass'", failed)}
+		}
+		return nil
+	},
+}
+
+// verifyReference describes a secret reference, resolving it if resolve is
+// set. Failures are counted in failed.
+func verifyReference(value, scheme string, resolve bool, failed *int) string {
+	if !resolve {
+		return fmt.Sprintf("%s (%s)", passwordReference, scheme)
+	}
+	if _, err := utils.ResolveSecret(value); err != nil {
+		*failed++
+		return err.Error()
+	}
+	return fmt.Sprintf("ok (%s)", scheme)
+}
+
+func init() {
+	secretsCmd.AddCommand(secretsVerifyCmd)
+
+	secretsVerifyCmd.Flags().Bool("resolve", false, "Also resolve secret references, including key passphrases")
+}
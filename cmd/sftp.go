@@ -0,0 +1,517 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/chzyer/readline"
+	"github.com/pkg/sftp"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
+	"sm/internal/ssh"
+)
+
+// sftpCmd represents the sftp command
+var sftpCmd = &cobra.Command{
+	Use:   "sftp <name_or_id>",
+	Short: "Browse a saved SSH server interactively over SFTP",
+	Long: `Opens an interactive SFTP prompt on the specified server, using its saved
+authentication and jump hosts. Type 'help' at the prompt to list the available commands.
+Remote paths are completed with the Tab key.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withSFTP(args[0], func(sc *sftp.Client) error {
+			shell, err := newSFTPShell(sc)
+			if err != nil {
+				return err
+			}
+			return shell.run()
+		})
+	},
+}
+
+// sftpCommand is a command available at the sftp prompt.
+type sftpCommand struct {
+	name     string
+	usage    string
+	help     string
+	run      func(s *sftpShell, args []string) error
+	complete func(s *sftpShell, argIndex int, word string) []string
+}
+
+// sftpCommands lists the commands of the sftp prompt, in the order shown by help.
+var sftpCommands []sftpCommand
+
+func init() {
+	sftpCommands = []sftpCommand{
+		{"ls", "ls [-l] [path]", "List a remote directory", (*sftpShell).ls, remoteCompletion},
+		{"cd", "cd [path]", "Change the remote directory (default: home)", (*sftpShell).cd, remoteCompletion},
+		{"pwd", "pwd", "Print the remote directory", (*sftpShell).pwd, nil},
+		{"get", "get [-r] [-p] <remote> [local]", "Download files (globs allowed)", (*sftpShell).get, getCompletion},
+		{"put", "put [-r] [-p] <local> [remote]", "Upload files (globs allowed)", (*sftpShell).put, putCompletion},
+		{"rm", "rm [-r] <path>", "Remove a remote file or directory", (*sftpShell).rm, remoteCompletion},
+		{"mkdir", "mkdir [-p] <path>", "Create a remote directory", (*sftpShell).mkdir, remoteCompletion},
+		{"chmod", "chmod <mode> <path>", "Change remote permissions, e.g. chmod 644 file", (*sftpShell).chmod, chmodCompletion},
+		{"lls", "lls [path]", "List a local directory", (*sftpShell).lls, localCompletion},
+		{"lcd", "lcd <path>", "Change the local directory", (*sftpShell).lcd, localCompletion},
+		{"lpwd", "lpwd", "Print the local directory", (*sftpShell).lpwd, nil},
+		{"help", "help", "Show this help", (*sftpShell).help, nil},
+		{"exit", "exit", "Close the session (also: quit, bye, Ctrl+D)", nil, nil},
+	}
+
+	rootCmd.AddCommand(sftpCmd)
+}
+
+// sftpShell is an interactive SFTP session. SFTP has no notion of a current
+// directory, so the shell keeps track of it and resolves relative paths itself.
+type sftpShell struct {
+	sc   *sftp.Client
+	home string
+	cwd  string
+}
+
+func newSFTPShell(sc *sftp.Client) (*sftpShell, error) {
+	home, err := sc.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get remote home directory: %w", err)
+	}
+	return &sftpShell{sc: sc, home: home, cwd: home}, nil
+}
+
+// run reads and executes commands until the user exits.
+func (s *sftpShell) run() error {
+	rl, err := readline.NewEx(&readline.Config{
+		Prompt:          s.prompt(),
+		AutoComplete:    s,
+		InterruptPrompt: "^C",
+		EOFPrompt:       "exit",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to start prompt: %w", err)
+	}
+	defer rl.Close()
+
+	for {
+		line, err := rl.Readline()
+		if err == readline.ErrInterrupt {
+			continue
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		args, err := splitArgs(line)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		switch args[0] {
+		case "exit", "quit", "bye":
+			return nil
+		}
+
+		command, found := findSFTPCommand(args[0])
+		if !found {
+			fmt.Fprintf(os.Stderr, "Unknown command '%s'. Type 'help' for a list of commands.\n", args[0])
+			continue
+		}
+		if err := command.run(s, args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+		}
+		rl.SetPrompt(s.prompt())
+	}
+}
+
+func (s *sftpShell) prompt() string {
+	dir := s.cwd
+	if dir == s.home {
+		dir = "~"
+	} else if strings.HasPrefix(dir, s.home+"/") {
+		dir = "~" + strings.TrimPrefix(dir, s.home)
+	}
+	return fmt.Sprintf("sftp:%s> ", dir)
+}
+
+// resolve turns a path typed at the prompt into an absolute remote path.
+func (s *sftpShell) resolve(p string) string {
+	switch {
+	case p == "" || p == "~":
+		return s.home
+	case strings.HasPrefix(p, "~/"):
+		return path.Join(s.home, p[2:])
+	case path.IsAbs(p):
+		return path.Clean(p)
+	}
+	return path.Join(s.cwd, p)
+}
+
+func (s *sftpShell) transferOptions(flags map[string]bool) ssh.TransferOptions {
+	return ssh.TransferOptions{
+		Recursive: flags["r"],
+		Preserve:  flags["p"],
+		Progress:  terminal.IsTerminal(int(os.Stderr.Fd())),
+	}
+}
+
+func (s *sftpShell) ls(args []string) error {
+	flags, args, err := parseShellFlags(args, "l")
+	if err != nil {
+		return err
+	}
+	dir := s.cwd
+	if len(args) > 0 {
+		dir = s.resolve(args[0])
+	}
+
+	entries, err := s.sc.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	printEntries(entries, flags["l"])
+	return nil
+}
+
+func (s *sftpShell) cd(args []string) error {
+	target := s.home
+	if len(args) > 0 {
+		target = s.resolve(args[0])
+	}
+
+	info, err := s.sc.Stat(target)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", target)
+	}
+	s.cwd = target
+	return nil
+}
+
+func (s *sftpShell) pwd(args []string) error {
+	fmt.Println(s.cwd)
+	return nil
+}
+
+func (s *sftpShell) get(args []string) error {
+	flags, args, err := parseShellFlags(args, "rp")
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 || len(args) > 2 {
+		return errors.New("usage: get [-r] [-p] <remote> [local]")
+	}
+	local := "."
+	if len(args) == 2 {
+		local = args[1]
+	}
+	return ssh.Download(s.sc, []string{s.resolve(args[0])}, local, s.transferOptions(flags))
+}
+
+func (s *sftpShell) put(args []string) error {
+	flags, args, err := parseShellFlags(args, "rp")
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 || len(args) > 2 {
+		return errors.New("usage: put [-r] [-p] <local> [remote]")
+	}
+	remote := s.cwd
+	if len(args) == 2 {
+		remote = s.resolve(args[1])
+	}
+	return ssh.Upload(s.sc, []string{args[0]}, remote, s.transferOptions(flags))
+}
+
+func (s *sftpShell) rm(args []string) error {
+	flags, args, err := parseShellFlags(args, "r")
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return errors.New("usage: rm [-r] <path>")
+	}
+	if flags["r"] {
+		return s.sc.RemoveAll(s.resolve(args[0]))
+	}
+	return s.sc.Remove(s.resolve(args[0]))
+}
+
+func (s *sftpShell) mkdir(args []string) error {
+	flags, args, err := parseShellFlags(args, "p")
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return errors.New("usage: mkdir [-p] <path>")
+	}
+	if flags["p"] {
+		return s.sc.MkdirAll(s.resolve(args[0]))
+	}
+	return s.sc.Mkdir(s.resolve(args[0]))
+}
+
+func (s *sftpShell) chmod(args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: chmod <mode> <path>")
+	}
+	mode, err := strconv.ParseUint(args[0], 8, 32)
+	if err != nil || mode > 07777 {
+		return fmt.Errorf("invalid mode %q: expected an octal mode such as 644", args[0])
+	}
+	return s.sc.Chmod(s.resolve(args[1]), os.FileMode(mode))
+}
+
+func (s *sftpShell) lls(args []string) error {
+	dir := "."
+	if len(args) > 0 {
+		dir = args[0]
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var infos []os.FileInfo
+	for _, e := range entries {
+		if info, err := e.Info(); err == nil {
+			infos = append(infos, info)
+		}
+	}
+	printEntries(infos, false)
+	return nil
+}
+
+func (s *sftpShell) lcd(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: lcd <path>")
+	}
+	return os.Chdir(args[0])
+}
+
+func (s *sftpShell) lpwd(args []string) error {
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	fmt.Println(dir)
+	return nil
+}
+
+func (s *sftpShell) help(args []string) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	for _, c := range sftpCommands {
+		fmt.Fprintf(w, "%s\t%s\n", c.usage, c.help)
+	}
+	w.Flush()
+	return nil
+}
+
+// Do implements readline.AutoCompleter. The first word completes to a command
+// name; later words complete to local or remote paths depending on the command.
+func (s *sftpShell) Do(line []rune, pos int) ([][]rune, int) {
+	before := string(line[:pos])
+	words := strings.Fields(before)
+	if len(words) == 0 || strings.HasSuffix(before, " ") {
+		words = append(words, "")
+	}
+	word := words[len(words)-1]
+
+	var candidates []string
+	if len(words) == 1 {
+		for _, c := range sftpCommands {
+			candidates = append(candidates, c.name+" ")
+		}
+	} else if command, found := findSFTPCommand(words[0]); found && command.complete != nil {
+		// Flags do not count as arguments
+		argIndex := 0
+		for _, w := range words[1 : len(words)-1] {
+			if !strings.HasPrefix(w, "-") {
+				argIndex++
+			}
+		}
+		candidates = command.complete(s, argIndex, word)
+	}
+
+	var suffixes [][]rune
+	for _, c := range candidates {
+		if strings.HasPrefix(c, word) {
+			suffixes = append(suffixes, []rune(c[len(word):]))
+		}
+	}
+	return suffixes, len([]rune(word))
+}
+
+// completePaths lists the entries of the directory part of word, as
+// candidates that keep the directory part exactly as typed.
+func completePaths(word string, readDir func(dir string) ([]os.FileInfo, error), dirOf func(string) string) []string {
+	dir, typedDir := ".", ""
+	if i := strings.LastIndex(word, "/"); i >= 0 {
+		typedDir = word[:i+1]
+		dir = typedDir
+	}
+
+	entries, err := readDir(dirOf(dir))
+	if err != nil {
+		return nil
+	}
+
+	var candidates []string
+	for _, e := range entries {
+		name := typedDir + e.Name()
+		if e.IsDir() {
+			name += "/"
+		} else {
+			name += " "
+		}
+		candidates = append(candidates, name)
+	}
+	sort.Strings(candidates)
+	return candidates
+}
+
+func remoteCompletion(s *sftpShell, argIndex int, word string) []string {
+	return completePaths(word, s.sc.ReadDir, s.resolve)
+}
+
+func localCompletion(s *sftpShell, argIndex int, word string) []string {
+	return completePaths(word, func(dir string) ([]os.FileInfo, error) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		var infos []os.FileInfo
+		for _, e := range entries {
+			if info, err := e.Info(); err == nil {
+				infos = append(infos, info)
+			}
+		}
+		return infos, nil
+	}, func(dir string) string { return dir })
+}
+
+// getCompletion completes the remote source, then the local destination.
+func getCompletion(s *sftpShell, argIndex int, word string) []string {
+	if argIndex == 0 {
+		return remoteCompletion(s, argIndex, word)
+	}
+	return localCompletion(s, argIndex, word)
+}
+
+// putCompletion completes the local source, then the remote destination.
+func putCompletion(s *sftpShell, argIndex int, word string) []string {
+	if argIndex == 0 {
+		return localCompletion(s, argIndex, word)
+	}
+	return remoteCompletion(s, argIndex, word)
+}
+
+// chmodCompletion completes the path after the mode.
+func chmodCompletion(s *sftpShell, argIndex int, word string) []string {
+	if argIndex == 0 {
+		return nil
+	}
+	return remoteCompletion(s, argIndex, word)
+}
+
+func findSFTPCommand(name string) (sftpCommand, bool) {
+	for _, c := range sftpCommands {
+		if c.name == name && c.run != nil {
+			return c, true
+		}
+	}
+	return sftpCommand{}, false
+}
+
+// printEntries prints directory entries sorted by name, directories marked with '/'.
+func printEntries(entries []os.FileInfo, long bool) {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() {
+			name += "/"
+		}
+		if long {
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", e.Mode(), e.Size(), e.ModTime().Format("Jan _2 15:04 2006"), name)
+		} else {
+			fmt.Fprintln(w, name)
+		}
+	}
+	w.Flush()
+}
+
+// parseShellFlags separates single-letter flags such as -r or -rp from the
+// other arguments. Only the letters in allowed are accepted.
+func parseShellFlags(args []string, allowed string) (map[string]bool, []string, error) {
+	flags := make(map[string]bool)
+	var rest []string
+	for _, a := range args {
+		if len(a) < 2 || a[0] != '-' {
+			rest = append(rest, a)
+			continue
+		}
+		for _, f := range a[1:] {
+			if !strings.ContainsRune(allowed, f) {
+				return nil, nil, fmt.Errorf("unknown flag -%c", f)
+			}
+			flags[string(f)] = true
+		}
+	}
+	return flags, rest, nil
+}
+
+// splitArgs splits a command line on whitespace, honouring single and double quotes.
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	var quote rune
+	inWord := false
+
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t':
+			if inWord {
+				args = append(args, current.String())
+				current.Reset()
+				inWord = false
+			}
+		default:
+			current.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if inWord {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
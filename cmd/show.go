@@ -0,0 +1,307 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+	"sm/internal/config"
+	"sm/internal/models"
+	"sm/internal/ssh"
+	"sm/internal/utils"
+)
+
+// showCmd represents the show command
+var showCmd = &cobra.Command{
+	Use:   "show <name_or_id>",
+	Short: "Show everything about a connection",
+	Long: `Shows every setting of a connection as it is used to connect, and where each
+inherited value comes from: the connection itself, one of its groups, the
+top-level defaults or sm's built-in default.
+
+It also shows the type and fingerprint of the key, whether a password is
+saved and can be decrypted, and when the connection was last used.
+Passwords are never printed unless --reveal is given.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, _ := cmd.Flags().GetString("format")
+		reveal, _ := cmd.Flags().GetBool("reveal")
+		if format != "text" && format != "json" && format != "yaml" {
+			return fmt.Errorf("invalid format: %s. Valid formats are 'text', 'json' and 'yaml'", format)
+		}
+
+		cfg, err := config.GetConfig()
+		if err != nil {
+			return fmt.Errorf("failed to get config: %w", err)
+		}
+
+		_, name, err := findConnection(cfg, args[0])
+		if err != nil {
+			return err
+		}
+		report := newConnectionReport(cfg, name, reveal)
+
+		switch format {
+		case "json":
+			out, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to format to json: %w", err)
+			}
+			fmt.Println(string(out))
+		case "yaml":
+			out, err := yaml.Marshal(report)
+			if err != nil {
+				return fmt.Errorf("failed to format to yaml: %w", err)
+			}
+			fmt.Print(string(out))
+		default:
+			printConnectionReport(report)
+		}
+		return nil
+	},
+}
+
+// connectionReport is what 'sm show' knows about a connection, with the
+// settings it inherits resolved.
+type connectionReport struct {
+	ID                    int               `json:"id" yaml:"id"`
+	Name                  string            `json:"name" yaml:"name"`
+	Group                 string            `json:"group,omitempty" yaml:"group,omitempty"`
+	Host                  string            `json:"host" yaml:"host"`
+	Port                  int               `json:"port" yaml:"port"`
+	User                  string            `json:"user" yaml:"user"`
+	Key                   *keyReport        `json:"key,omitempty" yaml:"key,omitempty"`
+	Password              passwordReport    `json:"password" yaml:"password"`
+	JumpHosts             []string          `json:"jump_hosts,omitempty" yaml:"jump_hosts,omitempty"`
+	StrictHostKeyChecking string            `json:"strict_host_key_checking" yaml:"strict_host_key_checking"`
+	ForwardAgent          bool              `json:"forward_agent" yaml:"forward_agent"`
+	Forwards              []models.Forward  `json:"forwards,omitempty" yaml:"forwards,omitempty"`
+	Tags                  []string          `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Description           string            `json:"description,omitempty" yaml:"description,omitempty"`
+	Extra                 map[string]string `json:"extra,omitempty" yaml:"extra,omitempty"`
+	LastUsed              *time.Time        `json:"last_used,omitempty" yaml:"last_used,omitempty"`
+	UseCount              int               `json:"use_count" yaml:"use_count"`
+	CreatedAt             *time.Time        `json:"created_at,omitempty" yaml:"created_at,omitempty"`
+
+	// Sources tells where inherited values come from, as models.Resolved does
+	Sources map[string]string `json:"sources,omitempty" yaml:"sources,omitempty"`
+}
+
+// keyReport describes the private key of a connection.
+type keyReport struct {
+	Path        string `json:"path" yaml:"path"`
+	Managed     string `json:"managed_as,omitempty" yaml:"managed_as,omitempty"` // Name under 'sm keys'
+	Type        string `json:"type,omitempty" yaml:"type,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty" yaml:"fingerprint,omitempty"`
+	Passphrase  string `json:"passphrase,omitempty" yaml:"passphrase,omitempty"` // A secret reference, not the passphrase
+	Error       string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// passwordReport describes the saved password of a connection without
+// revealing it, unless Value is filled in for --reveal.
+type passwordReport struct {
+	Stored      bool   `json:"stored" yaml:"stored"`
+	Encrypted   bool   `json:"encrypted" yaml:"encrypted"`
+	Decryptable *bool  `json:"decryptable,omitempty" yaml:"decryptable,omitempty"` // Only for encrypted passwords
+	Reference   string `json:"reference,omitempty" yaml:"reference,omitempty"`     // Secret reference, such as ref:env:NAME
+	Error       string `json:"error,omitempty" yaml:"error,omitempty"`
+	Value       string `json:"value,omitempty" yaml:"value,omitempty"`
+}
+
+// newConnectionReport describes the connection called name. With reveal, the
+// password is decrypted or its secret reference resolved.
+func newConnectionReport(cfg *models.AppConfig, name string, reveal bool) connectionReport {
+	resolved := cfg.Resolve(cfg.Connections[name])
+	conn := resolved.Connection
+
+	report := connectionReport{
+		ID:                    conn.ID,
+		Name:                  name,
+		Group:                 conn.Group,
+		Host:                  conn.Host,
+		Port:                  conn.Port,
+		User:                  conn.User,
+		Password:              newPasswordReport(conn.Password, reveal),
+		JumpHosts:             conn.JumpHosts,
+		StrictHostKeyChecking: conn.StrictHostKeyChecking,
+		ForwardAgent:          conn.ForwardAgent,
+		Forwards:              conn.Forwards,
+		Tags:                  conn.Tags,
+		Description:           conn.Description,
+		Extra:                 conn.Extra,
+		UseCount:              conn.UseCount,
+		Sources:               resolved.Sources,
+	}
+	if report.StrictHostKeyChecking == "" {
+		report.StrictHostKeyChecking = models.HostKeyCheckingAsk
+	}
+	if !conn.LastUsed.IsZero() {
+		report.LastUsed = &conn.LastUsed
+	}
+	if !conn.CreatedAt.IsZero() {
+		report.CreatedAt = &conn.CreatedAt
+	}
+
+	if conn.KeyPath != "" {
+		key := &keyReport{Path: conn.KeyPath, Passphrase: conn.KeyPassphrase}
+		for keyName, managed := range cfg.SSHKeys {
+			if managed.Path == conn.KeyPath && (key.Managed == "" || keyName < key.Managed) {
+				key.Managed = keyName
+			}
+		}
+		var err error
+		if key.Type, key.Fingerprint, err = ssh.DescribeKey(conn.KeyPath); err != nil {
+			key.Error = err.Error()
+		}
+		report.Key = key
+	}
+	return report
+}
+
+// newPasswordReport checks a saved password, which may be encrypted or a
+// secret reference.
+func newPasswordReport(value string, reveal bool) passwordReport {
+	report := passwordReport{Stored: value != ""}
+	if value == "" {
+		return report
+	}
+
+	plaintext, status, err := checkPassword(value)
+	switch status {
+	case passwordReference:
+		report.Reference = value
+		if reveal {
+			if plaintext, err = utils.ResolveSecret(value); err != nil {
+				report.Error = err.Error()
+			}
+		}
+	case passwordOK, passwordUndecryptable:
+		decryptable := status == passwordOK
+		report.Encrypted, report.Decryptable = true, &decryptable
+		if err != nil {
+			report.Error = err.Error()
+		}
+	case passwordPlaintext:
+	default:
+		// The key could not be obtained, so the password was not checked
+		report.Encrypted = true
+		report.Error = err.Error()
+	}
+	if reveal {
+		report.Value = plaintext
+	}
+	return report
+}
+
+// printConnectionReport prints report as aligned lines, with the source of
+// each inherited value.
+func printConnectionReport(report connectionReport) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	row := func(label, value, field string) {
+		source := ""
+		if s, ok := report.Sources[field]; ok && s != models.SourceConnection {
+			source = "from " + s
+		}
+		if value == "" {
+			value = "-"
+		}
+		fmt.Fprintf(w, "%s:\t%s\t%s\n", label, value, source)
+	}
+	timestamp := func(t *time.Time) string {
+		if t == nil {
+			return "never"
+		}
+		return t.Local().Format("2006-01-02 15:04:05")
+	}
+
+	row("Name", report.Name, "")
+	row("ID", fmt.Sprint(report.ID), "")
+	row("Group", report.Group, "")
+	row("Host", report.Host, "")
+	row("User", report.User, "user")
+	row("Port", fmt.Sprint(report.Port), "port")
+	if key := report.Key; key != nil {
+		path := key.Path
+		if key.Managed != "" {
+			path += " (managed as " + key.Managed + ")"
+		}
+		row("Key path", path, "key_path")
+		if key.Error != "" {
+			row("Key", "error: "+key.Error, "")
+		} else {
+			row("Key type", key.Type, "")
+			row("Key fingerprint", key.Fingerprint, "")
+		}
+		row("Key passphrase", key.Passphrase, "")
+	} else {
+		row("Key path", "", "key_path")
+	}
+	row("Password", describePasswordReport(report.Password), "")
+	if report.Password.Value != "" {
+		row("Password value", report.Password.Value, "")
+	}
+	row("Jump hosts", strings.Join(report.JumpHosts, " -> "), "jump_hosts")
+	row("Host key check", report.StrictHostKeyChecking, "")
+	row("Forward agent", yesNo(report.ForwardAgent), "")
+	for i, f := range report.Forwards {
+		label := "Tunnels"
+		if i > 0 {
+			label = ""
+		}
+		row(label, fmt.Sprintf("%s (%s %s)", f.Name, f.Type, f.Spec), "")
+	}
+	row("Tags", strings.Join(report.Tags, ", "), "tags")
+	row("Description", report.Description, "")
+	extra := make([]string, 0, len(report.Extra))
+	for k, v := range report.Extra {
+		extra = append(extra, k+"="+v)
+	}
+	sort.Strings(extra)
+	row("Extra", strings.Join(extra, ", "), "")
+	row("Last used", timestamp(report.LastUsed), "")
+	row("Use count", fmt.Sprint(report.UseCount), "")
+	row("Created", timestamp(report.CreatedAt), "")
+	w.Flush()
+}
+
+// describePasswordReport says in words how a password is saved.
+func describePasswordReport(p passwordReport) string {
+	switch {
+	case !p.Stored:
+		return "not stored"
+	case p.Reference != "" && p.Error != "":
+		return "reference " + p.Reference + ", cannot be resolved: " + p.Error
+	case p.Reference != "":
+		return "reference " + p.Reference
+	case !p.Encrypted:
+		return "stored, not encrypted (see 'sm secrets encrypt-all')"
+	case p.Decryptable == nil:
+		return "stored, encrypted, not checked: " + p.Error
+	case *p.Decryptable:
+		return "stored, encrypted, decryptable"
+	default:
+		return "stored, encrypted, cannot be decrypted (see 'sm secrets verify')"
+	}
+}
+
+// yesNo formats a flag for people.
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func init() {
+	rootCmd.AddCommand(showCmd)
+
+	showCmd.Flags().StringP("format", "f", "text", "Output format (text, json, yaml)")
+	showCmd.Flags().Bool("reveal", false, "Include the password, decrypted or resolved from its secret reference")
+}
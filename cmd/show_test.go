@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"sm/internal/models"
+)
+
+func TestNewConnectionReport(t *testing.T) {
+	t.Setenv("SM_TEST_PASSWORD", "s3cret")
+	missingKey := filepath.Join(t.TempDir(), "id_missing")
+	used := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	cfg := &models.AppConfig{
+		Connections: map[string]models.Connection{
+			"web": {ID: 4, Name: "web", Host: "10.0.0.1", Group: "prod", Password: "ref:env:SM_TEST_PASSWORD", LastUsed: used, UseCount: 3},
+			"db":  {ID: 5, Name: "db", Host: "10.0.0.2", User: "pg", Password: "hunter2", StrictHostKeyChecking: models.HostKeyCheckingYes},
+		},
+		SSHKeys: map[string]models.SSHKey{
+			"prod": {Name: "prod", Path: missingKey},
+			"alt":  {Name: "alt", Path: missingKey},
+		},
+		Groups: map[string]models.Group{"prod": {User: "deploy", KeyPath: missingKey}},
+	}
+
+	web := newConnectionReport(cfg, "web", false)
+	if web.User != "deploy" || web.Port != 22 || web.Sources["user"] != "group prod" || web.Sources["port"] != models.SourceBuiltIn {
+		t.Errorf("report = %+v, want the inherited user and port with their sources", web)
+	}
+	if web.Key == nil || web.Key.Path != missingKey || web.Key.Managed != "alt" || web.Key.Error == "" {
+		t.Errorf("key = %+v, want the group's key, managed as alt, with an error", web.Key)
+	}
+	if web.StrictHostKeyChecking != models.HostKeyCheckingAsk || web.LastUsed == nil || !web.LastUsed.Equal(used) || web.CreatedAt != nil {
+		t.Errorf("report = %+v, want the default host key check, the last use and no creation time", web)
+	}
+	want := passwordReport{Stored: true, Reference: "ref:env:SM_TEST_PASSWORD"}
+	if !reflect.DeepEqual(web.Password, want) {
+		t.Errorf("password = %+v, want %+v", web.Password, want)
+	}
+	if got := newConnectionReport(cfg, "web", true).Password.Value; got != "s3cret" {
+		t.Errorf("revealed password = %q, want the resolved reference", got)
+	}
+
+	db := newConnectionReport(cfg, "db", false)
+	if db.Key != nil || db.StrictHostKeyChecking != models.HostKeyCheckingYes || db.Sources["user"] != models.SourceConnection {
+		t.Errorf("report = %+v, want no key and the connection's own settings", db)
+	}
+	if want := (passwordReport{Stored: true}); !reflect.DeepEqual(db.Password, want) {
+		t.Errorf("password = %+v, want %+v", db.Password, want)
+	}
+	if got := newConnectionReport(cfg, "db", true).Password.Value; got != "hunter2" {
+		t.Errorf("revealed password = %q, want hunter2", got)
+	}
+}
+
+func TestDescribePasswordReport(t *testing.T) {
+	yes, no := true, false
+	tests := []struct {
+		report passwordReport
+		want   string
+	}{
+		{passwordReport{}, "not stored"},
+		{passwordReport{Stored: true}, "stored, not encrypted (see 'sm secrets encrypt-all')"},
+		{passwordReport{Stored: true, Reference: "ref:env:PW"}, "reference ref:env:PW"},
+		{passwordReport{Stored: true, Reference: "ref:env:PW", Error: "PW is not set"}, "reference ref:env:PW, cannot be resolved: PW is not set"},
+		{passwordReport{Stored: true, Encrypted: true, Decryptable: &yes}, "stored, encrypted, decryptable"},
+		{passwordReport{Stored: true, Encrypted: true, Decryptable: &no}, "stored, encrypted, cannot be decrypted (see 'sm secrets verify')"},
+		{passwordReport{Stored: true, Encrypted: true, Error: "no keyring"}, "stored, encrypted, not checked: no keyring"},
+	}
+	for _, tt := range tests {
+		if got := describePasswordReport(tt.report); got != tt.want {
+			t.Errorf("describePasswordReport(%+v) = %q, want %q", tt.report, got, tt.want)
+		}
+	}
+}
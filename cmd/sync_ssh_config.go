@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"sm/internal/config"
+)
+
+// syncSSHConfigCmd represents the sync-ssh-config command
+var syncSSHConfigCmd = &cobra.Command{
+	Use:   "sync-ssh-config",
+	Short: "Make saved connections available to ssh, scp and other OpenSSH tools",
+	Long: `Writes every saved connection as an OpenSSH Host block to a file managed by sm
+and adds an Include for it at the top of ~/.ssh/config. The file is ssh_config in
+the sm config directory ($XDG_CONFIG_HOME/sm or ~/.config/sm), or in
+configs/<name>-<hash>/ there when --config or SM_CONFIG choose another config
+file; its path is printed when it is written.
+Plain ssh, scp, rsync, git over ssh and editors such as VS Code Remote can then
+connect to any saved connection by name.
+
+Once enabled, the managed file is rewritten every time sm saves its connections.
+Use --remove to delete the managed file and the Include line.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		managed, err := config.ManagedSSHConfigPath()
+		if err != nil {
+			return err
+		}
+
+		if remove, _ := cmd.Flags().GetBool("remove"); remove {
+			changed, err := config.RemoveSSHConfigInclude()
+			if err != nil {
+				return err
+			}
+			if changed {
+				fmt.Println("Removed the Include line from ~/.ssh/config")
+			}
+			if err := os.Remove(managed); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove %s: %w", managed, err)
+			}
+			fmt.Printf("Stopped syncing connections to %s\n", managed)
+			return nil
+		}
+
+		cfg, err := config.GetConfig()
+		if err != nil {
+			return fmt.Errorf("failed to get config: %w", err)
+		}
+
+		if err := config.WriteManagedSSHConfig(cfg); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote %d connection(s) to %s\n", len(cfg.Connections), managed)
+
+		changed, err := config.AddSSHConfigInclude()
+		if err != nil {
+			return err
+		}
+		if changed {
+			fmt.Println("Added an Include line to ~/.ssh/config")
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(syncSSHConfigCmd)
+
+	syncSSHConfigCmd.Flags().Bool("remove", false, "Stop syncing: delete the managed file and its Include line")
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"sm/internal/models"
+	"sm/internal/query"
+)
+
+// tagCmd represents the tag command
+var tagCmd = &cobra.Command{
+	Use:   "tag",
+	Short: "Add, remove and rename connection tags",
+	Long: `Manages the tags of many connections at once. The connections are given by
+name or ID, or selected with a filter expression as in 'sm list', for example
+--where 'host:10.0.* AND user:root'. As in 'sm list', the filter sees the values
+that connections inherit from their groups.
+
+Tags that a connection inherits from its group belong to the group: change them
+with 'sm group set --tag'. 'sm tag rename', and 'sm tag rm' without connections,
+change the tags of groups too.`,
+}
+
+// containsString reports whether list contains s.
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// tagTargets returns the names of the connections given by identifiers and
+// selected by the filter expression where, sorted and without repeats.
+func tagTargets(cfg *models.AppConfig, identifiers []string, where string) ([]string, error) {
+	seen := make(map[string]bool)
+	for _, identifier := range identifiers {
+		_, name, err := findConnection(cfg, identifier)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", identifier, err)
+		}
+		seen[name] = true
+	}
+	if where != "" {
+		filter, err := query.Parse(where)
+		if err != nil {
+			return nil, err
+		}
+		for name, conn := range cfg.Connections {
+			if filter.Match(cfg.Resolve(conn).Connection) {
+				seen[name] = true
+			}
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// describeNames lists names for a message, such as "2 connections (db, web)".
+func describeNames(names []string) string {
+	if len(names) == 1 {
+		return "1 connection (" + names[0] + ")"
+	}
+	return fmt.Sprintf("%d connections (%s)", len(names), strings.Join(names, ", "))
+}
+
+func init() {
+	rootCmd.AddCommand(tagCmd)
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"sm/internal/config"
+	"sm/internal/models"
+)
+
+// tagAddCmd represents the add command for tags
+var tagAddCmd = &cobra.Command{
+	Use:   "add <tag> [name_or_id...]",
+	Short: "Add a tag to connections",
+	Long: `Adds a tag to the given connections and to those matching --where.
+
+Examples:
+  sm tag add prod web db
+  sm tag add internal --where 'host:10.*'`,
+	Args:         cobra.MinimumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		tag := args[0]
+		where, _ := cmd.Flags().GetString("where")
+
+		if _, err := models.CleanTags([]string{tag}); err != nil {
+			return err
+		}
+		if len(args) == 1 && where == "" {
+			return errors.New("give the connections to tag, or select them with --where")
+		}
+
+		var tagged []string
+		err := config.Update(func(cfg *models.AppConfig) error {
+			names, err := tagTargets(cfg, args[1:], where)
+			if err != nil {
+				return err
+			}
+			tagged = tagged[:0]
+			for _, name := range names {
+				conn := cfg.Connections[name]
+				if conn.HasTag(tag) {
+					continue
+				}
+				conn.Tags = append(conn.Tags, tag)
+				cfg.Connections[name] = conn
+				tagged = append(tagged, name)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if len(tagged) == 0 {
+			fmt.Printf("No connections to tag: they already have tag '%s' or none matched.\n", tag)
+			return nil
+		}
+		fmt.Printf("Added tag '%s' to %s\n", tag, describeNames(tagged))
+		return nil
+	},
+}
+
+func init() {
+	tagCmd.AddCommand(tagAddCmd)
+
+	tagAddCmd.Flags().String("where", "", "Also tag the connections matching this filter expression, as in 'sm list'")
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"sm/internal/config"
+)
+
+// tagListCmd represents the list command for tags
+var tagListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List tags and the connections that have them",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.GetConfig()
+		if err != nil {
+			return fmt.Errorf("failed to get config: %w", err)
+		}
+
+		byTag := make(map[string][]string)
+		// Counted as in 'sm list --tag', with the tags inherited from groups
+		for name, conn := range cfg.Connections {
+			for _, tag := range cfg.Resolve(conn).Tags {
+				byTag[tag] = append(byTag[tag], name)
+			}
+		}
+		if len(byTag) == 0 {
+			fmt.Println("No tags found. Use 'sm tag add' or 'sm add --tag' to tag connections.")
+			return nil
+		}
+
+		tags := make([]string, 0, len(byTag))
+		for tag := range byTag {
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "TAG\tCOUNT\tCONNECTIONS")
+		for _, tag := range tags {
+			names := byTag[tag]
+			sort.Strings(names)
+			fmt.Fprintf(w, "%s\t%d\t%s\n", tag, len(names), strings.Join(names, ", "))
+		}
+		w.Flush()
+
+		return nil
+	},
+}
+
+func init() {
+	tagCmd.AddCommand(tagListCmd)
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"sm/internal/config"
+	"sm/internal/models"
+)
+
+// tagRenameCmd represents the rename command for tags
+var tagRenameCmd = &cobra.Command{
+	Use:   "rename <old> <new>",
+	Short: "Rename a tag on every connection",
+	Long: `Renames a tag on every connection and every group that has it. Connections and
+groups that already have the new tag keep a single copy of it.`,
+	Args:         cobra.ExactArgs(2),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		oldTag, newTag := args[0], args[1]
+
+		if _, err := models.CleanTags([]string{newTag}); err != nil {
+			return err
+		}
+		if oldTag == newTag {
+			return fmt.Errorf("the tag is already named '%s'", newTag)
+		}
+
+		var renamed, groups []string
+		err := config.Update(func(cfg *models.AppConfig) error {
+			renamed, groups = renamed[:0], groups[:0]
+			for name, conn := range cfg.Connections {
+				if conn.HasTag(oldTag) {
+					conn.Tags = renameTag(conn.Tags, oldTag, newTag)
+					cfg.Connections[name] = conn
+					renamed = append(renamed, name)
+				}
+			}
+			for path, group := range cfg.Groups {
+				if containsString(group.Tags, oldTag) {
+					group.Tags = renameTag(group.Tags, oldTag, newTag)
+					cfg.Groups[path] = group
+					groups = append(groups, path)
+				}
+			}
+			if len(renamed) == 0 && len(groups) == 0 {
+				return fmt.Errorf("no connection or group has tag '%s'", oldTag)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		sort.Strings(renamed)
+		sort.Strings(groups)
+		if len(renamed) > 0 {
+			fmt.Printf("Renamed tag '%s' to '%s' on %s\n", oldTag, newTag, describeNames(renamed))
+		}
+		if len(groups) > 0 {
+			fmt.Printf("Renamed tag '%s' to '%s' on group(s) %s\n", oldTag, newTag, strings.Join(groups, ", "))
+		}
+		return nil
+	},
+}
+
+// renameTag replaces oldTag with newTag in tags, keeping a single copy of newTag.
+func renameTag(tags []string, oldTag, newTag string) []string {
+	var renamed []string
+	for _, tag := range tags {
+		if tag == oldTag {
+			tag = newTag
+		}
+		if !containsString(renamed, tag) {
+			renamed = append(renamed, tag)
+		}
+	}
+	return renamed
+}
+
+func init() {
+	tagCmd.AddCommand(tagRenameCmd)
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"sm/internal/config"
+	"sm/internal/models"
+)
+
+// tagRmCmd represents the rm command for tags
+var tagRmCmd = &cobra.Command{
+	Use:   "rm <tag> [name_or_id...]",
+	Short: "Remove a tag from connections",
+	Long: `Removes a tag from the given connections and from those matching --where.
+Without either, the tag is removed from every connection and every group.
+
+A connection keeps a tag that it inherits from its group; remove it from the
+group with 'sm group set --tag', or from everywhere with 'sm tag rm <tag>'.
+
+Examples:
+  sm tag rm prod web
+  sm tag rm legacy`,
+	Args:         cobra.MinimumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		tag := args[0]
+		where, _ := cmd.Flags().GetString("where")
+		everywhere := len(args) == 1 && where == ""
+
+		var untagged, groups, inherited []string
+		err := config.Update(func(cfg *models.AppConfig) error {
+			var names []string
+			if everywhere {
+				for name := range cfg.Connections {
+					names = append(names, name)
+				}
+			} else {
+				var err error
+				if names, err = tagTargets(cfg, args[1:], where); err != nil {
+					return err
+				}
+			}
+
+			untagged, groups, inherited = untagged[:0], groups[:0], inherited[:0]
+			if everywhere {
+				for path, group := range cfg.Groups {
+					if containsString(group.Tags, tag) {
+						group.Tags = removeString(group.Tags, tag)
+						cfg.Groups[path] = group
+						groups = append(groups, path)
+					}
+				}
+			}
+			for _, name := range names {
+				conn := cfg.Connections[name]
+				if conn.HasTag(tag) {
+					conn.Tags = removeString(conn.Tags, tag)
+					cfg.Connections[name] = conn
+					untagged = append(untagged, name)
+				}
+				if cfg.Resolve(conn).HasTag(tag) {
+					inherited = append(inherited, name)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		sort.Strings(untagged)
+		sort.Strings(groups)
+		sort.Strings(inherited)
+		switch {
+		case len(untagged) > 0:
+			fmt.Printf("Removed tag '%s' from %s\n", tag, describeNames(untagged))
+		case len(groups) == 0:
+			fmt.Printf("No connections had tag '%s'.\n", tag)
+		}
+		if len(groups) > 0 {
+			fmt.Printf("Removed tag '%s' from group(s) %s\n", tag, strings.Join(groups, ", "))
+		}
+		if len(inherited) > 0 {
+			fmt.Printf("Note: tag '%s' is still inherited from a group by %s. Remove it with 'sm group set <group> --tag', or everywhere with 'sm tag rm %s'.\n", tag, strings.Join(inherited, ", "), tag)
+		}
+		return nil
+	},
+}
+
+// removeString returns list without s. It returns nil rather than an empty
+// list, so that empty tags are left out of the configuration file.
+func removeString(list []string, s string) []string {
+	var kept []string
+	for _, item := range list {
+		if item != s {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
+
+func init() {
+	tagCmd.AddCommand(tagRmCmd)
+
+	tagRmCmd.Flags().String("where", "", "Also remove the tag from the connections matching this filter expression, as in 'sm list'")
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"sm/internal/models"
+)
+
+func TestTagTargets(t *testing.T) {
+	cfg := &models.AppConfig{
+		Connections: map[string]models.Connection{
+			"web": {ID: 1, Name: "web", Host: "10.0.0.1", Group: "prod"},
+			"db":  {ID: 2, Name: "db", Host: "10.0.0.2", User: "pg"},
+			"dev": {ID: 3, Name: "dev", Host: "10.0.1.1", Tags: []string{"dev"}},
+		},
+		Groups: map[string]models.Group{"prod": {User: "deploy", Tags: []string{"prod"}}},
+	}
+	tests := []struct {
+		identifiers []string
+		where       string
+		want        []string
+		err         string
+	}{
+		{identifiers: []string{"web", "2", "web"}, want: []string{"db", "web"}},
+		{where: "host:10.0.0.*", want: []string{"db", "web"}},
+		// The filter sees what connections inherit from their groups
+		{where: "tag:prod", want: []string{"web"}},
+		{where: "user:deploy", want: []string{"web"}},
+		{identifiers: []string{"dev"}, where: "user:pg", want: []string{"db", "dev"}},
+		{where: "nothing", want: []string{}},
+		{identifiers: []string{"nope"}, err: "nope: connection with this name or ID does not exist"},
+		{where: "color:red", err: "unknown field 'color'"},
+	}
+	for _, tt := range tests {
+		got, err := tagTargets(cfg, tt.identifiers, tt.where)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("tagTargets(%q, %q) error = %v, want it to contain %q", tt.identifiers, tt.where, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("tagTargets(%q, %q) = %q, %v, want %q", tt.identifiers, tt.where, got, err, tt.want)
+		}
+	}
+}
+
+func TestRenameTag(t *testing.T) {
+	tests := []struct {
+		tags []string
+		want []string
+	}{
+		{[]string{"a", "old", "b"}, []string{"a", "new", "b"}},
+		{[]string{"new", "old"}, []string{"new"}},
+		{[]string{"old", "x", "new"}, []string{"new", "x"}},
+		{[]string{"x"}, []string{"x"}},
+	}
+	for _, tt := range tests {
+		if got := renameTag(tt.tags, "old", "new"); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("renameTag(%q) = %q, want %q", tt.tags, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"sm/internal/ui"
+)
+
+// uiCmd represents the ui command
+var uiCmd = &cobra.Command{
+	Use:   "ui",
+	Short: "Manage connections, keys and tunnels in a full-screen interface",
+	Long: `Opens a full-screen terminal interface with tabs for connections, keys and tunnels.
+Changes are saved to the configuration file right away, as with the other commands.
+
+Connections: Enter connect, a add, e edit, c clone, d delete, t tag, x test, / filter
+Keys:        g generate an ed25519 key in ~/.ssh, d stop managing a key
+Tunnels:     Enter start or stop, a add, d delete
+
+Switch tabs with Tab or 1-3, and quit with q. Tunnels started from the interface are
+closed when it exits.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !isInteractive() {
+			return fmt.Errorf("sm ui needs a terminal")
+		}
+		return ui.Run()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(uiCmd)
+}
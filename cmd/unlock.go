@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/spf13/cobra"
+	"sm/internal/config"
+	"sm/internal/models"
+	"sm/internal/utils"
+)
+
+// agentStartTimeout is how long unlock waits for a newly started agent.
+const agentStartTimeout = 3 * time.Second
+
+// unlockCmd represents the unlock command
+var unlockCmd = &cobra.Command{
+	Use:   "unlock",
+	Short: "Unlock saved passwords with the master password for a while",
+	Long: `Asks for the master password and keeps the derived key in a small background
+agent, so that connections with saved passwords can be used without typing it again
+until the timeout expires or 'sm lock' is run.
+
+Only needed when passwords are encrypted with a master password instead of the OS
+keyring (see 'sm config encryption').`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+		if timeout < time.Second {
+			return errors.New("--timeout must be at least 1s")
+		}
+
+		cfg, err := config.GetConfig()
+		if err != nil {
+			return fmt.Errorf("failed to get config: %w", err)
+		}
+		settings := cfg.Settings.Encryption
+		if settings.KeySource != models.KeySourceMasterPassword {
+			return errors.New("passwords are encrypted with the OS keyring, so there is nothing to unlock. Use 'sm config encryption master-password' to use a master password instead")
+		}
+
+		password, err := utils.ReadPassword("Master password: ")
+		if err != nil {
+			return err
+		}
+		key, err := utils.DeriveMasterKey(settings, password)
+		if err != nil {
+			return err
+		}
+
+		if err := startUnlockAgent(); err != nil {
+			return err
+		}
+		if err := utils.AgentStore(settings.Salt, key, timeout); err != nil {
+			return err
+		}
+
+		fmt.Printf("Unlocked until %s. Run 'sm lock' to lock again.\n", time.Now().Add(timeout).Format("15:04:05"))
+		return nil
+	},
+}
+
+// lockCmd represents the lock command
+var lockCmd = &cobra.Command{
+	Use:   "lock",
+	Short: "Forget the unlocked master password",
+	Long:  `Stops the unlock agent started by 'sm unlock', wiping the keys it holds.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		running, err := utils.AgentLock()
+		if err != nil {
+			return err
+		}
+		if !running {
+			fmt.Println("Already locked.")
+			return nil
+		}
+		fmt.Println("Locked.")
+		return nil
+	},
+}
+
+// unlockAgentCmd runs the unlock agent. It is started in the background by
+// 'sm unlock' and not meant to be run by hand.
+var unlockAgentCmd = &cobra.Command{
+	Use:    "unlock-agent",
+	Short:  "Run the unlock agent (started automatically by 'sm unlock')",
+	Args:   cobra.NoArgs,
+	Hidden: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return utils.ServeAgent()
+	},
+}
+
+// startUnlockAgent starts the unlock agent in the background unless it is
+// already running, and waits until it accepts requests.
+func startUnlockAgent() error {
+	if utils.AgentRunning() {
+		return nil
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find the sm executable: %w", err)
+	}
+	agent := exec.Command(exe, unlockAgentCmd.Name())
+	detachProcess(agent)
+	if err := agent.Start(); err != nil {
+		return fmt.Errorf("failed to start unlock agent: %w", err)
+	}
+	agent.Process.Release()
+
+	for deadline := time.Now().Add(agentStartTimeout); time.Now().Before(deadline); {
+		if utils.AgentRunning() {
+			return nil
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return errors.New("unlock agent did not start")
+}
+
+func init() {
+	rootCmd.AddCommand(unlockCmd)
+	rootCmd.AddCommand(lockCmd)
+	rootCmd.AddCommand(unlockAgentCmd)
+
+	unlockCmd.Flags().Duration("timeout", 15*time.Minute, "How long to stay unlocked")
+}
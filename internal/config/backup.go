@@ -0,0 +1,171 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"sm/internal/models"
+)
+
+// DefaultBackupCount is the number of configuration backups kept when
+// Settings.Backups is not set.
+const DefaultBackupCount = 10
+
+const (
+	backupPrefix     = "config-"
+	backupSuffix     = ".yaml"
+	backupTimeFormat = "20060102-150405.000"
+)
+
+// Backup is a saved copy of the configuration file, taken before it was overwritten.
+type Backup struct {
+	Name string    // File name, e.g. config-20240102-150405.000.yaml
+	Path string    // Full path of the file
+	Time time.Time // When the backup was taken
+}
+
+// BackupDir returns the directory that holds the backups of the configuration
+// file in use.
+func BackupDir() (string, error) {
+	return configFileStatePath("backups")
+}
+
+// ListBackups returns the configuration backups, newest first.
+func ListBackups() ([]Backup, error) {
+	dir, err := BackupDir()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+
+	var backups []Backup
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, backupPrefix) || !strings.HasSuffix(name, backupSuffix) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, backupPrefix), backupSuffix)
+		t, err := time.ParseInLocation(backupTimeFormat, stamp, time.Local)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, Backup{Name: name, Path: filepath.Join(dir, name), Time: t})
+	}
+
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Time.After(backups[j].Time) })
+	return backups, nil
+}
+
+// LoadBackup reads the configuration saved in backup. Backups written by
+// older versions of sm are migrated as GetConfig migrates the file itself.
+func LoadBackup(backup Backup) (*models.AppConfig, error) {
+	cfg, _, _, err := readBackup(backup)
+	return cfg, err
+}
+
+// readBackup reads and migrates backup, returning the migrated contents too.
+func readBackup(backup Backup) (*models.AppConfig, MigrationResult, []byte, error) {
+	data, err := os.ReadFile(backup.Path)
+	if err != nil {
+		return nil, MigrationResult{}, nil, fmt.Errorf("failed to read backup %s: %w", backup.Name, err)
+	}
+	if len(data) == 0 {
+		return nil, MigrationResult{}, nil, fmt.Errorf("backup %s is empty", backup.Name)
+	}
+	cfg, migration, migrated, err := decodeConfig(data)
+	if err != nil {
+		return nil, migration, nil, fmt.Errorf("backup %s is not a valid config: %w", backup.Name, err)
+	}
+	return cfg, migration, migrated, nil
+}
+
+// RestoreBackup replaces the configuration with the contents of backup,
+// upgraded to the current schema if an older version of sm wrote it. The
+// current configuration is itself backed up first, so a restore can be undone.
+func RestoreBackup(backup Backup) (*models.AppConfig, error) {
+	restored, migration, data, err := readBackup(backup)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock, err := lockConfig()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if err := writeConfigFile(data, true); err != nil {
+		return nil, err
+	}
+	if managedSSHConfigEnabled() {
+		if err := WriteManagedSSHConfig(restored); err != nil {
+			return nil, fmt.Errorf("failed to update managed ssh config: %w", err)
+		}
+	}
+
+	if migration.Needed() {
+		fmt.Fprintf(os.Stderr, "Upgraded backup %s from version %d to %d\n", backup.Name, migration.From, migration.To)
+	}
+	return restored, nil
+}
+
+// backupConfigFile copies configFile into the backup directory and removes
+// the oldest backups beyond the configured count. A missing or empty file is
+// not backed up.
+func backupConfigFile(configFile string) error {
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read config file for backup: %w", err)
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	// The count lives in the file being backed up
+	var current models.AppConfig
+	yaml.Unmarshal(data, &current)
+	keep := current.Settings.Backups
+	if keep == 0 {
+		keep = DefaultBackupCount
+	}
+	if keep < 0 {
+		return nil
+	}
+
+	dir, err := BackupDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("could not create backup directory: %w", err)
+	}
+
+	name := backupPrefix + time.Now().Format(backupTimeFormat) + backupSuffix
+	if err := writeFileAtomic(filepath.Join(dir, name), data, 0600); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+
+	backups, err := ListBackups()
+	if err != nil {
+		return err
+	}
+	for _, old := range backups[min(keep, len(backups)):] {
+		os.Remove(old.Path)
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"sm/internal/models"
+)
+
+// useTempConfig points the configuration at an empty directory for the test.
+func useTempConfig(t *testing.T) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", home+"/.config")
+	t.Setenv(configFileEnv, "")
+	SetConfigFile("")
+}
+
+// updateHost saves a connection called web with host, waiting first so that
+// every backup gets its own time stamp.
+func updateHost(t *testing.T, host string) {
+	t.Helper()
+	time.Sleep(2 * time.Millisecond)
+	err := Update(func(cfg *models.AppConfig) error {
+		cfg.Connections["web"] = models.Connection{Name: "web", Host: host}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+}
+
+// backupHosts returns the host of web in each backup, newest first.
+func backupHosts(t *testing.T) []string {
+	t.Helper()
+	backups, err := ListBackups()
+	if err != nil {
+		t.Fatalf("ListBackups failed: %v", err)
+	}
+	var hosts []string
+	for _, b := range backups {
+		data, err := os.ReadFile(b.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var cfg models.AppConfig
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			t.Fatalf("backup %s is not a valid config: %v", b.Name, err)
+		}
+		hosts = append(hosts, cfg.Connections["web"].Host)
+	}
+	return hosts
+}
+
+func TestBackupRotation(t *testing.T) {
+	tests := []struct {
+		backups int // settings.backups
+		saves   int
+		want    []string // Hosts in the backups, newest first; "" is the first file
+	}{
+		{backups: 3, saves: 2, want: []string{"host-1", ""}},
+		{backups: 3, saves: 6, want: []string{"host-5", "host-4", "host-3"}},
+		{backups: 1, saves: 4, want: []string{"host-3"}},
+		{backups: -1, saves: 4, want: nil},
+		{backups: 0, saves: 12, want: []string{"host-11", "host-10", "host-9", "host-8", "host-7", "host-6", "host-5", "host-4", "host-3", "host-2"}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("keep %d after %d saves", tt.backups, tt.saves), func(t *testing.T) {
+			useTempConfig(t)
+			// A missing file has nothing to back up
+			err := Update(func(cfg *models.AppConfig) error {
+				cfg.Settings.Backups = tt.backups
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Update failed: %v", err)
+			}
+			for i := 1; i <= tt.saves; i++ {
+				updateHost(t, fmt.Sprintf("host-%d", i))
+			}
+
+			if got := backupHosts(t); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("backups hold %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRestoreBackup(t *testing.T) {
+	useTempConfig(t)
+	for i := 1; i <= 3; i++ {
+		updateHost(t, fmt.Sprintf("host-%d", i))
+	}
+	backups, err := ListBackups()
+	if err != nil || len(backups) != 2 {
+		t.Fatalf("ListBackups() = %v, %v, want 2 backups", backups, err)
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	restored, err := RestoreBackup(backups[1])
+	if err != nil {
+		t.Fatalf("RestoreBackup failed: %v", err)
+	}
+	if host := restored.Connections["web"].Host; host != "host-1" {
+		t.Errorf("restored host = %q, want host-1", host)
+	}
+	cfg, err := GetConfig()
+	if err != nil || cfg.Connections["web"].Host != "host-1" {
+		t.Errorf("config after restore = %+v, %v, want host-1", cfg, err)
+	}
+
+	// The restore can be undone from the backup it took
+	if got := backupHosts(t); fmt.Sprint(got) != fmt.Sprint([]string{"host-3", "host-2", "host-1"}) {
+		t.Errorf("backups after restore hold %q, want the replaced config first", got)
+	}
+}
+
+func TestRestoreInvalidBackup(t *testing.T) {
+	useTempConfig(t)
+	updateHost(t, "host-1")
+	updateHost(t, "host-2")
+	backups, _ := ListBackups()
+	if len(backups) != 1 {
+		t.Fatalf("got %d backups, want 1", len(backups))
+	}
+	if err := os.WriteFile(backups[0].Path, []byte("connections: [\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := RestoreBackup(backups[0]); err == nil {
+		t.Fatal("RestoreBackup of an invalid file succeeded")
+	}
+	cfg, err := GetConfig()
+	if err != nil || cfg.Connections["web"].Host != "host-2" {
+		t.Errorf("config after a failed restore = %+v, %v, want it unchanged", cfg, err)
+	}
+}
+
+func TestBackupDirPerConfigFile(t *testing.T) {
+	useTempConfig(t)
+	home := os.Getenv("HOME")
+	defaultDir := filepath.Join(home, ".config", "sm")
+
+	tests := []struct {
+		name string
+		set  func()
+		want string // Pattern of the backup directory
+	}{
+		{"default file", func() {}, filepath.Join(defaultDir, "backups")},
+		{"--config", func() { SetConfigFile(filepath.Join(home, "sync", "work.yaml")) }, filepath.Join(defaultDir, "configs", "work-????????", "backups")},
+		{"SM_CONFIG", func() { t.Setenv(configFileEnv, "~/other/home.yaml") }, filepath.Join(defaultDir, "configs", "home-????????", "backups")},
+		{"default file given explicitly", func() { SetConfigFile(filepath.Join(defaultDir, "config.yaml")) }, filepath.Join(defaultDir, "backups")},
+	}
+	seen := make(map[string]string)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetConfigFile("")
+			t.Setenv(configFileEnv, "")
+			tt.set()
+			t.Cleanup(func() { SetConfigFile("") })
+
+			dir, err := BackupDir()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok, _ := filepath.Match(tt.want, dir); !ok {
+				t.Errorf("BackupDir() = %s, want %s", dir, tt.want)
+			}
+			file, _ := ConfigFile()
+			if other, ok := seen[dir]; ok && other != file {
+				t.Errorf("%s and %s share the backup directory %s", other, file, dir)
+			}
+			seen[dir] = file
+		})
+	}
+}
+
+func TestRecordUseKeepsBackups(t *testing.T) {
+	useTempConfig(t)
+	for i := 1; i <= 3; i++ {
+		updateHost(t, fmt.Sprintf("host-%d", i))
+	}
+	before := backupHosts(t)
+
+	for i := 0; i < DefaultBackupCount+2; i++ {
+		time.Sleep(2 * time.Millisecond)
+		if err := RecordUse("web"); err != nil {
+			t.Fatalf("RecordUse failed: %v", err)
+		}
+	}
+
+	if got := backupHosts(t); fmt.Sprint(got) != fmt.Sprint(before) {
+		t.Errorf("backups after connecting hold %q, want %q", got, before)
+	}
+	cfg, err := GetConfig()
+	if err != nil || cfg.Connections["web"].UseCount != DefaultBackupCount+2 {
+		t.Errorf("config = %+v, %v, want the uses recorded", cfg, err)
+	}
+}
+
+func TestRestoreOldBackup(t *testing.T) {
+	useTempConfig(t)
+	updateHost(t, "host-1")
+	dir, err := BackupDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	// Written by a version of sm that saved created_at as a Unix time
+	old := Backup{Name: backupPrefix + "20200102-030405.000" + backupSuffix}
+	old.Path = filepath.Join(dir, old.Name)
+	data := "next_id: 2\nconnections:\n  web: {id: 1, name: web, host: old-host, created_at: 1700000000}\n"
+	if err := os.WriteFile(old.Path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadBackup(old)
+	if err != nil || loaded.Connections["web"].Host != "old-host" {
+		t.Fatalf("LoadBackup() = %+v, %v, want the old config", loaded, err)
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	restored, err := RestoreBackup(old)
+	if err != nil {
+		t.Fatalf("RestoreBackup failed: %v", err)
+	}
+	if web := restored.Connections["web"]; web.Host != "old-host" || !web.CreatedAt.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("restored connection = %+v, want old-host created at 1700000000", web)
+	}
+
+	// The file is saved in the current schema
+	result, err := PlanMigration()
+	if err != nil || result.Needed() {
+		t.Errorf("PlanMigration() = %+v, %v, want the restored file upgraded", result, err)
+	}
+	cfg, err := GetConfig()
+	if err != nil || cfg.Version != CurrentVersion || cfg.Connections["web"].Host != "old-host" {
+		t.Errorf("config after restore = %+v, %v, want old-host at version %d", cfg, err, CurrentVersion)
+	}
+}
@@ -0,0 +1,164 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/scrypt"
+	"gopkg.in/yaml.v3"
+	"sm/internal/models"
+)
+
+// A bundle is an export of the configuration that can be moved to another
+// machine. Its saved passwords are decrypted, and the whole configuration is
+// encrypted with a passphrase instead, using scrypt and AES-256-GCM.
+
+const (
+	bundleVersion = 1
+	bundleKDF     = "scrypt"
+	bundleHeader  = "# sm export bundle, encrypted with a passphrase. Import it with 'sm import <file>'.\n"
+)
+
+// scrypt parameters for new bundles. They are stored in the bundle, so they
+// can be raised later without breaking older bundles.
+const (
+	bundleScryptN = 1 << 15
+	bundleScryptR = 8
+	bundleScryptP = 1
+	bundleSaltLen = 16
+	bundleKeyLen  = 32
+)
+
+// ErrWrongBundlePassphrase is returned when a bundle cannot be decrypted with
+// the given passphrase.
+var ErrWrongBundlePassphrase = errors.New("wrong passphrase, or the bundle is damaged")
+
+// bundleFile is the on-disk layout of a bundle.
+type bundleFile struct {
+	Bundle int    `yaml:"sm_bundle"`
+	KDF    string `yaml:"kdf"`
+	N      int    `yaml:"scrypt_n"`
+	R      int    `yaml:"scrypt_r"`
+	P      int    `yaml:"scrypt_p"`
+	Salt   string `yaml:"salt"`
+	Data   string `yaml:"data"` // Nonce and AES-GCM ciphertext of the configuration
+}
+
+// additionalData binds the parameters to the ciphertext, so they cannot be
+// changed without the bundle failing to decrypt.
+func (b bundleFile) additionalData() []byte {
+	return []byte(fmt.Sprintf("sm_bundle=%d kdf=%s n=%d r=%d p=%d salt=%s", b.Bundle, b.KDF, b.N, b.R, b.P, b.Salt))
+}
+
+// IsBundle reports whether data is an encrypted export bundle.
+func IsBundle(data []byte) bool {
+	var probe struct {
+		Bundle int `yaml:"sm_bundle"`
+	}
+	return yaml.Unmarshal(data, &probe) == nil && probe.Bundle > 0
+}
+
+// EncryptBundle encrypts cfg with passphrase. Saved passwords must already be
+// decrypted, as the bundle is meant to be read on another machine.
+func EncryptBundle(cfg *models.AppConfig, passphrase string) ([]byte, error) {
+	plaintext, err := yaml.Marshal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	salt := make([]byte, bundleSaltLen)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	b := bundleFile{
+		Bundle: bundleVersion,
+		KDF:    bundleKDF,
+		N:      bundleScryptN,
+		R:      bundleScryptR,
+		P:      bundleScryptP,
+		Salt:   base64.StdEncoding.EncodeToString(salt),
+	}
+
+	gcm, err := b.cipher(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	b.Data = base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, plaintext, b.additionalData()))
+
+	out, err := yaml.Marshal(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal bundle: %w", err)
+	}
+	return append([]byte(bundleHeader), out...), nil
+}
+
+// DecryptBundle decrypts a bundle written by EncryptBundle. Bundles exported by
+// older versions of sm are migrated to the current schema.
+func DecryptBundle(data []byte, passphrase string) (*models.AppConfig, error) {
+	var b bundleFile
+	if err := yaml.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("failed to parse bundle: %w", err)
+	}
+	if b.Bundle > bundleVersion {
+		return nil, fmt.Errorf("bundle version %d is newer than this version of sm supports (%d). Please upgrade sm", b.Bundle, bundleVersion)
+	}
+	if b.KDF != bundleKDF {
+		return nil, fmt.Errorf("unsupported bundle key derivation %q", b.KDF)
+	}
+	// Refuse parameters that would take unreasonable memory or time
+	if b.N > 1<<20 || b.R > 32 || b.P > 16 {
+		return nil, errors.New("bundle key derivation parameters are out of range")
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(b.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode bundle: %w", err)
+	}
+	gcm, err := b.cipher(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrWrongBundlePassphrase
+	}
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], b.additionalData())
+	if err != nil {
+		return nil, ErrWrongBundlePassphrase
+	}
+
+	migrated, _, err := migrateConfig(plaintext)
+	if err != nil {
+		return nil, err
+	}
+	var cfg models.AppConfig
+	if err := yaml.Unmarshal(migrated, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to decode bundle contents: %w", err)
+	}
+	return &cfg, nil
+}
+
+// cipher derives the bundle key from passphrase.
+func (b bundleFile) cipher(passphrase string) (cipher.AEAD, error) {
+	salt, err := base64.StdEncoding.DecodeString(b.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bundle salt: %w", err)
+	}
+	key, err := scrypt.Key([]byte(passphrase), salt, b.N, b.R, b.P, bundleKeyLen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive bundle key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
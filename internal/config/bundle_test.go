@@ -0,0 +1,109 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+	"sm/internal/models"
+)
+
+func TestBundleRoundTrip(t *testing.T) {
+	cfg := &models.AppConfig{
+		Version: CurrentVersion,
+		NextID:  3,
+		Connections: map[string]models.Connection{
+			"web": {ID: 1, Name: "web", Host: "10.0.0.1", User: "root", Port: 22, Password: "hunter2"},
+			"db":  {ID: 2, Name: "db", Host: "10.0.0.2", User: "pg", Port: 5432},
+		},
+		SSHKeys:  map[string]models.SSHKey{"id": {Name: "id", Path: "/keys/id", Type: "ed25519"}},
+		Settings: models.Settings{EncryptPasswords: true},
+	}
+	data, err := EncryptBundle(cfg, "correct horse")
+	if err != nil {
+		t.Fatalf("EncryptBundle failed: %v", err)
+	}
+	if !IsBundle(data) {
+		t.Error("IsBundle() = false for a bundle")
+	}
+	if strings.Contains(string(data), "hunter2") || strings.Contains(string(data), "10.0.0.1") {
+		t.Error("the bundle contains the configuration in plaintext")
+	}
+
+	got, err := DecryptBundle(data, "correct horse")
+	if err != nil {
+		t.Fatalf("DecryptBundle failed: %v", err)
+	}
+	if !reflect.DeepEqual(got.Connections, cfg.Connections) {
+		t.Errorf("connections = %+v, want %+v", got.Connections, cfg.Connections)
+	}
+	if got.SSHKeys["id"] != cfg.SSHKeys["id"] || got.NextID != 3 || !got.Settings.EncryptPasswords {
+		t.Errorf("DecryptBundle() = %+v, want %+v", got, cfg)
+	}
+
+	if _, err := DecryptBundle(data, "wrong"); !errors.Is(err, ErrWrongBundlePassphrase) {
+		t.Errorf("DecryptBundle with a wrong passphrase: error = %v, want ErrWrongBundlePassphrase", err)
+	}
+}
+
+func TestIsBundle(t *testing.T) {
+	tests := []struct {
+		data string
+		want bool
+	}{
+		{"sm_bundle: 1\ndata: x\n", true},
+		{"# comment\nsm_bundle: 2\n", true},
+		{"sm_bundle: 0\n", false},
+		{"version: 2\nconnections: {}\n", false},
+		{"", false},
+		{"[not yaml", false},
+	}
+	for _, tt := range tests {
+		if got := IsBundle([]byte(tt.data)); got != tt.want {
+			t.Errorf("IsBundle(%q) = %v, want %v", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestDecryptBundleRejects(t *testing.T) {
+	cfg := &models.AppConfig{Version: CurrentVersion, Connections: map[string]models.Connection{}}
+	data, err := EncryptBundle(cfg, "pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var good bundleFile
+	if err := yaml.Unmarshal(data, &good); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(b *bundleFile)
+		err    string
+	}{
+		{"newer version", func(b *bundleFile) { b.Bundle = bundleVersion + 1 }, "newer than this version of sm supports"},
+		{"other key derivation", func(b *bundleFile) { b.KDF = "pbkdf2" }, "unsupported bundle key derivation"},
+		{"huge parameters", func(b *bundleFile) { b.N = 1 << 24 }, "out of range"},
+		// The parameters are authenticated along with the data
+		{"changed parameters", func(b *bundleFile) { b.R = 4 }, ErrWrongBundlePassphrase.Error()},
+		{"changed salt", func(b *bundleFile) { b.Salt = "AAAAAAAAAAAAAAAAAAAAAA==" }, ErrWrongBundlePassphrase.Error()},
+		{"truncated data", func(b *bundleFile) { b.Data = "AAAA" }, ErrWrongBundlePassphrase.Error()},
+		{"invalid data", func(b *bundleFile) { b.Data = "not base64!" }, "failed to decode bundle"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := good
+			tt.change(&b)
+			changed, err := yaml.Marshal(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = DecryptBundle(changed, "pw")
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("DecryptBundle error = %v, want it to contain %q", err, tt.err)
+			}
+		})
+	}
+}
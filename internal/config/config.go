@@ -1,81 +1,285 @@
 package config
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"time"
 
-	"github.com/spf13/viper"
+	"github.com/gofrs/flock"
 	"gopkg.in/yaml.v3"
 	"sm/internal/models"
+	"sm/internal/utils"
 )
 
 // GetConfig returns a singleton instance of the AppConfig.
-// It loads the configuration from the file on its first call.
+// It loads the configuration from the file on its first call. Files written
+// by older versions of sm are upgraded and saved back once.
 func GetConfig() (*models.AppConfig, error) {
-	appConfig := &models.AppConfig{
-		Connections: make(map[string]models.Connection),
-		SSHKeys:     make(map[string]models.SSHKey),
+	appConfig, migration, _, err := readConfig()
+	if err != nil {
+		return nil, err
+	}
+	if !migration.Needed() {
+		return appConfig, nil
 	}
 
-	home, err := os.UserHomeDir()
+	// Persist the upgrade under the lock, so it only happens once
+	err = Update(func(cfg *models.AppConfig) error {
+		appConfig = cfg
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("could not get home directory: %w", err)
+		return nil, err
+	}
+	return appConfig, nil
+}
+
+// readConfig loads and, if needed, migrates the configuration file. It also
+// returns the original file contents, for backing them up before a migration.
+func readConfig() (*models.AppConfig, MigrationResult, []byte, error) {
+	configFile, err := ConfigFile()
+	if err != nil {
+		return nil, MigrationResult{}, nil, err
 	}
-	configFile := fmt.Sprintf("%s/.ssh-manager/config.yaml", home)
 
 	bytes, err := ioutil.ReadFile(configFile)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, MigrationResult{}, nil, fmt.Errorf("could not read config file: %w", err)
+	}
+
+	appConfig, migration, _, err := decodeConfig(bytes)
 	if err != nil {
-		if os.IsNotExist(err) {
-			appConfig.NextID = 1
-			return appConfig, nil
+		return nil, migration, nil, err
+	}
+
+	utils.SetEncryptionSettings(appConfig.Settings.Encryption)
+	for scheme, command := range appConfig.Settings.SecretProviders {
+		if err := utils.RegisterSecretProvider(scheme, utils.CommandSecretProvider(command)); err != nil {
+			return nil, migration, nil, fmt.Errorf("invalid settings.secret_providers: %w", err)
 		}
-		return nil, fmt.Errorf("could not read config file: %w", err)
 	}
 
-	if len(bytes) == 0 {
-		appConfig.NextID = 1
-		return appConfig, nil
+	return appConfig, migration, bytes, nil
+}
+
+// decodeConfig parses the contents of a configuration file, migrating them
+// if they were written by an older version of sm, as GetConfig does. Empty
+// data is an empty configuration. It also returns the migrated contents.
+func decodeConfig(data []byte) (*models.AppConfig, MigrationResult, []byte, error) {
+	appConfig := &models.AppConfig{
+		Version:     CurrentVersion,
+		NextID:      1,
+		Connections: make(map[string]models.Connection),
+		SSHKeys:     make(map[string]models.SSHKey),
+		Settings:    models.Settings{EncryptPasswords: true},
+	}
+	if len(data) == 0 {
+		return appConfig, MigrationResult{From: CurrentVersion, To: CurrentVersion}, data, nil
 	}
 
-	err = yaml.Unmarshal(bytes, &appConfig)
+	migrated, migration, err := migrateConfig(data)
 	if err != nil {
-		return nil, fmt.Errorf("unable to decode into struct: %w", err)
+		return nil, migration, nil, err
+	}
+
+	err = yaml.Unmarshal(migrated, &appConfig)
+	if err != nil {
+		return nil, migration, nil, fmt.Errorf("unable to decode into struct: %w", err)
 	}
 
 	if appConfig.NextID == 0 {
 		appConfig.NextID = 1
 	}
+	return appConfig, migration, migrated, nil
+}
 
-	return appConfig, nil
+// lockTimeout is how long Update waits for another sm process to finish
+// writing the configuration.
+const lockTimeout = 10 * time.Second
+
+// Update loads the configuration, applies fn to it and saves it, holding an
+// advisory lock for the whole cycle so concurrent sm processes do not lose
+// each other's changes. Nothing is saved if fn returns an error.
+func Update(fn func(cfg *models.AppConfig) error) error {
+	return update(fn, true)
 }
 
-// SaveConfig saves the current configuration back to the file.
-func SaveConfig(config *models.AppConfig) error {
-	configFile := viper.ConfigFileUsed()
-	if configFile == "" {
-		// If no config file is being used, create one in the default location.
-		home, err := os.UserHomeDir()
+// update is Update, with backup telling whether the file being replaced is
+// backed up first.
+func update(fn func(cfg *models.AppConfig) error, backup bool) error {
+	unlock, err := lockConfig()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	cfg, migration, original, err := readConfig()
+	if err != nil {
+		return fmt.Errorf("failed to get config: %w", err)
+	}
+
+	var originalBackup string
+	if migration.Needed() {
+		originalBackup, err = saveMigrationBackup(original, migration.From)
 		if err != nil {
-			return fmt.Errorf("could not get home directory: %w", err)
+			return err
 		}
-		configDir := fmt.Sprintf("%s/.ssh-manager", home)
-		if err := os.MkdirAll(configDir, 0700); err != nil {
-			return fmt.Errorf("could not create config directory: %w", err)
+	}
+
+	if err := fn(cfg); err != nil {
+		return err
+	}
+	if err := saveConfig(cfg, backup); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	if migration.Needed() {
+		fmt.Fprintf(os.Stderr, "Upgraded config from version %d to %d (original saved to %s)\n", migration.From, migration.To, originalBackup)
+	}
+	return nil
+}
+
+// RecordUse updates the last used time and use count of the connection
+// saved under name, which rank it by frecency. It does not back up the
+// configuration, since every connection records a use and would otherwise
+// rotate the backups of real changes away.
+func RecordUse(name string) error {
+	return update(func(cfg *models.AppConfig) error {
+		if conn, exists := cfg.Connections[name]; exists {
+			conn.LastUsed = time.Now()
+			conn.UseCount++
+			cfg.Connections[name] = conn
 		}
-		configFile = fmt.Sprintf("%s/config.yaml", configDir)
-		viper.SetConfigFile(configFile)
+		return nil
+	}, false)
+}
+
+// lockConfig takes the advisory lock on the configuration, waiting up to
+// lockTimeout for other sm processes to release it.
+func lockConfig() (unlock func(), err error) {
+	lockFile, err := configFileStatePath("config.lock")
+	if err != nil {
+		return nil, err
 	}
+	if err := os.MkdirAll(filepath.Dir(lockFile), 0700); err != nil {
+		return nil, fmt.Errorf("could not create config directory: %w", err)
+	}
+
+	lock := flock.New(lockFile)
+	ctx, cancel := context.WithTimeout(context.Background(), lockTimeout)
+	defer cancel()
+
+	locked, err := lock.TryLockContext(ctx, 50*time.Millisecond)
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		return nil, fmt.Errorf("failed to lock config: %w", err)
+	}
+	if !locked {
+		return nil, fmt.Errorf("config is locked by another sm process (waited %s)", lockTimeout)
+	}
+	return func() { lock.Unlock() }, nil
+}
+
+// SaveConfig saves the current configuration back to the file. Callers that
+// modify a loaded configuration should use Update instead, which holds the
+// config lock between loading and saving.
+func SaveConfig(config *models.AppConfig) error {
+	return saveConfig(config, true)
+}
+
+// saveConfig is SaveConfig, backing up the file it replaces if backup is set.
+func saveConfig(config *models.AppConfig, backup bool) error {
+	config.Version = CurrentVersion
 
 	bytes, err := yaml.Marshal(config)
 	if err != nil {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
 
-	err = os.WriteFile(configFile, bytes, 0600)
+	if err := writeConfigFile(bytes, backup); err != nil {
+		return err
+	}
+
+	// Keep the OpenSSH view of the connections up to date once it is in use
+	if managedSSHConfigEnabled() {
+		if err := WriteManagedSSHConfig(config); err != nil {
+			return fmt.Errorf("failed to update managed ssh config: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// configFileForWrite returns the file SaveConfig writes to, creating its directory.
+func configFileForWrite() (string, error) {
+	configFile, err := ConfigFile()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(configFile), 0700); err != nil {
+		return "", fmt.Errorf("could not create config directory: %w", err)
+	}
+	return configFile, nil
+}
+
+// writeConfigFile replaces the configuration file with data atomically, so a
+// crash never leaves a half-written file behind. With backup, the current
+// file is backed up first.
+func writeConfigFile(data []byte, backup bool) error {
+	configFile, err := configFileForWrite()
 	if err != nil {
+		return err
+	}
+
+	if backup {
+		if err := backupConfigFile(configFile); err != nil {
+			return err
+		}
+	}
+
+	if err := writeFileAtomic(configFile, data, 0600); err != nil {
 		return fmt.Errorf("failed to write config file: %w", err)
 	}
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file next to name, syncs it to
+// disk and renames it over name.
+func writeFileAtomic(name string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(name)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(name)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName) // No-op once renamed
 
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpName, name); err != nil {
+		return err
+	}
+
+	// Make the rename itself durable. Not every platform can sync a
+	// directory, so failures here are ignored.
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,247 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"sm/internal/models"
+	"sm/internal/utils"
+)
+
+// CurrentVersion is the schema version written by this version of sm.
+const CurrentVersion = 2
+
+// migration upgrades a raw configuration document from version From to
+// From+1. It edits doc in place and describes every change it made.
+type migration struct {
+	From        int
+	Description string
+	Apply       func(doc map[string]interface{}) ([]string, error)
+}
+
+// migrations are applied in order to files older than CurrentVersion. Add new
+// steps to the end and bump CurrentVersion; never change a released step.
+var migrations = []migration{
+	{
+		From:        0,
+		Description: "store created_at as a timestamp like last_used, instead of Unix seconds",
+		Apply:       migrateCreatedAtToTimestamp,
+	},
+	{
+		From:        1,
+		Description: "mark encrypted passwords with enc:v1: and enable encrypt_passwords, unless it is set to false",
+		Apply:       migrateMarkEncryptedPasswords,
+	},
+}
+
+// MigrationResult describes the upgrade of a configuration file.
+type MigrationResult struct {
+	From    int
+	To      int
+	Steps   []string // Description of each migration applied
+	Changes []string // Individual changes made by the migrations
+}
+
+// Needed reports whether the file was older than the current schema.
+func (r MigrationResult) Needed() bool {
+	return r.From < r.To
+}
+
+// PlanMigration reports how the configuration file would be upgraded,
+// without changing it.
+func PlanMigration() (MigrationResult, error) {
+	configFile, err := ConfigFile()
+	if err != nil {
+		return MigrationResult{}, err
+	}
+
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return MigrationResult{From: CurrentVersion, To: CurrentVersion}, nil
+		}
+		return MigrationResult{}, fmt.Errorf("could not read config file: %w", err)
+	}
+
+	_, result, err := migrateConfig(data)
+	return result, err
+}
+
+// MigrateConfig upgrades the configuration file to the current schema,
+// keeping a copy of the original. It is also done automatically on load.
+func MigrateConfig() (MigrationResult, error) {
+	result, err := PlanMigration()
+	if err != nil || !result.Needed() {
+		return result, err
+	}
+	return result, Update(func(cfg *models.AppConfig) error { return nil })
+}
+
+// migrateConfig parses data, upgrading it step by step if it was written by
+// an older version of sm.
+func migrateConfig(data []byte) ([]byte, MigrationResult, error) {
+	result := MigrationResult{To: CurrentVersion}
+
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, result, fmt.Errorf("unable to decode config: %w", err)
+	}
+	if doc == nil {
+		result.From = CurrentVersion
+		return data, result, nil
+	}
+
+	switch v := doc["version"].(type) {
+	case nil:
+		result.From = 0
+	case int:
+		result.From = v
+	default:
+		return nil, result, fmt.Errorf("invalid config version %v", v)
+	}
+
+	if result.From > CurrentVersion {
+		return nil, result, fmt.Errorf("config version %d is newer than this version of sm supports (%d). Please upgrade sm", result.From, CurrentVersion)
+	}
+	if result.From == CurrentVersion {
+		return data, result, nil
+	}
+
+	for _, m := range migrations {
+		if m.From < result.From {
+			continue
+		}
+		changes, err := m.Apply(doc)
+		if err != nil {
+			return nil, result, fmt.Errorf("failed to migrate config from version %d: %w", m.From, err)
+		}
+		result.Steps = append(result.Steps, fmt.Sprintf("%d -> %d: %s", m.From, m.From+1, m.Description))
+		result.Changes = append(result.Changes, changes...)
+		doc["version"] = m.From + 1
+	}
+
+	migrated, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, result, fmt.Errorf("failed to marshal migrated config: %w", err)
+	}
+	return migrated, result, nil
+}
+
+// saveMigrationBackup keeps the original file of a migration next to the
+// rotating backups. It is named after its version and is never rotated away.
+func saveMigrationBackup(original []byte, version int) (string, error) {
+	dir, err := BackupDir()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("could not create backup directory: %w", err)
+	}
+
+	file := filepath.Join(dir, fmt.Sprintf("config.v%d.yaml", version))
+	if _, err := os.Stat(file); err == nil {
+		// Keep the first original of this version
+		return file, nil
+	}
+	if err := writeFileAtomic(file, original, 0600); err != nil {
+		return "", fmt.Errorf("failed to back up config before migrating: %w", err)
+	}
+	return file, nil
+}
+
+// connectionMaps returns the connections of a raw configuration document, sorted by name.
+func connectionMaps(doc map[string]interface{}) ([]string, map[string]map[string]interface{}) {
+	conns := make(map[string]map[string]interface{})
+	raw, _ := doc["connections"].(map[string]interface{})
+	for name, c := range raw {
+		if conn, ok := c.(map[string]interface{}); ok {
+			conns[name] = conn
+		}
+	}
+
+	names := make([]string, 0, len(conns))
+	for name := range conns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, conns
+}
+
+// migrateCreatedAtToTimestamp converts created_at from Unix seconds to a
+// timestamp. A zero value meant "unknown" and is removed.
+func migrateCreatedAtToTimestamp(doc map[string]interface{}) ([]string, error) {
+	var changes []string
+	names, conns := connectionMaps(doc)
+	for _, name := range names {
+		conn := conns[name]
+		seconds, ok := conn["created_at"].(int)
+		if !ok {
+			continue
+		}
+		if seconds == 0 {
+			delete(conn, "created_at")
+			changes = append(changes, fmt.Sprintf("connections.%s.created_at: removed empty value 0", name))
+			continue
+		}
+		t := time.Unix(int64(seconds), 0)
+		conn["created_at"] = t
+		changes = append(changes, fmt.Sprintf("connections.%s.created_at: %d -> %s", name, seconds, t.Format(time.RFC3339)))
+	}
+	return changes, nil
+}
+
+// decryptUnmarked is utils.DecryptUnmarkedWithKeyring, replaced in tests.
+// Loading a file must never create a keyring key.
+var decryptUnmarked = utils.DecryptUnmarkedWithKeyring
+
+// migrateMarkEncryptedPasswords marks the passwords that older versions of sm
+// encrypted. It turns on encrypt_passwords, which was never enforced before,
+// if the file does not set it, and keeps it off if it does.
+//
+// A password only counts as encrypted if it decrypts with a key that is
+// already in the keyring; no key is created for it. A master password cannot be asked for while the file is loaded, so in that
+// mode 'sm secrets encrypt-all' converts them.
+func migrateMarkEncryptedPasswords(doc map[string]interface{}) ([]string, error) {
+	var changes []string
+	settings, _ := doc["settings"].(map[string]interface{})
+	encryption, _ := settings["encryption"].(map[string]interface{})
+	masterPassword := encryption["key_source"] == models.KeySourceMasterPassword
+
+	names, conns := connectionMaps(doc)
+	for _, name := range names {
+		password, ok := conns[name]["password"].(string)
+		if !ok || !utils.MaybeUnmarkedCiphertext(password) {
+			continue
+		}
+		if masterPassword {
+			changes = append(changes, fmt.Sprintf("connections.%s.password: may be encrypted, run 'sm secrets encrypt-all' to check", name))
+			continue
+		}
+		_, err := decryptUnmarked(password)
+		switch {
+		case err == nil:
+			conns[name]["password"] = utils.MarkEncrypted(password)
+			changes = append(changes, fmt.Sprintf("connections.%s.password: marked as encrypted", name))
+		case !errors.Is(err, utils.ErrUndecryptable):
+			changes = append(changes, fmt.Sprintf("connections.%s.password: may be encrypted, but the key is not available (%v); run 'sm secrets encrypt-all' to check", name, err))
+		}
+	}
+
+	if settings == nil {
+		settings = make(map[string]interface{})
+		doc["settings"] = settings
+	}
+	switch enabled, set := settings["encrypt_passwords"].(bool); {
+	case !set:
+		settings["encrypt_passwords"] = true
+		changes = append(changes, "settings.encrypt_passwords: enabled")
+	case !enabled:
+		changes = append(changes, "settings.encrypt_passwords: kept false, so new passwords are saved in plaintext")
+	}
+	return changes, nil
+}
@@ -0,0 +1,256 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"sm/internal/utils"
+)
+
+// legacyCiphertext has the form of a password that an older sm encrypted.
+const legacyCiphertext = "deadbeef:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"
+
+// plaintextLookalike is a plaintext password with the same form.
+const plaintextLookalike = "BBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBB"
+
+// stubDecryptUnmarked makes the migration decrypt legacyCiphertext only, or
+// fail with err for every value if err is set.
+func stubDecryptUnmarked(t *testing.T, err error) {
+	t.Helper()
+	original := decryptUnmarked
+	decryptUnmarked = func(value string) (string, error) {
+		switch {
+		case err != nil:
+			return "", err
+		case value == legacyCiphertext:
+			return "hunter2", nil
+		}
+		return "", fmt.Errorf("%w: wrong key", utils.ErrUndecryptable)
+	}
+	t.Cleanup(func() { decryptUnmarked = original })
+}
+
+func TestMigrateConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     string
+		decryptErr error
+		want       map[string]interface{} // Values in the result, by dotted path
+		changes    []string               // Substrings of the changes, in order
+		from       int
+	}{
+		{
+			name:   "current version is left alone",
+			config: "version: 2\nsettings:\n  encrypt_passwords: false\n",
+			want:   map[string]interface{}{"settings.encrypt_passwords": false},
+			from:   2,
+		},
+		{
+			name: "created_at becomes a timestamp",
+			config: `
+version: 0
+connections:
+  web: {created_at: 1700000000}
+  db: {created_at: 0}
+settings: {encrypt_passwords: true}
+`,
+			want: map[string]interface{}{
+				"connections.web.created_at": time.Unix(1700000000, 0),
+				"connections.db.created_at":  nil,
+				"version":                    2,
+			},
+			changes: []string{
+				"connections.db.created_at: removed empty value 0",
+				"connections.web.created_at: 1700000000 -> ",
+			},
+		},
+		{
+			name: "only passwords that decrypt are marked",
+			config: fmt.Sprintf(`
+version: 1
+connections:
+  a: {password: %q}
+  b: {password: %q}
+  c: {password: hunter2}
+  d: {password: "ref:env:PW"}
+  e: {password: "enc:v1:deadbeef:AAAA"}
+`, legacyCiphertext, plaintextLookalike),
+			want: map[string]interface{}{
+				"connections.a.password":     "enc:v1:" + legacyCiphertext,
+				"connections.b.password":     plaintextLookalike,
+				"connections.c.password":     "hunter2",
+				"connections.d.password":     "ref:env:PW",
+				"connections.e.password":     "enc:v1:deadbeef:AAAA",
+				"settings.encrypt_passwords": true,
+			},
+			changes: []string{
+				"connections.a.password: marked as encrypted",
+				"settings.encrypt_passwords: enabled",
+			},
+			from: 1,
+		},
+		{
+			name:       "unavailable key leaves passwords for encrypt-all",
+			config:     fmt.Sprintf("version: 1\nconnections:\n  a: {password: %q}\n", legacyCiphertext),
+			decryptErr: errors.New("no keyring"),
+			want: map[string]interface{}{
+				"connections.a.password": legacyCiphertext,
+			},
+			changes: []string{
+				"connections.a.password: may be encrypted, but the key is not available (no keyring)",
+				"settings.encrypt_passwords: enabled",
+			},
+			from: 1,
+		},
+		{
+			name: "master password mode leaves passwords for encrypt-all",
+			config: fmt.Sprintf(`
+version: 1
+connections:
+  a: {password: %q}
+settings:
+  encryption: {key_source: master-password}
+`, legacyCiphertext),
+			want: map[string]interface{}{
+				"connections.a.password": legacyCiphertext,
+			},
+			changes: []string{
+				"connections.a.password: may be encrypted, run 'sm secrets encrypt-all' to check",
+				"settings.encrypt_passwords: enabled",
+			},
+			from: 1,
+		},
+		{
+			name:   "explicit false is kept",
+			config: "version: 1\nsettings:\n  encrypt_passwords: false\n",
+			want:   map[string]interface{}{"settings.encrypt_passwords": false},
+			changes: []string{
+				"settings.encrypt_passwords: kept false",
+			},
+			from: 1,
+		},
+		{
+			name:   "explicit true is kept without a change",
+			config: "version: 1\nsettings:\n  encrypt_passwords: true\n",
+			want:   map[string]interface{}{"settings.encrypt_passwords": true},
+			from:   1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubDecryptUnmarked(t, tt.decryptErr)
+
+			migrated, result, err := migrateConfig([]byte(tt.config))
+			if err != nil {
+				t.Fatalf("migrateConfig failed: %v", err)
+			}
+			if result.From != tt.from || result.To != CurrentVersion {
+				t.Errorf("migrated from %d to %d, want %d to %d", result.From, result.To, tt.from, CurrentVersion)
+			}
+			if len(result.Steps) != CurrentVersion-tt.from {
+				t.Errorf("Steps = %q, want %d", result.Steps, CurrentVersion-tt.from)
+			}
+
+			var doc map[string]interface{}
+			if err := yaml.Unmarshal(migrated, &doc); err != nil {
+				t.Fatalf("migrated config is not valid YAML: %v", err)
+			}
+			if result.Needed() && doc["version"] != CurrentVersion {
+				t.Errorf("version = %v, want %d", doc["version"], CurrentVersion)
+			}
+			for path, want := range tt.want {
+				got := lookup(doc, path)
+				if wantTime, ok := want.(time.Time); ok {
+					gotTime, ok := got.(time.Time)
+					if !ok || !gotTime.Equal(wantTime) {
+						t.Errorf("%s = %v, want %v", path, got, want)
+					}
+					continue
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("%s = %#v, want %#v", path, got, want)
+				}
+			}
+
+			if len(result.Changes) != len(tt.changes) {
+				t.Fatalf("Changes = %q, want %d", result.Changes, len(tt.changes))
+			}
+			for i, want := range tt.changes {
+				if !strings.Contains(result.Changes[i], want) {
+					t.Errorf("Changes[%d] = %q, want it to contain %q", i, result.Changes[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestMigrateConfigErrors(t *testing.T) {
+	tests := []struct {
+		config string
+		err    string
+	}{
+		{"version: 99\n", "newer than this version of sm supports"},
+		{"version: two\n", "invalid config version"},
+		{"connections: [\n", "unable to decode config"},
+	}
+	for _, tt := range tests {
+		_, _, err := migrateConfig([]byte(tt.config))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("migrateConfig(%q) error = %v, want it to contain %q", tt.config, err, tt.err)
+		}
+	}
+}
+
+func TestGetConfigMigratesOnce(t *testing.T) {
+	useTempConfig(t)
+	file, err := ConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := []byte("connections:\n  web: {host: h, created_at: 1700000000}\n")
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, original, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := GetConfig()
+	if err != nil {
+		t.Fatalf("GetConfig failed: %v", err)
+	}
+	if cfg.Version != CurrentVersion || !cfg.Connections["web"].CreatedAt.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("loaded config = %+v, want it migrated", cfg)
+	}
+
+	// The file is saved upgraded, and the original is kept
+	result, err := PlanMigration()
+	if err != nil || result.Needed() {
+		t.Errorf("PlanMigration() = %+v, %v, want the file already upgraded", result, err)
+	}
+	dir, _ := BackupDir()
+	kept, err := os.ReadFile(filepath.Join(dir, "config.v0.yaml"))
+	if err != nil || string(kept) != string(original) {
+		t.Errorf("original backup = %q, %v, want %q", kept, err, original)
+	}
+}
+
+// lookup returns the value at a dotted path in a YAML document, or nil.
+func lookup(doc map[string]interface{}, path string) interface{} {
+	var value interface{} = doc
+	for _, key := range strings.Split(path, ".") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = m[key]
+	}
+	return value
+}
@@ -0,0 +1,228 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// configFileEnv overrides the configuration file location, like --config.
+const configFileEnv = "SM_CONFIG"
+
+// configFileName is the name of the configuration file in its directory.
+const configFileName = "config.yaml"
+
+// configFileOverride is the file given with --config, if any.
+var configFileOverride string
+
+// SetConfigFile makes every load and save use file instead of the default
+// location. It is set from the --config flag.
+func SetConfigFile(file string) {
+	configFileOverride = file
+}
+
+// ConfigFile returns the path of the configuration file. The first of these wins:
+//  1. the --config flag
+//  2. the SM_CONFIG environment variable
+//  3. $XDG_CONFIG_HOME/sm/config.yaml
+//  4. ~/.config/sm/config.yaml (%AppData%\sm\config.yaml on Windows)
+func ConfigFile() (string, error) {
+	if configFileOverride != "" {
+		return expandHome(configFileOverride), nil
+	}
+	if file := os.Getenv(configFileEnv); file != "" {
+		return expandHome(file), nil
+	}
+
+	dir, err := defaultConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, configFileName), nil
+}
+
+// ConfigDir returns the directory where ssh-manager keeps its own files, such
+// as known hosts and backups. It is the default config directory even when
+// --config or SM_CONFIG choose a file elsewhere, so that sm does not write
+// next to a file that may be in a synced or shared directory.
+func ConfigDir() (string, error) {
+	return defaultConfigDir()
+}
+
+// configFileStatePath returns where the file called name that belongs to the
+// configuration file in use, such as its lock or backups, is kept. For the
+// default configuration file it is name in the config directory. Other files
+// get a directory of their own under configs/, named after the file and a
+// hash of its path, so that two configurations never share backups.
+func configFileStatePath(name string) (string, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	file, err := ConfigFile()
+	if err != nil {
+		return "", err
+	}
+	if abs, err := filepath.Abs(file); err == nil {
+		file = abs
+	}
+	if file == filepath.Join(dir, configFileName) {
+		return filepath.Join(dir, name), nil
+	}
+
+	sum := sha256.Sum256([]byte(file))
+	base := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	return filepath.Join(dir, "configs", base+"-"+hex.EncodeToString(sum[:4]), name), nil
+}
+
+// defaultConfigDir returns the configuration directory used when no file is
+// given explicitly, following the XDG base directory specification.
+func defaultConfigDir() (string, error) {
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		return filepath.Join(xdg, "sm"), nil
+	}
+	if runtime.GOOS == "windows" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return "", fmt.Errorf("could not get config directory: %w", err)
+		}
+		return filepath.Join(dir, "sm"), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("could not get home directory: %w", err)
+	}
+	return filepath.Join(home, ".config", "sm"), nil
+}
+
+// legacyConfigDirs returns the directories older versions of sm kept their
+// configuration in, most recently used first.
+func legacyConfigDirs() []string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	return []string{
+		filepath.Join(home, ".ssh-manager"),
+		filepath.Join(home, ".sm"),
+	}
+}
+
+// legacyFiles are the files moved from a legacy directory, besides the
+// configuration file itself.
+var legacyFiles = []string{"known_hosts", "ssh_config", "backups"}
+
+// MigrateLegacyConfig moves the configuration from a legacy directory to the
+// default location if it is not there yet. It does nothing when the file is
+// chosen with --config or SM_CONFIG. It returns the directory it migrated
+// from, or "" if nothing was migrated.
+func MigrateLegacyConfig() (string, error) {
+	if configFileOverride != "" || os.Getenv(configFileEnv) != "" {
+		return "", nil
+	}
+
+	dir, err := defaultConfigDir()
+	if err != nil {
+		return "", err
+	}
+	target := filepath.Join(dir, configFileName)
+	if _, err := os.Stat(target); err == nil {
+		return "", nil
+	}
+
+	for _, legacy := range legacyConfigDirs() {
+		if legacy == dir {
+			continue
+		}
+		source := filepath.Join(legacy, configFileName)
+		if _, err := os.Stat(source); err != nil {
+			continue
+		}
+
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return "", fmt.Errorf("could not create config directory: %w", err)
+		}
+		if err := moveFile(source, target); err != nil {
+			return "", fmt.Errorf("failed to migrate %s: %w", source, err)
+		}
+
+		for _, name := range legacyFiles {
+			from, to := filepath.Join(legacy, name), filepath.Join(dir, name)
+			if _, err := os.Stat(from); err != nil {
+				continue
+			}
+			if err := os.Rename(from, to); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: could not move %s to %s: %v\n", from, to, err)
+				continue
+			}
+			if name == "ssh_config" {
+				if err := replaceSSHConfigInclude(from, to); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: could not update the Include line in ~/.ssh/config: %v\n", err)
+				}
+			}
+		}
+
+		// Only removes the directory if nothing else is left in it
+		os.Remove(filepath.Join(legacy, "config.lock"))
+		os.Remove(legacy)
+		return legacy, nil
+	}
+	return "", nil
+}
+
+// moveFile renames source to target, falling back to copying when they are
+// on different file systems.
+func moveFile(source, target string) error {
+	if err := os.Rename(source, target); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(target, data, 0600); err != nil {
+		return err
+	}
+	in.Close()
+	return os.Remove(source)
+}
+
+// replaceSSHConfigInclude points an Include line in ~/.ssh/config that
+// refers to oldPath at newPath instead.
+func replaceSSHConfigInclude(oldPath, newPath string) error {
+	userConfig, _, lines, err := readUserSSHConfig()
+	if err != nil {
+		return err
+	}
+	i := includeLineIndex(lines, oldPath)
+	if i < 0 {
+		return nil
+	}
+	lines[i] = "Include " + quoteSSHConfigArg(newPath)
+	return writeUserSSHConfig(userConfig, lines)
+}
+
+// expandHome replaces a leading "~/" with the user's home directory.
+func expandHome(p string) string {
+	if !strings.HasPrefix(p, "~/") {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return p
+	}
+	return filepath.Join(home, p[2:])
+}
@@ -0,0 +1,660 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sm/internal/models"
+)
+
+// maxIncludeDepth limits nested Include directives, as OpenSSH does.
+const maxIncludeDepth = 16
+
+// SSHConfig is a parsed OpenSSH client configuration file (~/.ssh/config).
+type SSHConfig struct {
+	blocks   []sshConfigBlock
+	Warnings []string // Directives that were skipped while parsing
+}
+
+// sshConfigBlock is a Host block. Directives before the first Host line
+// belong to a block matching every host. A block from a file included inside
+// Host blocks only applies to hosts that also match each of their scope.
+type sshConfigBlock struct {
+	patterns []string
+	scope    [][]string
+	options  []sshConfigOption
+}
+
+// matches reports whether the block applies to host.
+func (b sshConfigBlock) matches(host string) bool {
+	for _, patterns := range b.scope {
+		if !matchHostPatterns(patterns, host) {
+			return false
+		}
+	}
+	return matchHostPatterns(b.patterns, host)
+}
+
+type sshConfigOption struct {
+	key  string // Lower case, since keywords are case-insensitive
+	args []string
+}
+
+// DefaultSSHConfigPath returns the path of the user's OpenSSH client config.
+func DefaultSSHConfigPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("could not get home directory: %w", err)
+	}
+	return filepath.Join(home, ".ssh", "config"), nil
+}
+
+// ParseSSHConfig reads an OpenSSH client config file, following Include directives.
+func ParseSSHConfig(file string) (*SSHConfig, error) {
+	c := &SSHConfig{}
+	if err := c.parseFile(file, nil, 0); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// parseFile appends the blocks of file to c. As in OpenSSH, the Host blocks
+// of a file included inside a Host block only apply to hosts that the
+// enclosing block matches too, which scope records.
+func (c *SSHConfig) parseFile(file string, scope [][]string, depth int) error {
+	if depth > maxIncludeDepth {
+		return fmt.Errorf("too many nested includes at %s", file)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("failed to open ssh config %s: %w", file, err)
+	}
+	defer f.Close()
+
+	patterns := []string{"*"}
+	c.blocks = append(c.blocks, sshConfigBlock{patterns: patterns, scope: scope})
+	current := len(c.blocks) - 1
+
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		key, args, err := splitSSHConfigLine(scanner.Text())
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", file, lineNo, err)
+		}
+		if key == "" {
+			continue
+		}
+
+		switch key {
+		case "host":
+			if len(args) == 0 {
+				return fmt.Errorf("%s:%d: Host requires at least one pattern", file, lineNo)
+			}
+			patterns = args
+			c.blocks = append(c.blocks, sshConfigBlock{patterns: patterns, scope: scope})
+			current = len(c.blocks) - 1
+			for _, p := range concreteHosts(patterns) {
+				if !c.blocks[current].matches(p) {
+					c.Warnings = append(c.Warnings, fmt.Sprintf("%s:%d: Host %s is in a file included from a Host block that does not match it, so it never applies and was skipped", file, lineNo, p))
+				}
+			}
+		case "match":
+			// Match conditions depend on the runtime environment and cannot be
+			// evaluated here, so the whole block is ignored
+			c.Warnings = append(c.Warnings, fmt.Sprintf("%s:%d: Match blocks are not supported and were skipped", file, lineNo))
+			patterns = nil
+			c.blocks = append(c.blocks, sshConfigBlock{})
+			current = len(c.blocks) - 1
+		case "include":
+			if patterns == nil {
+				continue
+			}
+			inner := scope
+			if !(len(patterns) == 1 && patterns[0] == "*") {
+				inner = append(scope[:len(scope):len(scope)], patterns)
+			}
+			for _, pattern := range args {
+				if err := c.include(pattern, inner, depth); err != nil {
+					return fmt.Errorf("%s:%d: %w", file, lineNo, err)
+				}
+			}
+			// Directives after the Include continue the enclosing Host block
+			c.blocks = append(c.blocks, sshConfigBlock{patterns: patterns, scope: scope})
+			current = len(c.blocks) - 1
+		default:
+			c.blocks[current].options = append(c.blocks[current].options, sshConfigOption{key: key, args: args})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read ssh config %s: %w", file, err)
+	}
+	return nil
+}
+
+// include parses every file matching pattern. Relative paths are resolved
+// against ~/.ssh, like OpenSSH does for the user config.
+func (c *SSHConfig) include(pattern string, scope [][]string, depth int) error {
+	pattern = expandHome(pattern)
+	if !filepath.IsAbs(pattern) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return fmt.Errorf("could not get home directory: %w", err)
+		}
+		pattern = filepath.Join(home, ".ssh", pattern)
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid Include pattern %s: %w", pattern, err)
+	}
+	for _, match := range matches {
+		if err := c.parseFile(match, scope, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitSSHConfigLine splits a config line into its lower-cased keyword and
+// arguments. The keyword may be separated from its arguments by '=' and
+// arguments may be double-quoted. Blank lines and comments return an empty key.
+func splitSSHConfigLine(line string) (string, []string, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", nil, nil
+	}
+
+	end := strings.IndexAny(line, " \t=")
+	if end < 0 {
+		return strings.ToLower(line), nil, nil
+	}
+	key := strings.ToLower(line[:end])
+	rest := strings.TrimLeft(line[end:], " \t")
+	if strings.HasPrefix(rest, "=") {
+		rest = rest[1:]
+	}
+
+	var args []string
+	var current strings.Builder
+	inQuote, inWord := false, false
+	for _, r := range rest {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+			inWord = true
+		case !inQuote && (r == ' ' || r == '\t'):
+			if inWord {
+				args = append(args, current.String())
+				current.Reset()
+				inWord = false
+			}
+		default:
+			current.WriteRune(r)
+			inWord = true
+		}
+	}
+	if inQuote {
+		return "", nil, errors.New("unterminated quote")
+	}
+	if inWord {
+		args = append(args, current.String())
+	}
+	return key, args, nil
+}
+
+// Hosts returns the concrete host aliases defined by Host lines, in the order
+// they first appear. Wildcard and negated patterns are not hosts of their own,
+// nor are aliases outside the scope of the Host block that included them.
+func (c *SSHConfig) Hosts() []string {
+	var hosts []string
+	seen := make(map[string]bool)
+	for _, b := range c.blocks {
+		for _, p := range concreteHosts(b.patterns) {
+			if seen[p] || !b.matches(p) {
+				continue
+			}
+			seen[p] = true
+			hosts = append(hosts, p)
+		}
+	}
+	return hosts
+}
+
+// concreteHosts returns the patterns of a Host line that name a single host.
+func concreteHosts(patterns []string) []string {
+	var hosts []string
+	for _, p := range patterns {
+		if !strings.ContainsAny(p, "*?!") {
+			hosts = append(hosts, p)
+		}
+	}
+	return hosts
+}
+
+// Get returns the first value of key that applies to host, which is the one
+// OpenSSH uses, or "" if key is not set.
+func (c *SSHConfig) Get(host, key string) string {
+	values := c.GetAll(host, key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// GetAll returns the arguments of every occurrence of key that applies to
+// host, in file order, joined with spaces. Options such as IdentityFile and
+// LocalForward may be given more than once.
+func (c *SSHConfig) GetAll(host, key string) []string {
+	key = strings.ToLower(key)
+	var values []string
+	for _, b := range c.blocks {
+		if !b.matches(host) {
+			continue
+		}
+		for _, o := range b.options {
+			if o.key == key {
+				values = append(values, strings.Join(o.args, " "))
+			}
+		}
+	}
+	return values
+}
+
+// matchHostPatterns reports whether host matches a Host line: at least one
+// pattern must match and no negated pattern may match.
+func matchHostPatterns(patterns []string, host string) bool {
+	matched := false
+	for _, p := range patterns {
+		negated := strings.HasPrefix(p, "!")
+		if ok, _ := path.Match(strings.TrimPrefix(p, "!"), host); ok {
+			if negated {
+				return false
+			}
+			matched = true
+		}
+	}
+	return matched
+}
+
+// SSHConfigConnections converts every concrete host in c into a connection,
+// with wildcard defaults applied. Jump hosts must refer to other hosts in c or
+// to saved connections in cfg. IDs are left unset for the caller to assign.
+// The returned warnings describe options that could not be converted.
+func SSHConfigConnections(c *SSHConfig, cfg *models.AppConfig) ([]models.Connection, []string) {
+	hosts := c.Hosts()
+	known := make(map[string]bool)
+	for _, h := range hosts {
+		known[h] = true
+	}
+	for name := range cfg.Connections {
+		known[name] = true
+	}
+
+	var conns []models.Connection
+	var warnings []string
+	for _, alias := range hosts {
+		conn := models.Connection{
+			Name: alias,
+			Host: strings.ReplaceAll(c.Get(alias, "HostName"), "%h", alias),
+			User: c.Get(alias, "User"),
+		}
+		if conn.Host == "" {
+			conn.Host = alias
+		}
+		if conn.User == "" {
+			conn.User = defaultUser(cfg)
+		}
+
+		conn.Port = cfg.DefaultPort
+		if port := c.Get(alias, "Port"); port != "" {
+			p, err := strconv.Atoi(port)
+			if err != nil || p < 1 || p > 65535 {
+				warnings = append(warnings, fmt.Sprintf("%s: invalid Port %q, using the default", alias, port))
+			} else {
+				conn.Port = p
+			}
+		}
+		if conn.Port == 0 {
+			conn.Port = 22
+		}
+
+		if identities := c.GetAll(alias, "IdentityFile"); len(identities) > 0 && !strings.EqualFold(identities[0], "none") {
+			keyPath, unknown := expandIdentityTokens(identities[0], alias, conn)
+			conn.KeyPath = expandHome(keyPath)
+			if len(unknown) > 0 {
+				warnings = append(warnings, fmt.Sprintf("%s: IdentityFile %q uses %s, which sm cannot expand; check the key path", alias, identities[0], strings.Join(unknown, " ")))
+			}
+			if len(identities) > 1 {
+				warnings = append(warnings, fmt.Sprintf("%s: only the first of %d IdentityFile entries is used", alias, len(identities)))
+			}
+		}
+
+		if jump := c.Get(alias, "ProxyJump"); jump != "" && !strings.EqualFold(jump, "none") {
+			for _, hop := range strings.Split(jump, ",") {
+				name, hasUserOrPort := jumpHostName(hop)
+				if !known[name] {
+					warnings = append(warnings, fmt.Sprintf("%s: jump host %q is not a saved or imported connection and was skipped", alias, hop))
+					continue
+				}
+				if hasUserOrPort {
+					warnings = append(warnings, fmt.Sprintf("%s: jump host %q: the user and port of a hop are not kept, the ones of connection %s are used", alias, hop, name))
+				}
+				conn.JumpHosts = append(conn.JumpHosts, name)
+			}
+		}
+
+		if strings.EqualFold(c.Get(alias, "ForwardAgent"), "yes") {
+			conn.ForwardAgent = true
+		}
+		if mode := strings.ToLower(c.Get(alias, "StrictHostKeyChecking")); mode != "" {
+			switch mode {
+			case "off":
+				mode = models.HostKeyCheckingNo
+			case "on":
+				mode = models.HostKeyCheckingYes
+			}
+			if models.ValidHostKeyChecking(mode) {
+				conn.StrictHostKeyChecking = mode
+			}
+		}
+
+		for i, spec := range c.GetAll(alias, "LocalForward") {
+			fields := strings.Fields(spec)
+			if len(fields) != 2 {
+				warnings = append(warnings, fmt.Sprintf("%s: invalid LocalForward %q was skipped", alias, spec))
+				continue
+			}
+			conn.Forwards = append(conn.Forwards, models.Forward{
+				Name: fmt.Sprintf("local-%d", i+1),
+				Type: models.ForwardLocal,
+				Spec: fields[0] + ":" + fields[1],
+			})
+		}
+
+		conns = append(conns, conn)
+	}
+	return conns, warnings
+}
+
+// jumpHostName strips the user and port from a ProxyJump hop, leaving the
+// host alias it refers to. It also reports whether the hop had either.
+func jumpHostName(hop string) (string, bool) {
+	hop = strings.TrimSpace(hop)
+	stripped := false
+	if i := strings.LastIndex(hop, "@"); i >= 0 {
+		hop = hop[i+1:]
+		stripped = true
+	}
+	if strings.HasPrefix(hop, "[") {
+		if i := strings.Index(hop, "]"); i >= 0 {
+			return hop[1:i], stripped || i < len(hop)-1
+		}
+	}
+	if i := strings.LastIndex(hop, ":"); i >= 0 && strings.Count(hop, ":") == 1 {
+		hop = hop[:i]
+		stripped = true
+	}
+	return hop, stripped
+}
+
+// expandIdentityTokens expands the % tokens of an IdentityFile path that can
+// be known when importing: %% %d %h %n %p %r and %u. It returns the tokens it
+// left as they were, such as %C or %l.
+func expandIdentityTokens(keyPath, alias string, conn models.Connection) (string, []string) {
+	var b strings.Builder
+	var unknown []string
+	for i := 0; i < len(keyPath); i++ {
+		if keyPath[i] != '%' || i == len(keyPath)-1 {
+			b.WriteByte(keyPath[i])
+			continue
+		}
+		i++
+		switch token := keyPath[i]; token {
+		case '%':
+			b.WriteByte('%')
+		case 'd':
+			home, err := os.UserHomeDir()
+			if err != nil {
+				unknown = append(unknown, "%d")
+				b.WriteString("%d")
+				continue
+			}
+			b.WriteString(home)
+		case 'h':
+			b.WriteString(conn.Host)
+		case 'n':
+			b.WriteString(alias)
+		case 'p':
+			b.WriteString(strconv.Itoa(conn.Port))
+		case 'r':
+			b.WriteString(conn.User)
+		case 'u':
+			u, err := user.Current()
+			if err != nil {
+				unknown = append(unknown, "%u")
+				b.WriteString("%u")
+				continue
+			}
+			b.WriteString(u.Username)
+		default:
+			unknown = append(unknown, "%"+string(token))
+			b.WriteString("%" + string(token))
+		}
+	}
+	return b.String(), unknown
+}
+
+// defaultUser returns the configured default user, or the local user name
+// like OpenSSH does when no User is given.
+func defaultUser(cfg *models.AppConfig) string {
+	if cfg.DefaultUser != "" {
+		return cfg.DefaultUser
+	}
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return ""
+}
+
+// managedSSHConfigHeader starts the file written by WriteManagedSSHConfig.
+const managedSSHConfigHeader = "# Generated by sm from its saved connections. Do not edit: changes are\n# overwritten whenever the connections change. Run `sm sync-ssh-config --remove` to stop.\n"
+
+// includeComment marks the Include line that sm adds to ~/.ssh/config.
+const includeComment = "# Added by sm sync-ssh-config"
+
+// RenderSSHConfig renders every connection as an OpenSSH Host block, sorted
+// by name, with the settings it inherits from its groups filled in. Jump
+// hosts refer to the other Host blocks by name. Passwords and port forwards
+// are not exported.
+func RenderSSHConfig(cfg *models.AppConfig) string {
+	names := make([]string, 0, len(cfg.Connections))
+	for name := range cfg.Connections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for i, name := range names {
+		conn := cfg.Resolve(cfg.Connections[name]).Connection
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		if conn.Description != "" {
+			fmt.Fprintf(&b, "# %s\n", conn.Description)
+		}
+		if len(conn.Tags) > 0 {
+			fmt.Fprintf(&b, "# tags: %s\n", strings.Join(conn.Tags, ", "))
+		}
+		fmt.Fprintf(&b, "Host %s\n", quoteSSHConfigArg(name))
+		fmt.Fprintf(&b, "    HostName %s\n", conn.Host)
+		if conn.User != "" {
+			fmt.Fprintf(&b, "    User %s\n", quoteSSHConfigArg(conn.User))
+		}
+		if conn.Port != 0 {
+			fmt.Fprintf(&b, "    Port %d\n", conn.Port)
+		}
+		if conn.KeyPath != "" {
+			fmt.Fprintf(&b, "    IdentityFile %s\n", quoteSSHConfigArg(conn.KeyPath))
+		}
+		if len(conn.JumpHosts) > 0 {
+			fmt.Fprintf(&b, "    ProxyJump %s\n", strings.Join(conn.JumpHosts, ","))
+		}
+		if conn.ForwardAgent {
+			b.WriteString("    ForwardAgent yes\n")
+		}
+		if conn.StrictHostKeyChecking != "" {
+			fmt.Fprintf(&b, "    StrictHostKeyChecking %s\n", conn.StrictHostKeyChecking)
+		}
+	}
+	return b.String()
+}
+
+// quoteSSHConfigArg double-quotes s if it contains whitespace.
+func quoteSSHConfigArg(s string) string {
+	if strings.ContainsAny(s, " \t") {
+		return `"` + s + `"`
+	}
+	return s
+}
+
+// ManagedSSHConfigPath returns the path of the OpenSSH config file that sm
+// keeps in sync with the connections of the configuration file in use.
+func ManagedSSHConfigPath() (string, error) {
+	return configFileStatePath("ssh_config")
+}
+
+// WriteManagedSSHConfig renders the connections into the managed OpenSSH config file.
+func WriteManagedSSHConfig(cfg *models.AppConfig) error {
+	file, err := ManagedSSHConfigPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return fmt.Errorf("could not create config directory: %w", err)
+	}
+	content := managedSSHConfigHeader + "\n" + RenderSSHConfig(cfg)
+	if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", file, err)
+	}
+	return nil
+}
+
+// managedSSHConfigEnabled reports whether the managed OpenSSH config file
+// exists, i.e. whether the user has run `sm sync-ssh-config`.
+func managedSSHConfigEnabled() bool {
+	file, err := ManagedSSHConfigPath()
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(file)
+	return err == nil
+}
+
+// AddSSHConfigInclude makes ~/.ssh/config include the managed file. The
+// Include is placed at the top, outside any Host block, so that it applies to
+// every host. It reports whether the file was changed.
+func AddSSHConfigInclude() (bool, error) {
+	userConfig, managed, lines, err := readUserSSHConfig()
+	if err != nil {
+		return false, err
+	}
+	if includeLineIndex(lines, managed) >= 0 {
+		return false, nil
+	}
+
+	include := []string{includeComment, "Include " + quoteSSHConfigArg(managed), ""}
+	lines = append(include, lines...)
+	return true, writeUserSSHConfig(userConfig, lines)
+}
+
+// RemoveSSHConfigInclude removes the Include of the managed file from
+// ~/.ssh/config. It reports whether the file was changed.
+func RemoveSSHConfigInclude() (bool, error) {
+	userConfig, managed, lines, err := readUserSSHConfig()
+	if err != nil {
+		return false, err
+	}
+	i := includeLineIndex(lines, managed)
+	if i < 0 {
+		return false, nil
+	}
+
+	start, end := i, i+1
+	if start > 0 && lines[start-1] == includeComment {
+		start--
+	}
+	if end < len(lines) && strings.TrimSpace(lines[end]) == "" {
+		end++
+	}
+	lines = append(lines[:start], lines[end:]...)
+	return true, writeUserSSHConfig(userConfig, lines)
+}
+
+// readUserSSHConfig returns the path and lines of ~/.ssh/config, together
+// with the path of the managed file. A missing file has no lines.
+func readUserSSHConfig() (userConfig, managed string, lines []string, err error) {
+	userConfig, err = DefaultSSHConfigPath()
+	if err != nil {
+		return "", "", nil, err
+	}
+	managed, err = ManagedSSHConfigPath()
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	data, err := os.ReadFile(userConfig)
+	if err != nil && !os.IsNotExist(err) {
+		return "", "", nil, fmt.Errorf("failed to read %s: %w", userConfig, err)
+	}
+	if len(data) > 0 {
+		lines = strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	}
+	return userConfig, managed, lines, nil
+}
+
+// includeLineIndex returns the index of the line including managed, or -1.
+func includeLineIndex(lines []string, managed string) int {
+	for i, line := range lines {
+		key, args, err := splitSSHConfigLine(line)
+		if err != nil || key != "include" {
+			continue
+		}
+		for _, arg := range args {
+			if expandHome(arg) == managed {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// writeUserSSHConfig writes lines to ~/.ssh/config, keeping its permissions.
+func writeUserSSHConfig(userConfig string, lines []string) error {
+	if err := os.MkdirAll(filepath.Dir(userConfig), 0700); err != nil {
+		return fmt.Errorf("could not create %s: %w", filepath.Dir(userConfig), err)
+	}
+	mode := os.FileMode(0600)
+	if info, err := os.Stat(userConfig); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	content := strings.Join(lines, "\n")
+	if content != "" {
+		content += "\n"
+	}
+	if err := os.WriteFile(userConfig, []byte(content), mode); err != nil {
+		return fmt.Errorf("failed to write %s: %w", userConfig, err)
+	}
+	return nil
+}
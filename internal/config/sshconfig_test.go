@@ -0,0 +1,270 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sm/internal/models"
+)
+
+// writeSSHConfig writes files into a fresh home's .ssh directory and returns
+// the path of the first one. HOME points at that home for the test.
+func writeSSHConfig(t *testing.T, files map[string]string, main string) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	dir := filepath.Join(home, ".ssh")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filepath.Join(dir, main)
+}
+
+func TestParseSSHConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		hosts    []string
+		get      map[string]string // "host key" -> value
+		warnings []string          // Substrings of the warnings, in order
+	}{
+		{
+			name: "first value wins and wildcards apply",
+			files: map[string]string{"config": `
+# comment
+Host web db
+    HostName 10.0.0.1
+Host web
+    HostName ignored
+    Port=2222
+Host *
+    User me
+    Port 22
+`},
+			hosts: []string{"web", "db"},
+			get: map[string]string{
+				"web hostname": "10.0.0.1",
+				"web port":     "2222",
+				"db port":      "22",
+				"db user":      "me",
+			},
+		},
+		{
+			name: "quoted arguments and case-insensitive keywords",
+			files: map[string]string{"config": `
+HOST box
+    identityfile "/keys/my key"
+    USER=admin
+`},
+			hosts: []string{"box"},
+			get: map[string]string{
+				"box IdentityFile": "/keys/my key",
+				"box user":         "admin",
+			},
+		},
+		{
+			name: "negated and wildcard patterns are not hosts",
+			files: map[string]string{"config": `
+Host *.internal !secret.internal app
+    User ops
+`},
+			hosts: []string{"app"},
+			get: map[string]string{
+				"app user":             "ops",
+				"db.internal user":     "ops",
+				"secret.internal user": "",
+			},
+		},
+		{
+			name: "match blocks are skipped",
+			files: map[string]string{"config": `
+Match host web
+    User nobody
+Host web
+    HostName 10.0.0.2
+`},
+			hosts:    []string{"web"},
+			get:      map[string]string{"web user": ""},
+			warnings: []string{"config:2: Match blocks are not supported"},
+		},
+		{
+			name: "include at top level",
+			files: map[string]string{
+				"config":   "Include *.conf\nHost after\n    User late\n",
+				"one.conf": "Host one\n    User first\n",
+			},
+			hosts: []string{"one", "after"},
+			get:   map[string]string{"one user": "first", "after user": "late"},
+		},
+		{
+			name: "include inside a host block is scoped to it",
+			files: map[string]string{
+				"config": `
+Host prod-*
+    Include inner
+    User deploy
+Host other
+    HostName 10.9.9.9
+`,
+				"inner": `
+Port 2200
+Host prod-db
+    HostName 10.0.1.1
+Host staging
+    HostName 10.0.2.1
+`,
+			},
+			hosts: []string{"prod-db", "other"},
+			get: map[string]string{
+				"prod-db hostname": "10.0.1.1",
+				"prod-db port":     "2200",
+				"prod-db user":     "deploy",
+				"prod-web port":    "2200",
+				"other port":       "",
+				"staging hostname": "",
+			},
+			warnings: []string{"inner:5: Host staging is in a file included from a Host block that does not match it"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseSSHConfig(writeSSHConfig(t, tt.files, "config"))
+			if err != nil {
+				t.Fatalf("ParseSSHConfig failed: %v", err)
+			}
+			if got := c.Hosts(); !reflect.DeepEqual(got, tt.hosts) {
+				t.Errorf("Hosts() = %q, want %q", got, tt.hosts)
+			}
+			for query, want := range tt.get {
+				host, key, _ := strings.Cut(query, " ")
+				if got := c.Get(host, key); got != want {
+					t.Errorf("Get(%q, %q) = %q, want %q", host, key, got, want)
+				}
+			}
+			if len(c.Warnings) != len(tt.warnings) {
+				t.Fatalf("Warnings = %q, want %d", c.Warnings, len(tt.warnings))
+			}
+			for i, want := range tt.warnings {
+				if !strings.Contains(c.Warnings[i], want) {
+					t.Errorf("Warnings[%d] = %q, want it to contain %q", i, c.Warnings[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseSSHConfigErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{"host without pattern", "Host\n", "Host requires at least one pattern"},
+		{"unterminated quote", `Host "web` + "\n", "unterminated quote"},
+		{"include cycle", "Include config\n", "too many nested includes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseSSHConfig(writeSSHConfig(t, map[string]string{"config": tt.config}, "config"))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ParseSSHConfig error = %v, want it to contain %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestSSHConfigConnections(t *testing.T) {
+	path := writeSSHConfig(t, map[string]string{"config": `
+Host bastion
+    HostName 10.0.0.1
+Host web
+    HostName %h.example.com
+    Port 2222
+    ProxyJump admin@bastion:2200,saved
+    IdentityFile ~/.ssh/%r@%h:%p
+    IdentityFile ~/.ssh/other
+    LocalForward 8080 localhost:80
+    ForwardAgent yes
+    StrictHostKeyChecking off
+Host odd
+    Port 99999
+    ProxyJump missing
+    IdentityFile %d/.ssh/%C
+Host *
+    User me
+`}, "config")
+	home := os.Getenv("HOME")
+
+	c, err := ParseSSHConfig(path)
+	if err != nil {
+		t.Fatalf("ParseSSHConfig failed: %v", err)
+	}
+	cfg := &models.AppConfig{Connections: map[string]models.Connection{"saved": {Name: "saved"}}}
+	conns, warnings := SSHConfigConnections(c, cfg)
+
+	want := []models.Connection{
+		{Name: "bastion", Host: "10.0.0.1", User: "me", Port: 22},
+		{
+			Name:                  "web",
+			Host:                  "web.example.com",
+			User:                  "me",
+			Port:                  2222,
+			KeyPath:               filepath.Join(home, ".ssh", "me@web.example.com:2222"),
+			JumpHosts:             []string{"bastion", "saved"},
+			ForwardAgent:          true,
+			StrictHostKeyChecking: models.HostKeyCheckingNo,
+			Forwards:              []models.Forward{{Name: "local-1", Type: models.ForwardLocal, Spec: "8080:localhost:80"}},
+		},
+		{Name: "odd", Host: "odd", User: "me", Port: 22, KeyPath: home + "/.ssh/%C"},
+	}
+	if !reflect.DeepEqual(conns, want) {
+		t.Errorf("SSHConfigConnections() =\n%+v\nwant\n%+v", conns, want)
+	}
+
+	wantWarnings := []string{
+		"web: only the first of 2 IdentityFile entries is used",
+		`web: jump host "admin@bastion:2200": the user and port of a hop are not kept`,
+		`odd: invalid Port "99999"`,
+		`odd: IdentityFile "%d/.ssh/%C" uses %C`,
+		`odd: jump host "missing" is not a saved or imported connection`,
+	}
+	if len(warnings) != len(wantWarnings) {
+		t.Fatalf("warnings = %q, want %d", warnings, len(wantWarnings))
+	}
+	for i, want := range wantWarnings {
+		if !strings.Contains(warnings[i], want) {
+			t.Errorf("warnings[%d] = %q, want it to contain %q", i, warnings[i], want)
+		}
+	}
+}
+
+func TestJumpHostName(t *testing.T) {
+	tests := []struct {
+		hop           string
+		name          string
+		hasUserOrPort bool
+	}{
+		{"bastion", "bastion", false},
+		{" bastion ", "bastion", false},
+		{"admin@bastion", "bastion", true},
+		{"bastion:2222", "bastion", true},
+		{"admin@bastion:2222", "bastion", true},
+		{"[fe80::1]", "fe80::1", false},
+		{"[fe80::1]:2222", "fe80::1", true},
+		{"fe80::1", "fe80::1", false},
+	}
+	for _, tt := range tests {
+		name, hasUserOrPort := jumpHostName(tt.hop)
+		if name != tt.name || hasUserOrPort != tt.hasUserOrPort {
+			t.Errorf("jumpHostName(%q) = %q, %v, want %q, %v", tt.hop, name, hasUserOrPort, tt.name, tt.hasUserOrPort)
+		}
+	}
+}
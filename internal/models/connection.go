@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
 
 // Connection represents a single SSH connection configuration.
 // It contains all necessary details to establish an SSH session.
@@ -11,12 +15,117 @@ type Connection struct {
 	Port        int               `json:"port" yaml:"port"`
 	User        string            `json:"user" yaml:"user"`
 	KeyPath     string            `json:"key_path,omitempty" yaml:"key_path,omitempty"`
-	Password    string            `json:"password,omitempty" yaml:"password,omitempty"` // Should be encrypted
+	Password    string            `json:"password,omitempty" yaml:"password,omitempty"` // Encrypted, or a secret reference such as ref:env:NAME
 	Tags        []string          `json:"tags,omitempty" yaml:"tags,omitempty"`
 	Description string            `json:"description,omitempty" yaml:"description,omitempty"`
+	Group       string            `json:"group,omitempty" yaml:"group,omitempty"` // Path of the group to inherit settings from, such as prod/eu/db
 	LastUsed    time.Time         `json:"last_used,omitempty" yaml:"last_used,omitempty"`
-	    CreatedAt   int64             `json:"created_at,omitempty" yaml:"created_at,omitempty"`
+	UseCount    int               `json:"use_count,omitempty" yaml:"use_count,omitempty"` // Sessions opened, for ranking by frecency
+	CreatedAt   time.Time         `json:"created_at,omitempty" yaml:"created_at,omitempty"`
 	Extra       map[string]string `json:"extra,omitempty" yaml:"extra,omitempty"`
+
+	// StrictHostKeyChecking controls how unknown or changed host keys are handled.
+	// One of the HostKeyChecking* values; an empty string means HostKeyCheckingAsk.
+	StrictHostKeyChecking string `json:"strict_host_key_checking,omitempty" yaml:"strict_host_key_checking,omitempty"`
+
+	// ForwardAgent forwards the local ssh-agent to the remote host, like `ssh -A`.
+	ForwardAgent bool `json:"forward_agent,omitempty" yaml:"forward_agent,omitempty"`
+
+	// KeyPassphrase is a secret reference, such as ref:keyring:NAME, to the
+	// passphrase of KeyPath; the ref: marker may be left out. Without it the
+	// passphrase is asked for.
+	KeyPassphrase string `json:"key_passphrase,omitempty" yaml:"key_passphrase,omitempty"`
+
+	// JumpHosts lists the names of saved connections to hop through, in order,
+	// before reaching this host (like OpenSSH's ProxyJump).
+	JumpHosts []string `json:"jump_hosts,omitempty" yaml:"jump_hosts,omitempty"`
+
+	// Forwards are named port forwards that can be brought up alongside a session.
+	Forwards []Forward `json:"forwards,omitempty" yaml:"forwards,omitempty"`
+}
+
+// Frecency scores how frequently and recently c has been used, as of now.
+// Each use counts for more the more recent the last one was, so a connection
+// used a few times today outranks one used often months ago.
+func (c Connection) Frecency(now time.Time) float64 {
+	if c.LastUsed.IsZero() {
+		return 0
+	}
+	uses := float64(c.UseCount)
+	if uses < 1 {
+		uses = 1 // Used before the counter existed
+	}
+	switch age := now.Sub(c.LastUsed); {
+	case age < time.Hour:
+		return uses * 4
+	case age < 24*time.Hour:
+		return uses * 2
+	case age < 7*24*time.Hour:
+		return uses
+	case age < 30*24*time.Hour:
+		return uses / 2
+	default:
+		return uses / 4
+	}
+}
+
+// Forward is a saved port forward for a connection.
+type Forward struct {
+	Name string `json:"name" yaml:"name"`
+	Type string `json:"type" yaml:"type"` // One of the Forward* values
+	Spec string `json:"spec" yaml:"spec"` // OpenSSH-style spec, e.g. "8080:db:5432" or "1080"
+}
+
+// Port forward types, matching OpenSSH's -L, -R and -D options.
+const (
+	ForwardLocal   = "local"
+	ForwardRemote  = "remote"
+	ForwardDynamic = "dynamic"
+)
+
+// Host key checking modes, mirroring OpenSSH's StrictHostKeyChecking option.
+const (
+	HostKeyCheckingYes       = "yes"        // Refuse unknown hosts and changed keys
+	HostKeyCheckingAsk       = "ask"        // Prompt on unknown hosts, refuse changed keys
+	HostKeyCheckingAcceptNew = "accept-new" // Save unknown hosts silently, refuse changed keys
+	HostKeyCheckingNo        = "no"         // Accept any host key (insecure)
+)
+
+// ValidHostKeyChecking reports whether mode is a recognised host key checking mode.
+// The empty string is accepted and means the default (ask).
+func ValidHostKeyChecking(mode string) bool {
+	switch mode {
+	case "", HostKeyCheckingYes, HostKeyCheckingAsk, HostKeyCheckingAcceptNew, HostKeyCheckingNo:
+		return true
+	}
+	return false
+}
+
+// ValidTag reports whether tag can be used as a connection tag. Tags cannot
+// be empty or contain spaces, commas, quotes, parentheses or glob characters,
+// so that they can be written in a list filter such as 'tag:prod AND tag:web'.
+func ValidTag(tag string) bool {
+	return tag != "" && !strings.ContainsAny(tag, " \t\r\n,'\"()*?[]\\")
+}
+
+// CleanTags checks that tags are valid and drops repeats, keeping the first of
+// each.
+func CleanTags(tags []string) ([]string, error) {
+	var cleaned []string
+	for _, tag := range tags {
+		if !ValidTag(tag) {
+			return nil, fmt.Errorf("invalid tag '%s': tags cannot be empty or contain spaces, commas, quotes, parentheses or glob characters", tag)
+		}
+		if !containsTag(cleaned, tag) {
+			cleaned = append(cleaned, tag)
+		}
+	}
+	return cleaned, nil
+}
+
+// HasTag reports whether c carries tag.
+func (c Connection) HasTag(tag string) bool {
+	return containsTag(c.Tags, tag)
 }
 
 // SSHKey represents an SSH key managed by the tool.
@@ -34,6 +143,35 @@ type Settings struct {
 	LogConnections   bool   `yaml:"log_connections"`
 	LogPath          string `yaml:"log_path"`
 	Editor           string `yaml:"editor"`
+
+	// Backups is the number of configuration backups to keep. Zero means the
+	// default (10) and a negative value disables backups.
+	Backups int `yaml:"backups,omitempty"`
+
+	// Encryption selects where the key that encrypts saved passwords comes from.
+	Encryption EncryptionSettings `yaml:"encryption,omitempty"`
+
+	// SecretProviders adds secret reference schemes that run a shell command
+	// to get the secret, with the reference in $SM_SECRET_REF.
+	SecretProviders map[string]string `yaml:"secret_providers,omitempty"`
+}
+
+// Key sources for password encryption.
+const (
+	KeySourceKeyring        = "keyring"         // Random key stored in the OS keyring (default)
+	KeySourceMasterPassword = "master-password" // Key derived from a master password
+)
+
+// EncryptionSettings describes how the password encryption key is obtained.
+// In master password mode the key is derived with Argon2id from the master
+// password and Salt; Check lets a wrong password be detected.
+type EncryptionSettings struct {
+	KeySource    string `yaml:"key_source,omitempty"` // One of the KeySource* values; empty means KeySourceKeyring
+	Salt         string `yaml:"salt,omitempty"`       // Base64
+	ArgonTime    uint32 `yaml:"argon_time,omitempty"`
+	ArgonMemory  uint32 `yaml:"argon_memory,omitempty"` // KiB
+	ArgonThreads uint8  `yaml:"argon_threads,omitempty"`
+	Check        string `yaml:"check,omitempty"` // Base64 HMAC of a fixed message with the derived key
 }
 
 // Config represents the entire configuration file.
@@ -41,11 +179,16 @@ type Settings struct {
 // Note: The name in the docs is `Config`, which can be confusing.
 // I'm naming it `AppConfig` to avoid conflicts with package names.
 type AppConfig struct {
+	// Version is the schema version of the configuration file. Older files
+	// are upgraded on load by the migrations in the config package.
+	Version int `json:"version" yaml:"version"`
+
 	NextID         int                   `json:"next_id" yaml:"next_id"`
 	DefaultUser    string                `yaml:"default_user,omitempty"`
 	DefaultPort    int                   `yaml:"default_port,omitempty"`
 	DefaultKeyPath string                `yaml:"default_key_path,omitempty"`
 	Connections    map[string]Connection `yaml:"connections"`
+	Groups         map[string]Group      `yaml:"groups,omitempty"` // Keyed by path, such as prod/eu
 	SSHKeys        map[string]SSHKey     `yaml:"ssh_keys,omitempty"`
 	Settings       Settings              `yaml:"settings"`
 }
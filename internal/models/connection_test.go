@@ -0,0 +1,63 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFrecency(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		age  time.Duration // Since the last use; 0 is never used
+		uses int
+		want float64
+	}{
+		{"never used", 0, 5, 0},
+		{"this hour", 10 * time.Minute, 3, 12},
+		{"today", 5 * time.Hour, 3, 6},
+		{"this week", 3 * 24 * time.Hour, 3, 3},
+		{"this month", 10 * 24 * time.Hour, 3, 1.5},
+		{"long ago", 90 * 24 * time.Hour, 3, 0.75},
+		{"used before the counter existed", 10 * time.Minute, 0, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Connection{UseCount: tt.uses}
+			if tt.age != 0 {
+				c.LastUsed = now.Add(-tt.age)
+			}
+			if got := c.Frecency(now); got != tt.want {
+				t.Errorf("Frecency() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCleanTags(t *testing.T) {
+	tests := []struct {
+		tags []string
+		want []string
+		err  string
+	}{
+		{nil, nil, ""},
+		{[]string{"prod", "web", "prod"}, []string{"prod", "web"}, ""},
+		{[]string{"prod", "a b"}, nil, "invalid tag 'a b'"},
+		{[]string{""}, nil, "invalid tag ''"},
+		{[]string{"web*"}, nil, "invalid tag 'web*'"},
+	}
+	for _, tt := range tests {
+		got, err := CleanTags(tt.tags)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("CleanTags(%q) error = %v, want it to contain %q", tt.tags, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("CleanTags(%q) = %q, %v, want %q", tt.tags, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Group holds settings shared by the connections in a group. Groups are named
+// by a path such as prod/eu/db, and a connection in prod/eu/db inherits from
+// prod/eu/db, prod/eu and prod, in that order, for each field it leaves empty.
+type Group struct {
+	User      string   `json:"user,omitempty" yaml:"user,omitempty"`
+	Port      int      `json:"port,omitempty" yaml:"port,omitempty"`
+	KeyPath   string   `json:"key_path,omitempty" yaml:"key_path,omitempty"`
+	JumpHosts []string `json:"jump_hosts,omitempty" yaml:"jump_hosts,omitempty"`
+	Tags      []string `json:"tags,omitempty" yaml:"tags,omitempty"` // Added to the tags of every connection in the group
+}
+
+// ValidGroup reports whether path is a valid group path: one or more names
+// separated by slashes, each a valid tag.
+func ValidGroup(path string) bool {
+	for _, name := range strings.Split(path, "/") {
+		if !ValidTag(name) || name == "." || name == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// GroupAncestors returns group and the groups above it, nearest first. For
+// prod/eu/db it returns prod/eu/db, prod/eu and prod.
+func GroupAncestors(group string) []string {
+	if group == "" {
+		return nil
+	}
+	var paths []string
+	for {
+		paths = append(paths, group)
+		i := strings.LastIndex(group, "/")
+		if i < 0 {
+			return paths
+		}
+		group = group[:i]
+	}
+}
+
+// Sources of an effective value, as reported by Resolve. A value inherited
+// from a group is reported as GroupSource of the group.
+const (
+	SourceConnection = "connection"
+	SourceDefaults   = "defaults" // default_user, default_port or default_key_path
+	SourceBuiltIn    = "built-in"
+)
+
+// GroupSource describes a value inherited from group.
+func GroupSource(group string) string {
+	return "group " + group
+}
+
+// Resolved is a connection with the values it inherits filled in.
+type Resolved struct {
+	Connection
+
+	// Sources tells where the user, port, key_path, jump_hosts and tags came
+	// from. Fields that are not set anywhere are missing. Tags are combined
+	// from every level, so their source lists each level that added some.
+	Sources map[string]string
+}
+
+// Resolve returns the effective settings of conn. Each of the user, port, key
+// path and jump hosts is taken from the connection if it sets it, else from
+// the nearest of its groups that does, else from the top-level defaults. The
+// port falls back to 22. Tags are combined from the groups and the connection.
+//
+// A connection never goes through itself or the hops after it, so the
+// bastions of a group can be in the group whose connections go through them:
+// with jump hosts b1,b2, b1 connects directly and b2 goes through b1.
+func (cfg *AppConfig) Resolve(conn Connection) Resolved {
+	r := Resolved{Connection: conn, Sources: make(map[string]string)}
+	groups := GroupAncestors(conn.Group)
+
+	r.User, r.Sources["user"] = inherit(conn.User, cfg.DefaultUser, cfg, groups, func(g Group) string { return g.User })
+	r.KeyPath, r.Sources["key_path"] = inherit(conn.KeyPath, cfg.DefaultKeyPath, cfg, groups, func(g Group) string { return g.KeyPath })
+
+	port, source := inherit(portString(conn.Port), portString(cfg.DefaultPort), cfg, groups, func(g Group) string { return portString(g.Port) })
+	if port == "" {
+		port, source = "22", SourceBuiltIn
+	}
+	r.Port, _ = strconv.Atoi(port)
+	r.Sources["port"] = source
+
+	if len(conn.JumpHosts) > 0 {
+		r.Sources["jump_hosts"] = SourceConnection
+	} else {
+		// The nearest group with jump hosts decides, even for its first hop
+		for _, path := range groups {
+			if chain := cfg.Groups[path].JumpHosts; len(chain) > 0 {
+				if hops := hopsBefore(chain, conn.Name); len(hops) > 0 {
+					r.JumpHosts, r.Sources["jump_hosts"] = hops, GroupSource(path)
+				}
+				break
+			}
+		}
+	}
+
+	// Tags from the outermost group first, then the connection's own
+	r.Tags = nil
+	var tagSources []string
+	addTags := func(tags []string, source string) {
+		added := false
+		for _, tag := range tags {
+			if !containsTag(r.Tags, tag) {
+				r.Tags = append(r.Tags, tag)
+				added = true
+			}
+		}
+		if added {
+			tagSources = append(tagSources, source)
+		}
+	}
+	for i := len(groups) - 1; i >= 0; i-- {
+		addTags(cfg.Groups[groups[i]].Tags, GroupSource(groups[i]))
+	}
+	addTags(conn.Tags, SourceConnection)
+	if len(tagSources) > 0 {
+		r.Sources["tags"] = strings.Join(tagSources, ", ")
+	}
+
+	for field, source := range r.Sources {
+		if source == "" {
+			delete(r.Sources, field)
+		}
+	}
+	return r
+}
+
+// inherit returns own if it is set, else the value of the nearest group in
+// groups that sets it, else def, together with where the value came from.
+func inherit(own, def string, cfg *AppConfig, groups []string, get func(Group) string) (string, string) {
+	if own != "" {
+		return own, SourceConnection
+	}
+	for _, path := range groups {
+		if v := get(cfg.Groups[path]); v != "" {
+			return v, GroupSource(path)
+		}
+	}
+	if def != "" {
+		return def, SourceDefaults
+	}
+	return "", ""
+}
+
+// portString formats a port for inherit, with the empty string for unset.
+func portString(port int) string {
+	if port == 0 {
+		return ""
+	}
+	return strconv.Itoa(port)
+}
+
+// containsTag reports whether tags contains tag.
+func containsTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// hopsBefore returns the hops of a jump chain that come before name, or all
+// of them if name is not in the chain.
+func hopsBefore(hops []string, name string) []string {
+	for i, hop := range hops {
+		if hop == name {
+			return hops[:i]
+		}
+	}
+	return hops
+}
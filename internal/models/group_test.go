@@ -0,0 +1,171 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidGroup(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"prod", true},
+		{"prod/eu/db", true},
+		{"", false},
+		{"prod/", false},
+		{"/prod", false},
+		{"prod//eu", false},
+		{"prod/..", false},
+		{"prod eu", false},
+	}
+	for _, tt := range tests {
+		if got := ValidGroup(tt.path); got != tt.want {
+			t.Errorf("ValidGroup(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestGroupAncestors(t *testing.T) {
+	tests := []struct {
+		group string
+		want  []string
+	}{
+		{"", nil},
+		{"prod", []string{"prod"}},
+		{"prod/eu/db", []string{"prod/eu/db", "prod/eu", "prod"}},
+	}
+	for _, tt := range tests {
+		if got := GroupAncestors(tt.group); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("GroupAncestors(%q) = %q, want %q", tt.group, got, tt.want)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	cfg := &AppConfig{
+		DefaultUser:    "admin",
+		DefaultKeyPath: "/keys/default",
+		Groups: map[string]Group{
+			"prod":    {User: "deploy", Port: 2222, JumpHosts: []string{"bastion"}, Tags: []string{"prod"}},
+			"prod/eu": {KeyPath: "/keys/eu", Tags: []string{"eu", "prod"}},
+			"dev":     {Tags: []string{"dev"}},
+		},
+	}
+	tests := []struct {
+		name    string
+		conn    Connection
+		user    string
+		port    int
+		keyPath string
+		jumps   []string
+		tags    []string
+		sources map[string]string
+	}{
+		{
+			name:    "no group uses the defaults",
+			conn:    Connection{Name: "solo"},
+			user:    "admin",
+			port:    22,
+			keyPath: "/keys/default",
+			sources: map[string]string{"user": SourceDefaults, "port": SourceBuiltIn, "key_path": SourceDefaults},
+		},
+		{
+			name:    "nearest group wins",
+			conn:    Connection{Name: "web", Group: "prod/eu", Tags: []string{"web"}},
+			user:    "deploy",
+			port:    2222,
+			keyPath: "/keys/eu",
+			jumps:   []string{"bastion"},
+			tags:    []string{"prod", "eu", "web"},
+			sources: map[string]string{
+				"user":       "group prod",
+				"port":       "group prod",
+				"key_path":   "group prod/eu",
+				"jump_hosts": "group prod",
+				"tags":       "group prod, group prod/eu, connection",
+			},
+		},
+		{
+			name:    "the connection's own values win",
+			conn:    Connection{Name: "db", Group: "prod/eu", User: "pg", Port: 5432, KeyPath: "/keys/db", JumpHosts: []string{"other"}, Tags: []string{"prod"}},
+			user:    "pg",
+			port:    5432,
+			keyPath: "/keys/db",
+			jumps:   []string{"other"},
+			tags:    []string{"prod", "eu"},
+			sources: map[string]string{
+				"user":       SourceConnection,
+				"port":       SourceConnection,
+				"key_path":   SourceConnection,
+				"jump_hosts": SourceConnection,
+				"tags":       "group prod, group prod/eu",
+			},
+		},
+		{
+			name:    "a bastion does not jump through itself",
+			conn:    Connection{Name: "bastion", Group: "prod"},
+			user:    "deploy",
+			port:    2222,
+			keyPath: "/keys/default",
+			tags:    []string{"prod"},
+			sources: map[string]string{"user": "group prod", "port": "group prod", "key_path": SourceDefaults, "tags": "group prod"},
+		},
+		{
+			name:    "unknown groups inherit nothing",
+			conn:    Connection{Name: "x", Group: "staging/eu"},
+			user:    "admin",
+			port:    22,
+			keyPath: "/keys/default",
+			sources: map[string]string{"user": SourceDefaults, "port": SourceBuiltIn, "key_path": SourceDefaults},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := cfg.Resolve(tt.conn)
+			if r.User != tt.user || r.Port != tt.port || r.KeyPath != tt.keyPath {
+				t.Errorf("Resolve() = user %q, port %d, key %q, want %q, %d, %q", r.User, r.Port, r.KeyPath, tt.user, tt.port, tt.keyPath)
+			}
+			if !reflect.DeepEqual(r.JumpHosts, tt.jumps) || !reflect.DeepEqual(r.Tags, tt.tags) {
+				t.Errorf("Resolve() = jumps %q, tags %q, want %q, %q", r.JumpHosts, r.Tags, tt.jumps, tt.tags)
+			}
+			if !reflect.DeepEqual(r.Sources, tt.sources) {
+				t.Errorf("Sources = %v, want %v", r.Sources, tt.sources)
+			}
+			if r.Name != tt.conn.Name || r.Group != tt.conn.Group {
+				t.Errorf("Resolve() changed the name or group: %+v", r.Connection)
+			}
+		})
+	}
+
+	// Defaults for the port apply below the groups
+	cfg.DefaultPort = 2200
+	if r := cfg.Resolve(Connection{Name: "d", Group: "dev"}); r.Port != 2200 || r.Sources["port"] != SourceDefaults {
+		t.Errorf("Resolve() port = %d from %q, want 2200 from defaults", r.Port, r.Sources["port"])
+	}
+}
+
+func TestResolveJumpChain(t *testing.T) {
+	cfg := &AppConfig{Groups: map[string]Group{
+		"prod":      {JumpHosts: []string{"gateway"}},
+		"prod/edge": {JumpHosts: []string{"b1", "b2"}},
+	}}
+	tests := []struct {
+		name  string
+		group string
+		want  []string
+	}{
+		{"app", "prod/edge", []string{"b1", "b2"}},
+		{"b2", "prod/edge", []string{"b1"}},
+		// The nearest group decides, so the first hop does not fall back to
+		// the chain of prod
+		{"b1", "prod/edge", nil},
+		{"gateway", "prod", nil},
+	}
+	for _, tt := range tests {
+		r := cfg.Resolve(Connection{Name: tt.name, Group: tt.group})
+		if !reflect.DeepEqual(r.JumpHosts, tt.want) {
+			t.Errorf("%s jumps through %q, want %q", tt.name, r.JumpHosts, tt.want)
+		}
+	}
+}
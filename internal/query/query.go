@@ -0,0 +1,279 @@
+// Package query parses the small filter language of 'sm list', such as
+// 'tag:prod AND user:root' or 'host:*.internal AND NOT (tag:old OR tag:test)'.
+//
+// A term is either field:pattern or a bare pattern, with the fields listed by
+// Fields. Patterns are case-insensitive globs in the syntax of path.Match. A
+// bare pattern matches the name, the host or any tag, and group:prod matches
+// the connections in prod and in its subgroups. Terms are combined with AND, OR and NOT
+// (written in capitals) and grouped with parentheses; terms next to each
+// other without an operator must all match. Values with spaces can be quoted.
+package query
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sm/internal/models"
+)
+
+// Expr is a parsed filter.
+type Expr interface {
+	// Match reports whether conn satisfies the filter.
+	Match(conn models.Connection) bool
+}
+
+// fields maps the field names of a term to the values of a connection it
+// matches against. A term matches if its pattern matches any of the values.
+var fields = map[string]func(c models.Connection) []string{
+	"name": func(c models.Connection) []string { return []string{c.Name} },
+	"host": func(c models.Connection) []string { return []string{c.Host} },
+	"user": func(c models.Connection) []string { return []string{c.User} },
+	"tag":  func(c models.Connection) []string { return c.Tags },
+	"port": func(c models.Connection) []string { return []string{strconv.Itoa(c.Port)} },
+	"id":   func(c models.Connection) []string { return []string{strconv.Itoa(c.ID)} },
+	"desc": func(c models.Connection) []string { return []string{c.Description} },
+	// A connection in prod/eu is also in prod
+	"group": func(c models.Connection) []string { return models.GroupAncestors(c.Group) },
+}
+
+// Fields returns the names of the fields a term can match, sorted.
+func Fields() []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Parse parses a filter expression.
+func Parse(s string) (Expr, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("empty filter")
+	}
+	p := &parser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok, ok := p.peek(); ok {
+		return nil, fmt.Errorf("unexpected %s in filter", tok)
+	}
+	return expr, nil
+}
+
+// token is a word, a quoted word or one of the operators and parentheses.
+type token struct {
+	text   string
+	quoted bool
+}
+
+func (t token) String() string {
+	return "'" + t.text + "'"
+}
+
+// is reports whether t is the operator or parenthesis op. Quoted words are
+// never operators.
+func (t token) is(op string) bool {
+	return !t.quoted && t.text == op
+}
+
+// tokenize splits s into words, quoted words and parentheses. A quote may also
+// start in the middle of a word, as in host:"my host".
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+	var word strings.Builder
+	inWord, quoted := false, false
+
+	flush := func() {
+		if inWord {
+			tokens = append(tokens, token{text: word.String(), quoted: quoted})
+		}
+		word.Reset()
+		inWord, quoted = false, false
+	}
+
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			flush()
+		case c == '(' || c == ')':
+			flush()
+			tokens = append(tokens, token{text: string(c)})
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(s[i+1:], c)
+			if end < 0 {
+				return nil, errors.New("unterminated quote in filter")
+			}
+			word.WriteString(s[i+1 : i+1+end])
+			inWord, quoted = true, true
+			i += end + 1
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	flush()
+	return tokens, nil
+}
+
+// parser is a recursive descent parser over the tokens. NOT binds tighter
+// than AND, which binds tighter than OR.
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok, ok := p.peek()
+		if !ok || !tok.is("OR") {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = or{left, right}
+	}
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok, ok := p.peek()
+		if !ok || tok.is("OR") || tok.is(")") {
+			return left, nil
+		}
+		if tok.is("AND") {
+			p.pos++
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = and{left, right}
+	}
+}
+
+func (p *parser) parseNot() (Expr, error) {
+	tok, ok := p.peek()
+	if ok && tok.is("NOT") {
+		p.pos++
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return not{expr}, nil
+	}
+	return p.parseTerm()
+}
+
+func (p *parser) parseTerm() (Expr, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return nil, errors.New("filter ends where a term was expected")
+	}
+	p.pos++
+
+	switch {
+	case tok.is("("):
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing, ok := p.peek(); !ok || !closing.is(")") {
+			return nil, errors.New("missing ')' in filter")
+		}
+		p.pos++
+		return expr, nil
+	case tok.is(")"), tok.is("AND"), tok.is("OR"):
+		return nil, fmt.Errorf("unexpected %s in filter", tok)
+	}
+	return newTerm(tok.text)
+}
+
+// term matches a glob pattern against some values of a connection.
+type term struct {
+	field   string // Empty for a bare pattern
+	pattern string // Lower case
+}
+
+// newTerm parses field:pattern or a bare pattern.
+func newTerm(text string) (Expr, error) {
+	t := term{pattern: strings.ToLower(text)}
+	if field, pattern, found := strings.Cut(text, ":"); found {
+		field = strings.ToLower(field)
+		if _, known := fields[field]; !known {
+			return nil, fmt.Errorf("unknown field '%s' in filter. Valid fields are %s", field, strings.Join(Fields(), ", "))
+		}
+		t.field, t.pattern = field, strings.ToLower(pattern)
+	}
+	if _, err := path.Match(t.pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern '%s' in filter: %w", text, err)
+	}
+	return t, nil
+}
+
+func (t term) Match(conn models.Connection) bool {
+	var values []string
+	if t.field == "" {
+		values = append([]string{conn.Name, conn.Host}, conn.Tags...)
+	} else {
+		values = fields[t.field](conn)
+	}
+	for _, v := range values {
+		if Glob(t.pattern, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Glob reports whether s matches the case-insensitive glob pattern, which
+// is in the syntax of path.Match. An invalid pattern matches nothing.
+func Glob(pattern, s string) bool {
+	matched, _ := path.Match(strings.ToLower(pattern), strings.ToLower(s))
+	return matched
+}
+
+type and struct{ left, right Expr }
+
+func (e and) Match(conn models.Connection) bool {
+	return e.left.Match(conn) && e.right.Match(conn)
+}
+
+type or struct{ left, right Expr }
+
+func (e or) Match(conn models.Connection) bool {
+	return e.left.Match(conn) || e.right.Match(conn)
+}
+
+type not struct{ expr Expr }
+
+func (e not) Match(conn models.Connection) bool {
+	return !e.expr.Match(conn)
+}
@@ -0,0 +1,90 @@
+package query
+
+import (
+	"strings"
+	"testing"
+
+	"sm/internal/models"
+)
+
+func TestParseMatch(t *testing.T) {
+	web := models.Connection{ID: 3, Name: "web-1", Host: "10.0.0.5", User: "root", Port: 22, Tags: []string{"prod", "web"}, Group: "prod/eu", Description: "Front end"}
+	db := models.Connection{ID: 7, Name: "db", Host: "db.internal", User: "postgres", Port: 5432, Tags: []string{"prod"}}
+	test := models.Connection{ID: 9, Name: "test box", Host: "10.1.0.1", User: "dev", Port: 2222, Tags: []string{"test", "old"}}
+
+	tests := []struct {
+		filter string
+		want   []string // Names of the connections that match
+	}{
+		{"prod", []string{"web-1", "db"}},
+		{"tag:prod", []string{"web-1", "db"}},
+		{"TAG:PROD", []string{"web-1", "db"}},
+		{"web*", []string{"web-1"}},
+		{"10.0.*", []string{"web-1"}},
+		{"host:*.internal", []string{"db"}},
+		{"tag:prod user:root", []string{"web-1"}},
+		{"tag:prod AND user:root", []string{"web-1"}},
+		{"user:root OR port:5432", []string{"web-1", "db"}},
+		{"NOT tag:prod", []string{"test box"}},
+		{"NOT tag:prod AND NOT tag:test", nil},
+		{"tag:web OR tag:test AND user:dev", []string{"web-1", "test box"}},
+		{"(tag:web OR tag:test) AND user:dev", []string{"test box"}},
+		{"host:10.* AND NOT (tag:old OR tag:web)", nil},
+		{"id:7", []string{"db"}},
+		{"port:22*", []string{"web-1", "test box"}},
+		{"group:prod", []string{"web-1"}},
+		{"group:prod/eu", []string{"web-1"}},
+		{"group:eu", nil},
+		{`"test box"`, []string{"test box"}},
+		{`name:"test *"`, []string{"test box"}},
+		{"desc:front*", []string{"web-1"}},
+		{"name:db?", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			expr, err := Parse(tt.filter)
+			if err != nil {
+				t.Fatalf("Parse(%q) failed: %v", tt.filter, err)
+			}
+			var got []string
+			for _, conn := range []models.Connection{web, db, test} {
+				if expr.Match(conn) {
+					got = append(got, conn.Name)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Parse(%q) matched %q, want %q", tt.filter, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		filter string
+		err    string
+	}{
+		{"", "empty filter"},
+		{"   ", "empty filter"},
+		{"color:red", "unknown field 'color'"},
+		{"tag:prod AND", "filter ends where a term was expected"},
+		{"AND tag:prod", "unexpected 'AND'"},
+		{"tag:prod OR OR tag:web", "unexpected 'OR'"},
+		{"(tag:prod", "missing ')'"},
+		{"tag:prod)", "unexpected ')'"},
+		{"()", "unexpected ')'"},
+		{`name:"web`, "unterminated quote"},
+		{"name:[web", "invalid pattern"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			_, err := Parse(tt.filter)
+			if err == nil {
+				t.Fatalf("Parse(%q) succeeded, want an error containing %q", tt.filter, tt.err)
+			}
+			if !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Parse(%q) error = %q, want it to contain %q", tt.filter, err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package ssh
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// agentSocketEnv is the environment variable pointing at the local ssh-agent socket.
+const agentSocketEnv = "SSH_AUTH_SOCK"
+
+// dialAgent connects to the local ssh-agent, if one is advertised through SSH_AUTH_SOCK.
+// It returns nil values without an error when no agent is configured.
+func dialAgent() (agent.ExtendedAgent, net.Conn, error) {
+	socket := os.Getenv(agentSocketEnv)
+	if socket == "" {
+		return nil, nil, nil
+	}
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to agent at %s: %w", socket, err)
+	}
+	return agent.NewClient(conn), conn, nil
+}
+
+// forwardAgent makes the local ssh-agent available on the remote host for
+// this session, as OpenSSH's -A option does.
+func forwardAgent(client *ssh.Client, session *ssh.Session) error {
+	socket := os.Getenv(agentSocketEnv)
+	if socket == "" {
+		return fmt.Errorf("%s is not set", agentSocketEnv)
+	}
+
+	if err := agent.ForwardToRemote(client, socket); err != nil {
+		return fmt.Errorf("failed to set up agent forwarding: %w", err)
+	}
+	if err := agent.RequestAgentForwarding(session); err != nil {
+		return fmt.Errorf("failed to request agent forwarding: %w", err)
+	}
+	return nil
+}
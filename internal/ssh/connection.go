@@ -2,8 +2,11 @@ package ssh
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
 	"os"
+	"strconv"
 	"strings"
 
 	"golang.org/x/crypto/ssh"
@@ -13,77 +16,30 @@ import (
 )
 
 // Connect establishes an interactive SSH session to a remote server.
-func Connect(conn *models.Connection) error {
-	var authMethods []ssh.AuthMethod
-
-	// Decrypt password if it exists
-
-decryptedPassword := conn.Password
-	if decryptedPassword != "" {
-		d, err := utils.Decrypt(decryptedPassword)
-		if err == nil {
-			decryptedPassword = d
-		} else {
-			// If decryption fails, assume it's a plaintext password (for backward compatibility)
-			fmt.Fprintf(os.Stderr, "Warning: Failed to decrypt password for %s. Assuming plaintext. Error: %v\n", conn.Name, err)
-		}
-	}
-
-	if conn.KeyPath != "" {
-		key, err := ioutil.ReadFile(conn.KeyPath)
-		if err != nil {
-			return fmt.Errorf("unable to read private key: %w", err)
-		}
-
-		var signer ssh.Signer
-		var parseErr error
-
-		// Try parsing without a passphrase first
-		signer, parseErr = ssh.ParsePrivateKey(key)
-
-		// If parsing without passphrase fails and it's due to passphrase protection, prompt for it
-		if parseErr != nil && strings.Contains(parseErr.Error(), "passphrase protected") {
-			fmt.Print("Enter passphrase for private key: ")
-			bytePassphrase, err := terminal.ReadPassword(int(os.Stdin.Fd()))
-			fmt.Println() // Newline after password input
-			if err != nil {
-				return fmt.Errorf("failed to read passphrase: %w", err)
-			}
-			passphrase := string(bytePassphrase)
-
-			signer, parseErr = ssh.ParsePrivateKeyWithPassphrase(key, []byte(passphrase))
-		}
-
-		// If there's still an error after trying with/without passphrase, return it
-		if parseErr != nil {
-			return fmt.Errorf("unable to parse private key: %w", parseErr)
-		}
-		authMethods = append(authMethods, ssh.PublicKeys(signer))
-	} else if decryptedPassword != "" {
-		authMethods = append(authMethods, ssh.Password(decryptedPassword))
-	}
-
-	sshConfig := &ssh.ClientConfig{
-		User: conn.User,
-		Auth: authMethods,
-		// IMPORTANT: In a real-world application, you should not ignore host key validation.
-		// This is a security risk. For this project, we will add it for convenience,
-		// but it should be replaced with a proper host key callback.
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-	}
-
-	client, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", conn.Host, conn.Port), sshConfig)
+func Connect(cfg *models.AppConfig, conn *models.Connection) error {
+	client, err := Dial(cfg, conn)
 	if err != nil {
-		return fmt.Errorf("failed to dial: %w", err)
+		return err
 	}
 	defer client.Close()
 
+	return Shell(client, conn)
+}
+
+// Shell runs an interactive shell for conn over an already established client.
+func Shell(client *ssh.Client, conn *models.Connection) error {
 	session, err := client.NewSession()
 	if err != nil {
 		return fmt.Errorf("failed to create session: %w", err)
 	}
 	defer session.Close()
 
+	if conn.ForwardAgent {
+		if err := forwardAgent(client, session); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: agent forwarding failed: %v\n", err)
+		}
+	}
+
 	// Set up terminal modes
 	fd := int(os.Stdin.Fd())
 	oldState, err := terminal.MakeRaw(fd)
@@ -103,10 +59,14 @@ decryptedPassword := conn.Password
 		return fmt.Errorf("failed to get terminal size: %w", err)
 	}
 
-	if err := session.RequestPty("xterm-256color", termHeight, termWidth, ssh.TerminalModes{}); err != nil {
+	if err := session.RequestPty(terminalType(), termHeight, termWidth, terminalModes()); err != nil {
 		return fmt.Errorf("failed to request pty: %w", err)
 	}
 
+	// Keep the remote PTY in sync with the local terminal for the whole session
+	stopResize := watchWindowSize(fd, session)
+	defer stopResize()
+
 	// Start shell
 	if err := session.Shell(); err != nil {
 		return fmt.Errorf("failed to start shell: %w", err)
@@ -114,4 +74,230 @@ decryptedPassword := conn.Password
 
 	// Wait for session to finish
 	return session.Wait()
-}
\ No newline at end of file
+}
+
+// Dial opens an authenticated SSH client connection to the server described by conn.
+// If conn names jump hosts, the connection is tunnelled through each of them in turn,
+// every hop authenticating with its own saved credentials from cfg.
+// Settings that conn and its jump hosts inherit from their groups are resolved first.
+// The caller is responsible for closing the returned client; closing it also closes
+// the connections to the jump hosts.
+func Dial(cfg *models.AppConfig, conn *models.Connection) (*ssh.Client, error) {
+	resolved := cfg.Resolve(*conn).Connection
+	conn = &resolved
+
+	chain, err := JumpChain(cfg, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	var hops []*ssh.Client
+	closeHops := func() {
+		for i := len(hops) - 1; i >= 0; i-- {
+			hops[i].Close()
+		}
+	}
+
+	var prev *ssh.Client
+	for _, hop := range append(chain, *conn) {
+		hop := hop
+		client, err := dialVia(prev, &hop)
+		if err != nil {
+			closeHops()
+			return nil, err
+		}
+		hops = append(hops, client)
+		prev = client
+	}
+
+	target := hops[len(hops)-1]
+	if len(hops) > 1 {
+		go func() {
+			target.Wait()
+			closeHops()
+		}()
+	}
+
+	return target, nil
+}
+
+// dialVia opens an authenticated client connection to conn, either directly
+// or, when via is non-nil, through a TCP connection tunnelled over via.
+func dialVia(via *ssh.Client, conn *models.Connection) (*ssh.Client, error) {
+	authMethods, agentConn, err := authMethods(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	addr := net.JoinHostPort(conn.Host, strconv.Itoa(conn.Port))
+	hostKeyCheck, hostKeyAlgorithms, err := hostKeyCallback(conn, addr)
+	if err != nil {
+		closeAgent(agentConn)
+		return nil, err
+	}
+
+	sshConfig := &ssh.ClientConfig{
+		User:              conn.User,
+		Auth:              authMethods,
+		HostKeyCallback:   hostKeyCheck,
+		HostKeyAlgorithms: hostKeyAlgorithms,
+	}
+
+	var client *ssh.Client
+	if via == nil {
+		client, err = ssh.Dial("tcp", addr, sshConfig)
+		if err != nil {
+			closeAgent(agentConn)
+			return nil, fmt.Errorf("failed to dial %s: %w", conn.Name, err)
+		}
+	} else {
+		tunnel, err := via.Dial("tcp", addr)
+		if err != nil {
+			closeAgent(agentConn)
+			return nil, fmt.Errorf("failed to open tunnel to %s: %w", conn.Name, err)
+		}
+		c, chans, reqs, err := ssh.NewClientConn(tunnel, addr, sshConfig)
+		if err != nil {
+			tunnel.Close()
+			closeAgent(agentConn)
+			return nil, fmt.Errorf("failed to dial %s: %w", conn.Name, err)
+		}
+		client = ssh.NewClient(c, chans, reqs)
+	}
+
+	// The agent is consulted lazily during authentication only, so it can be
+	// released once the client is gone.
+	if agentConn != nil {
+		go func() {
+			client.Wait()
+			agentConn.Close()
+		}()
+	}
+
+	return client, nil
+}
+
+// authMethods builds the authentication methods for conn, in order of preference:
+// the connection's key file and any ssh-agent identities, then its password.
+// If an agent is used, its connection is returned so it can be closed later.
+func authMethods(conn *models.Connection) ([]ssh.AuthMethod, io.Closer, error) {
+	var methods []ssh.AuthMethod
+	var signers []ssh.Signer
+
+	if conn.KeyPath != "" {
+		signer, err := loadKeyFile(conn.KeyPath, conn.KeyPassphrase)
+		if err != nil {
+			return nil, nil, err
+		}
+		signers = append(signers, signer)
+	}
+
+	agentClient, agentConn, err := dialAgent()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not use ssh-agent: %v\n", err)
+	}
+
+	// Only one "publickey" method is ever attempted by the client, so the key
+	// file and the agent identities are offered through a single callback.
+	if len(signers) > 0 || agentClient != nil {
+		methods = append(methods, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			all := signers
+			if agentClient != nil {
+				agentSigners, err := agentClient.Signers()
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: could not list ssh-agent identities: %v\n", err)
+				}
+				all = append(all, agentSigners...)
+			}
+			return all, nil
+		}))
+	}
+
+	// Resolve the password if it exists: a secret reference, a password
+	// marked as encrypted, or plaintext.
+	password, err := utils.ResolvePassword(conn.Password)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get the saved password for %s (see 'sm secrets verify'): %w", conn.Name, err)
+	}
+	if password != "" {
+		methods = append(methods, ssh.Password(password))
+	}
+
+	if agentConn == nil {
+		return methods, nil, nil
+	}
+	return methods, agentConn, nil
+}
+
+// loadKeyFile reads and parses a private key. If it is protected, the
+// passphrase is resolved from passphraseRef, or prompted for without one.
+func loadKeyFile(path, passphraseRef string) (ssh.Signer, error) {
+	key, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read private key: %w", err)
+	}
+
+	var signer ssh.Signer
+	var parseErr error
+
+	// Try parsing without a passphrase first
+	signer, parseErr = ssh.ParsePrivateKey(key)
+
+	// If parsing without passphrase fails and it's due to passphrase protection, resolve or prompt for it
+	if parseErr != nil && strings.Contains(parseErr.Error(), "passphrase protected") && passphraseRef != "" {
+		passphrase, err := utils.ResolveSecret(passphraseRef)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get passphrase for private key %s: %w", path, err)
+		}
+		signer, parseErr = ssh.ParsePrivateKeyWithPassphrase(key, []byte(passphrase))
+	} else if parseErr != nil && strings.Contains(parseErr.Error(), "passphrase protected") {
+		promptMu.Lock()
+		fmt.Printf("Enter passphrase for private key %s: ", path)
+		bytePassphrase, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Println() // Newline after password input
+		promptMu.Unlock()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read passphrase: %w", err)
+		}
+		passphrase := string(bytePassphrase)
+
+		signer, parseErr = ssh.ParsePrivateKeyWithPassphrase(key, []byte(passphrase))
+	}
+
+	// If there's still an error after trying with/without passphrase, return it
+	if parseErr != nil {
+		return nil, fmt.Errorf("unable to parse private key: %w", parseErr)
+	}
+	return signer, nil
+}
+
+// closeAgent closes an optional agent connection.
+func closeAgent(c io.Closer) {
+	if c != nil {
+		c.Close()
+	}
+}
+
+// defaultTerminalType is requested when the local $TERM is unset.
+const defaultTerminalType = "xterm-256color"
+
+// terminalType returns the terminal type to request for the remote PTY,
+// passing the local $TERM through when it is set.
+func terminalType() string {
+	if term := os.Getenv("TERM"); term != "" {
+		return term
+	}
+	return defaultTerminalType
+}
+
+// terminalModes returns the PTY modes requested for interactive sessions.
+func terminalModes() ssh.TerminalModes {
+	return ssh.TerminalModes{
+		ssh.ECHO:          1,
+		ssh.ICRNL:         1,
+		ssh.IXON:          1,
+		ssh.IUTF8:         1,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	}
+}
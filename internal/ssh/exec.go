@@ -0,0 +1,83 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/terminal"
+	"sm/internal/models"
+)
+
+// Default PTY size used when a PTY is forced but stdin is not a terminal.
+const (
+	defaultPtyWidth  = 80
+	defaultPtyHeight = 24
+)
+
+// ExecOptions controls how a remote command is run.
+type ExecOptions struct {
+	Stdin    io.Reader // Optional; nil means no input
+	Stdout   io.Writer
+	Stderr   io.Writer
+	ForcePTY bool // Allocate a PTY, like `ssh -t`
+}
+
+// Exec runs command on the remote host over an established client and
+// returns its exit status. Stdout and stderr are streamed separately unless a
+// PTY is allocated, in which case the remote side merges them.
+// A non-nil error means the command could not be run or its status is unknown.
+func Exec(client *ssh.Client, conn *models.Connection, command string, opts ExecOptions) (int, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return -1, fmt.Errorf("failed to create session: %w", err)
+	}
+	defer session.Close()
+
+	if conn.ForwardAgent {
+		if err := forwardAgent(client, session); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: agent forwarding failed: %v\n", err)
+		}
+	}
+
+	session.Stdin = opts.Stdin
+	session.Stdout = opts.Stdout
+	session.Stderr = opts.Stderr
+
+	if opts.ForcePTY {
+		fd := int(os.Stdin.Fd())
+		width, height := defaultPtyWidth, defaultPtyHeight
+
+		if terminal.IsTerminal(fd) {
+			if w, h, err := terminal.GetSize(fd); err == nil {
+				width, height = w, h
+			}
+
+			oldState, err := terminal.MakeRaw(fd)
+			if err != nil {
+				return -1, fmt.Errorf("failed to make terminal raw: %w", err)
+			}
+			defer terminal.Restore(fd, oldState)
+
+			stopResize := watchWindowSize(fd, session)
+			defer stopResize()
+		}
+
+		if err := session.RequestPty(terminalType(), height, width, terminalModes()); err != nil {
+			return -1, fmt.Errorf("failed to request pty: %w", err)
+		}
+	}
+
+	err = session.Run(command)
+	if err == nil {
+		return 0, nil
+	}
+
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitStatus(), nil
+	}
+	return -1, fmt.Errorf("failed to run command: %w", err)
+}
@@ -0,0 +1,256 @@
+package ssh
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"sm/internal/models"
+)
+
+// defaultBindAddress is used when a forward spec does not name a bind address.
+const defaultBindAddress = "127.0.0.1"
+
+// keepAliveInterval is how often the server is pinged while tunnels are open.
+const keepAliveInterval = 30 * time.Second
+
+// TunnelWarnings receives the warnings about connections that a tunnel could
+// not forward. Full-screen views replace it so the warnings do not garble the
+// screen.
+var TunnelWarnings io.Writer = os.Stderr
+
+// Tunnel is a parsed port forward.
+type Tunnel struct {
+	Name       string
+	Type       string // One of the models.Forward* values
+	BindAddr   string // Address to listen on (local for local/dynamic, remote for remote)
+	TargetAddr string // Address to connect to; empty for dynamic forwards
+}
+
+// String describes the tunnel for the user.
+func (t Tunnel) String() string {
+	switch t.Type {
+	case models.ForwardLocal:
+		return fmt.Sprintf("local %s -> %s", t.BindAddr, t.TargetAddr)
+	case models.ForwardRemote:
+		return fmt.Sprintf("remote %s -> %s", t.BindAddr, t.TargetAddr)
+	default:
+		return fmt.Sprintf("dynamic SOCKS5 on %s", t.BindAddr)
+	}
+}
+
+// ParseForward parses a forward in OpenSSH syntax:
+//
+//	local, remote: [bind_address:]port:host:hostport
+//	dynamic:       [bind_address:]port
+//
+// IPv6 addresses must be enclosed in square brackets.
+func ParseForward(f models.Forward) (Tunnel, error) {
+	parts, err := splitForwardSpec(f.Spec)
+	if err != nil {
+		return Tunnel{}, err
+	}
+
+	t := Tunnel{Name: f.Name, Type: f.Type}
+	switch f.Type {
+	case models.ForwardLocal, models.ForwardRemote:
+		if len(parts) == 3 {
+			parts = append([]string{defaultBindAddress}, parts...)
+		}
+		if len(parts) != 4 {
+			return Tunnel{}, fmt.Errorf("invalid %s forward %q: expected [bind_address:]port:host:hostport", f.Type, f.Spec)
+		}
+		if err := validatePort(parts[1]); err != nil {
+			return Tunnel{}, fmt.Errorf("invalid %s forward %q: %w", f.Type, f.Spec, err)
+		}
+		if err := validatePort(parts[3]); err != nil {
+			return Tunnel{}, fmt.Errorf("invalid %s forward %q: %w", f.Type, f.Spec, err)
+		}
+		t.BindAddr = net.JoinHostPort(bindHost(parts[0]), parts[1])
+		t.TargetAddr = net.JoinHostPort(parts[2], parts[3])
+	case models.ForwardDynamic:
+		if len(parts) == 1 {
+			parts = append([]string{defaultBindAddress}, parts...)
+		}
+		if len(parts) != 2 {
+			return Tunnel{}, fmt.Errorf("invalid dynamic forward %q: expected [bind_address:]port", f.Spec)
+		}
+		if err := validatePort(parts[1]); err != nil {
+			return Tunnel{}, fmt.Errorf("invalid dynamic forward %q: %w", f.Spec, err)
+		}
+		t.BindAddr = net.JoinHostPort(bindHost(parts[0]), parts[1])
+	default:
+		return Tunnel{}, fmt.Errorf("unknown forward type %q", f.Type)
+	}
+
+	return t, nil
+}
+
+// splitForwardSpec splits a spec on colons, keeping bracketed IPv6 addresses intact.
+func splitForwardSpec(spec string) ([]string, error) {
+	var parts []string
+	for spec != "" {
+		if spec[0] == '[' {
+			end := strings.IndexByte(spec, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid forward %q: unterminated '['", spec)
+			}
+			parts = append(parts, spec[1:end])
+			spec = spec[end+1:]
+			if spec != "" && spec[0] != ':' {
+				return nil, fmt.Errorf("invalid forward %q: expected ':' after ']'", spec)
+			}
+			spec = strings.TrimPrefix(spec, ":")
+			continue
+		}
+		i := strings.IndexByte(spec, ':')
+		if i < 0 {
+			parts = append(parts, spec)
+			break
+		}
+		parts = append(parts, spec[:i])
+		spec = spec[i+1:]
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("empty forward spec")
+	}
+	return parts, nil
+}
+
+// bindHost maps OpenSSH's wildcard bind addresses to one net.Listen understands.
+func bindHost(host string) string {
+	switch host {
+	case "", "*":
+		return "0.0.0.0"
+	case "localhost":
+		return defaultBindAddress
+	}
+	return host
+}
+
+// validatePort checks that s is a valid TCP port number.
+func validatePort(s string) error {
+	port, err := strconv.Atoi(s)
+	if err != nil || port < 0 || port > 65535 {
+		return fmt.Errorf("invalid port %q", s)
+	}
+	return nil
+}
+
+// StartTunnel starts forwarding traffic for t over client.
+// The returned closer stops the tunnel.
+func StartTunnel(client *ssh.Client, t Tunnel) (io.Closer, error) {
+	var listener net.Listener
+	var err error
+
+	switch t.Type {
+	case models.ForwardLocal, models.ForwardDynamic:
+		listener, err = net.Listen("tcp", t.BindAddr)
+	case models.ForwardRemote:
+		listener, err = client.Listen("tcp", t.BindAddr)
+	default:
+		return nil, fmt.Errorf("unknown forward type %q", t.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", t.BindAddr, err)
+	}
+
+	go func() {
+		for {
+			in, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go handleTunnelConn(client, t, in)
+		}
+	}()
+
+	return listener, nil
+}
+
+// handleTunnelConn connects one accepted connection to the tunnel's target.
+func handleTunnelConn(client *ssh.Client, t Tunnel, in net.Conn) {
+	var out net.Conn
+	var err error
+
+	switch t.Type {
+	case models.ForwardLocal:
+		out, err = client.Dial("tcp", t.TargetAddr)
+	case models.ForwardRemote:
+		out, err = net.Dial("tcp", t.TargetAddr)
+	case models.ForwardDynamic:
+		out, err = serveSOCKS5(in, func(addr string) (net.Conn, error) {
+			return client.Dial("tcp", addr)
+		})
+	}
+	if err != nil {
+		fmt.Fprintf(TunnelWarnings, "Warning: %s: %v\n", t, err)
+		in.Close()
+		return
+	}
+
+	pipe(in, out)
+}
+
+// pipe copies data in both directions until either side is done, then closes both.
+func pipe(a, b net.Conn) {
+	var once sync.Once
+	closeBoth := func() {
+		a.Close()
+		b.Close()
+	}
+
+	go func() {
+		io.Copy(a, b)
+		once.Do(closeBoth)
+	}()
+	io.Copy(b, a)
+	once.Do(closeBoth)
+}
+
+// StartTunnels starts every forward in forwards over client.
+// If one fails to start, the ones already started are stopped.
+func StartTunnels(client *ssh.Client, forwards []models.Forward) ([]io.Closer, error) {
+	var closers []io.Closer
+	for _, f := range forwards {
+		t, err := ParseForward(f)
+		if err == nil {
+			var c io.Closer
+			c, err = StartTunnel(client, t)
+			if err == nil {
+				closers = append(closers, c)
+				fmt.Printf("Forwarding %s\n", t)
+				continue
+			}
+		}
+		CloseAll(closers)
+		return nil, err
+	}
+	return closers, nil
+}
+
+// CloseAll closes every closer, ignoring errors.
+func CloseAll(closers []io.Closer) {
+	for _, c := range closers {
+		c.Close()
+	}
+}
+
+// KeepAlive pings the server periodically so idle tunnels are not dropped.
+// It closes the client and returns once the server stops answering.
+func KeepAlive(client *ssh.Client) {
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if _, _, err := client.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+			client.Close()
+			return
+		}
+	}
+}
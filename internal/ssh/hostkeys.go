@@ -0,0 +1,242 @@
+package ssh
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"sm/internal/config"
+	"sm/internal/models"
+)
+
+// promptMu serializes interactive prompts, so connections dialled in parallel
+// do not ask their questions on top of each other.
+var promptMu sync.Mutex
+
+// knownHostsFiles returns the user's OpenSSH known_hosts file and the one
+// managed by ssh-manager. The managed file is always the last entry and is
+// the one new keys are written to.
+func knownHostsFiles() ([]string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("could not get home directory: %w", err)
+	}
+	configDir, err := config.ConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	return []string{
+		filepath.Join(home, ".ssh", "known_hosts"),
+		filepath.Join(configDir, "known_hosts"),
+	}, nil
+}
+
+// hostKeyCallback builds a callback that verifies host keys against the
+// known_hosts files according to the connection's strict host key checking mode.
+// It also returns the host key algorithms already known for addr, so the server
+// is asked for a key type we can actually verify.
+func hostKeyCallback(conn *models.Connection, addr string) (ssh.HostKeyCallback, []string, error) {
+	mode := conn.StrictHostKeyChecking
+	if mode == "" {
+		mode = models.HostKeyCheckingAsk
+	}
+	if !models.ValidHostKeyChecking(mode) {
+		return nil, nil, fmt.Errorf("invalid strict_host_key_checking value %q", mode)
+	}
+	if mode == models.HostKeyCheckingNo {
+		return ssh.InsecureIgnoreHostKey(), nil, nil
+	}
+
+	files, err := knownHostsFiles()
+	if err != nil {
+		return nil, nil, err
+	}
+	managedFile := files[len(files)-1]
+
+	var existing []string
+	for _, f := range files {
+		if _, err := os.Stat(f); err == nil {
+			existing = append(existing, f)
+		}
+	}
+
+	check, err := knownhosts.New(existing...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read known_hosts: %w", err)
+	}
+
+	callback := func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := check(hostname, remote, key)
+		if err == nil {
+			return nil
+		}
+
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) {
+			return err
+		}
+
+		if len(keyErr.Want) > 0 {
+			printHostKeyChanged(hostname, key, keyErr.Want)
+			return fmt.Errorf("host key verification failed for %s", hostname)
+		}
+
+		switch mode {
+		case models.HostKeyCheckingYes:
+			return fmt.Errorf("no host key is known for %s and strict host key checking is enabled", hostname)
+		case models.HostKeyCheckingAsk:
+			if !confirmHostKey(hostname, remote, key) {
+				return fmt.Errorf("host key verification failed for %s", hostname)
+			}
+		}
+
+		if err := appendKnownHost(managedFile, hostname, remote, key); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not save host key: %v\n", err)
+			return nil
+		}
+		fmt.Fprintf(os.Stderr, "Warning: Permanently added '%s' (%s) to the list of known hosts.\n", knownhosts.Normalize(hostname), key.Type())
+		return nil
+	}
+
+	return callback, knownHostKeyAlgorithms(check, addr), nil
+}
+
+// knownHostKeyAlgorithms returns the host key algorithms recorded for addr.
+// It probes the callback with a throwaway key; the resulting KeyError lists
+// every key known for the host.
+func knownHostKeyAlgorithms(check ssh.HostKeyCallback, addr string) []string {
+	probe, err := probeKey()
+	if err != nil {
+		return nil
+	}
+
+	var keyErr *knownhosts.KeyError
+	err = check(addr, &net.TCPAddr{IP: net.IPv4zero}, probe)
+	if !errors.As(err, &keyErr) {
+		return nil
+	}
+
+	var algos []string
+	seen := make(map[string]bool)
+	for _, known := range keyErr.Want {
+		for _, algo := range algorithmsForKeyType(known.Key.Type()) {
+			if !seen[algo] {
+				seen[algo] = true
+				algos = append(algos, algo)
+			}
+		}
+	}
+	return algos
+}
+
+// algorithmsForKeyType maps a public key type to the signature algorithms a
+// server may use to present it.
+func algorithmsForKeyType(keyType string) []string {
+	if keyType == ssh.KeyAlgoRSA {
+		return []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}
+	}
+	return []string{keyType}
+}
+
+// probeKey returns a freshly generated public key that cannot match any known_hosts entry.
+func probeKey() (ssh.PublicKey, error) {
+	priv, err := GenerateEd25519Key()
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	return signer.PublicKey(), nil
+}
+
+// confirmHostKey asks the user whether to trust a host seen for the first time.
+func confirmHostKey(hostname string, remote net.Addr, key ssh.PublicKey) bool {
+	promptMu.Lock()
+	defer promptMu.Unlock()
+
+	if remoteAddr := routableAddr(remote); remoteAddr != "" {
+		fmt.Fprintf(os.Stderr, "The authenticity of host '%s (%s)' can't be established.\n", hostname, remoteAddr)
+	} else {
+		fmt.Fprintf(os.Stderr, "The authenticity of host '%s' can't be established.\n", hostname)
+	}
+	fmt.Fprintf(os.Stderr, "%s key fingerprint is %s.\n", key.Type(), ssh.FingerprintSHA256(key))
+
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Fprint(os.Stderr, "Are you sure you want to continue connecting (yes/no)? ")
+		answer, err := reader.ReadString('\n')
+		if err != nil {
+			return false
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "yes":
+			return true
+		case "no":
+			return false
+		}
+		fmt.Fprintln(os.Stderr, "Please type 'yes' or 'no'.")
+	}
+}
+
+// printHostKeyChanged warns loudly that the host presented a key that
+// differs from the recorded one.
+func printHostKeyChanged(hostname string, key ssh.PublicKey, known []knownhosts.KnownKey) {
+	fmt.Fprintln(os.Stderr, "@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@")
+	fmt.Fprintln(os.Stderr, "@    WARNING: REMOTE HOST IDENTIFICATION HAS CHANGED!     @")
+	fmt.Fprintln(os.Stderr, "@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@")
+	fmt.Fprintln(os.Stderr, "IT IS POSSIBLE THAT SOMEONE IS DOING SOMETHING NASTY!")
+	fmt.Fprintln(os.Stderr, "Someone could be eavesdropping on you right now (man-in-the-middle attack)!")
+	fmt.Fprintln(os.Stderr, "It is also possible that a host key has just been changed.")
+	fmt.Fprintf(os.Stderr, "The %s key sent by '%s' has fingerprint %s.\n", key.Type(), hostname, ssh.FingerprintSHA256(key))
+	for _, k := range known {
+		fmt.Fprintf(os.Stderr, "Known %s key in %s:%d has fingerprint %s.\n", k.Key.Type(), k.Filename, k.Line, ssh.FingerprintSHA256(k.Key))
+	}
+	fmt.Fprintln(os.Stderr, "Remove the offending entry from known_hosts if you trust the new key.")
+}
+
+// appendKnownHost records an accepted host key in the managed known_hosts file.
+func appendKnownHost(path, hostname string, remote net.Addr, key ssh.PublicKey) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("could not create known_hosts directory: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("could not open known_hosts file: %w", err)
+	}
+	defer f.Close()
+
+	addresses := []string{hostname}
+	if remoteAddr := routableAddr(remote); remoteAddr != "" && remoteAddr != hostname {
+		if host, _, err := net.SplitHostPort(hostname); err == nil && net.ParseIP(host) == nil {
+			addresses = append(addresses, remoteAddr)
+		}
+	}
+
+	if _, err := fmt.Fprintln(f, knownhosts.Line(addresses, key)); err != nil {
+		return fmt.Errorf("could not write known_hosts file: %w", err)
+	}
+	return nil
+}
+
+// routableAddr returns the string form of remote, or an empty string when it
+// carries no real address. Connections tunnelled through a jump host report
+// an unspecified remote address.
+func routableAddr(remote net.Addr) string {
+	if remote == nil {
+		return ""
+	}
+	if tcp, ok := remote.(*net.TCPAddr); ok && (tcp.IP == nil || tcp.IP.IsUnspecified()) {
+		return ""
+	}
+	return remote.String()
+}
@@ -0,0 +1,68 @@
+package ssh
+
+import (
+	"fmt"
+	"strings"
+
+	"sm/internal/models"
+)
+
+// JumpChain resolves the jump hosts of conn into the ordered list of saved
+// connections to hop through before reaching conn itself.
+//
+// Like OpenSSH's ProxyJump, the first jump host is reached using its own jump
+// hosts (resolved recursively), and every following jump host is dialled from
+// the one before it. An error is returned if a jump host does not exist, if
+// the jump hosts refer back to each other, or if any connection would appear
+// twice in the chain. Jump hosts inherited from groups are included, and the
+// returned connections have their inherited settings resolved.
+func JumpChain(cfg *models.AppConfig, conn *models.Connection) ([]models.Connection, error) {
+	resolved := cfg.Resolve(*conn).Connection
+	conn = &resolved
+
+	chain, err := resolveJumpChain(cfg, conn, []string{conn.Name})
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{conn.Name: true}
+	for _, hop := range chain {
+		if seen[hop.Name] {
+			return nil, fmt.Errorf("jump host '%s' appears more than once in the chain for '%s'", hop.Name, conn.Name)
+		}
+		seen[hop.Name] = true
+	}
+
+	return chain, nil
+}
+
+// resolveJumpChain does the work for JumpChain. stack holds the connections
+// currently being resolved and is used to detect cycles.
+func resolveJumpChain(cfg *models.AppConfig, conn *models.Connection, stack []string) ([]models.Connection, error) {
+	var chain []models.Connection
+
+	for i, name := range conn.JumpHosts {
+		for _, s := range stack {
+			if s == name {
+				return nil, fmt.Errorf("jump host cycle detected: %s -> %s", strings.Join(stack, " -> "), name)
+			}
+		}
+
+		saved, exists := cfg.Connections[name]
+		if !exists {
+			return nil, fmt.Errorf("jump host '%s' of '%s' does not exist", name, conn.Name)
+		}
+		hop := cfg.Resolve(saved).Connection
+
+		if i == 0 {
+			sub, err := resolveJumpChain(cfg, &hop, append(stack[:len(stack):len(stack)], name))
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, sub...)
+		}
+		chain = append(chain, hop)
+	}
+
+	return chain, nil
+}
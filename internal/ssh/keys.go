@@ -6,8 +6,10 @@ import (
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"golang.org/x/crypto/ssh"
 )
@@ -97,4 +99,35 @@ func WritePublicKey(key interface{}, path string) error {
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// DescribeKey returns the type and SHA256 fingerprint of the private key at
+// path. The public key is read from path.pub when it exists, so that keys
+// protected by a passphrase can be described without it.
+func DescribeKey(path string) (keyType, fingerprint string, err error) {
+	var publicKey ssh.PublicKey
+	if data, readErr := os.ReadFile(path + ".pub"); readErr == nil {
+		publicKey, _, _, _, err = ssh.ParseAuthorizedKey(data)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to parse public key %s.pub: %w", path, err)
+		}
+	} else {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", "", fmt.Errorf("unable to read private key: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(data)
+		var missing *ssh.PassphraseMissingError
+		switch {
+		case err == nil:
+			publicKey = signer.PublicKey()
+		case errors.As(err, &missing) && missing.PublicKey != nil:
+			publicKey = missing.PublicKey
+		case errors.As(err, &missing):
+			return "", "", fmt.Errorf("the key is protected by a passphrase and has no %s.pub file", filepath.Base(path))
+		default:
+			return "", "", fmt.Errorf("unable to parse private key: %w", err)
+		}
+	}
+	return publicKey.Type(), ssh.FingerprintSHA256(publicKey), nil
+}
@@ -0,0 +1,74 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestDescribeKey(t *testing.T) {
+	dir := t.TempDir()
+	key, err := GenerateEd25519Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := ssh.NewPublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprint := ssh.FingerprintSHA256(publicKey)
+
+	// write creates a file in dir and returns its path.
+	write := func(name string, data []byte) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	plain := filepath.Join(dir, "plain")
+	if err := WritePrivateKey(key, plain); err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKeyWithPassphrase(ed25519.PrivateKey(key), "", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	locked := write("locked", pem.EncodeToMemory(block))
+	lockedWithPub := write("locked-pub", pem.EncodeToMemory(block))
+	write("locked-pub.pub", ssh.MarshalAuthorizedKey(publicKey))
+
+	tests := []struct {
+		name string
+		path string
+		err  string
+	}{
+		{"private key", plain, ""},
+		{"passphrase with a .pub file", lockedWithPub, ""},
+		// OpenSSH keys carry their public key unencrypted
+		{"passphrase without a .pub file", locked, ""},
+		{"missing", filepath.Join(dir, "missing"), "unable to read private key"},
+		{"not a key", write("junk", []byte("junk")), "unable to parse private key"},
+		{"bad .pub file", func() string { write("bad.pub", []byte("junk")); return write("bad", nil) }(), "failed to parse public key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyType, got, err := DescribeKey(tt.path)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("DescribeKey error = %v, want it to contain %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil || keyType != ssh.KeyAlgoED25519 || got != fingerprint {
+				t.Errorf("DescribeKey() = %q, %q, %v, want %q, %q", keyType, got, err, ssh.KeyAlgoED25519, fingerprint)
+			}
+		})
+	}
+}
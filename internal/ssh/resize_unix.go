@@ -0,0 +1,40 @@
+//go:build !windows
+
+package ssh
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// watchWindowSize forwards local terminal resizes to the remote session until
+// the returned stop function is called. On Unix it listens for SIGWINCH.
+func watchWindowSize(fd int, session *ssh.Session) (stop func()) {
+	sigwinch := make(chan os.Signal, 1)
+	signal.Notify(sigwinch, syscall.SIGWINCH)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-sigwinch:
+				width, height, err := terminal.GetSize(fd)
+				if err != nil {
+					continue
+				}
+				session.WindowChange(height, width)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigwinch)
+		close(done)
+	}
+}
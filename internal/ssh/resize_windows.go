@@ -0,0 +1,43 @@
+//go:build windows
+
+package ssh
+
+import (
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// resizePollInterval is how often the console size is checked on Windows,
+// which has no equivalent of SIGWINCH.
+const resizePollInterval = 250 * time.Millisecond
+
+// watchWindowSize forwards local terminal resizes to the remote session until
+// the returned stop function is called. On Windows it polls the console size.
+func watchWindowSize(fd int, session *ssh.Session) (stop func()) {
+	done := make(chan struct{})
+	lastWidth, lastHeight, _ := terminal.GetSize(fd)
+
+	go func() {
+		ticker := time.NewTicker(resizePollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				width, height, err := terminal.GetSize(fd)
+				if err != nil || (width == lastWidth && height == lastHeight) {
+					continue
+				}
+				lastWidth, lastHeight = width, height
+				session.WindowChange(height, width)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+	}
+}
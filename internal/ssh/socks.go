@@ -0,0 +1,123 @@
+package ssh
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+)
+
+// SOCKS5 protocol constants (RFC 1928).
+const (
+	socksVersion5 = 0x05
+
+	socksMethodNoAuth       = 0x00
+	socksMethodNoAcceptable = 0xff
+
+	socksCmdConnect = 0x01
+
+	socksAddrIPv4   = 0x01
+	socksAddrDomain = 0x03
+	socksAddrIPv6   = 0x04
+
+	socksReplySucceeded           = 0x00
+	socksReplyGeneralFailure      = 0x01
+	socksReplyCommandNotSupported = 0x07
+	socksReplyAddrNotSupported    = 0x08
+)
+
+// serveSOCKS5 performs the server side of a SOCKS5 handshake on conn and
+// connects to the requested destination with dial. Only the CONNECT command
+// without authentication is supported, which is all a dynamic forward needs.
+func serveSOCKS5(conn net.Conn, dial func(addr string) (net.Conn, error)) (net.Conn, error) {
+	// Greeting: VER NMETHODS METHODS...
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, fmt.Errorf("socks: failed to read greeting: %w", err)
+	}
+	if header[0] != socksVersion5 {
+		return nil, fmt.Errorf("socks: unsupported version %d", header[0])
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return nil, fmt.Errorf("socks: failed to read methods: %w", err)
+	}
+
+	noAuth := false
+	for _, m := range methods {
+		if m == socksMethodNoAuth {
+			noAuth = true
+		}
+	}
+	if !noAuth {
+		conn.Write([]byte{socksVersion5, socksMethodNoAcceptable})
+		return nil, errors.New("socks: client does not support unauthenticated access")
+	}
+	if _, err := conn.Write([]byte{socksVersion5, socksMethodNoAuth}); err != nil {
+		return nil, fmt.Errorf("socks: failed to write method: %w", err)
+	}
+
+	// Request: VER CMD RSV ATYP DST.ADDR DST.PORT
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return nil, fmt.Errorf("socks: failed to read request: %w", err)
+	}
+	if request[1] != socksCmdConnect {
+		writeSOCKS5Reply(conn, socksReplyCommandNotSupported)
+		return nil, fmt.Errorf("socks: unsupported command %d", request[1])
+	}
+
+	var host string
+	switch request[3] {
+	case socksAddrIPv4, socksAddrIPv6:
+		size := net.IPv4len
+		if request[3] == socksAddrIPv6 {
+			size = net.IPv6len
+		}
+		ip := make([]byte, size)
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return nil, fmt.Errorf("socks: failed to read address: %w", err)
+		}
+		host = net.IP(ip).String()
+	case socksAddrDomain:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return nil, fmt.Errorf("socks: failed to read address: %w", err)
+		}
+		domain := make([]byte, length[0])
+		if _, err := io.ReadFull(conn, domain); err != nil {
+			return nil, fmt.Errorf("socks: failed to read address: %w", err)
+		}
+		host = string(domain)
+	default:
+		writeSOCKS5Reply(conn, socksReplyAddrNotSupported)
+		return nil, fmt.Errorf("socks: unsupported address type %d", request[3])
+	}
+
+	portBytes := make([]byte, 2)
+	if _, err := io.ReadFull(conn, portBytes); err != nil {
+		return nil, fmt.Errorf("socks: failed to read port: %w", err)
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(portBytes))))
+
+	target, err := dial(addr)
+	if err != nil {
+		writeSOCKS5Reply(conn, socksReplyGeneralFailure)
+		return nil, fmt.Errorf("socks: failed to connect to %s: %w", addr, err)
+	}
+	if err := writeSOCKS5Reply(conn, socksReplySucceeded); err != nil {
+		target.Close()
+		return nil, fmt.Errorf("socks: failed to write reply: %w", err)
+	}
+
+	return target, nil
+}
+
+// writeSOCKS5Reply sends a reply with the given status. The bound address is
+// reported as 0.0.0.0:0 since it is not meaningful for a tunnelled connection.
+func writeSOCKS5Reply(conn net.Conn, status byte) error {
+	_, err := conn.Write([]byte{socksVersion5, status, 0x00, socksAddrIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
@@ -0,0 +1,352 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"sm/internal/utils"
+)
+
+// errNotRegular is returned when a transfer source is neither a file nor a directory.
+var errNotRegular = errors.New("not a regular file or directory")
+
+// errUnsafeName is returned for a directory entry whose name would put it
+// outside the directory being copied to.
+var errUnsafeName = errors.New("unsafe file name")
+
+// TransferOptions controls how files are copied by Upload and Download.
+type TransferOptions struct {
+	Recursive bool // Copy directories and their contents
+	Preserve  bool // Keep permissions and modification times
+	Resume    bool // Continue partial transfers instead of starting over
+	Progress  bool // Draw a progress bar for every file
+}
+
+// NewSFTPClient opens an SFTP session over an established client.
+// The caller is responsible for closing it.
+func NewSFTPClient(client *ssh.Client) (*sftp.Client, error) {
+	sc, err := sftp.NewClient(client, sftp.UseConcurrentWrites(true))
+	if err != nil {
+		return nil, fmt.Errorf("failed to start sftp session: %w", err)
+	}
+	return sc, nil
+}
+
+// Upload copies local files to dest on the remote host. Sources may be glob
+// patterns. If there is more than one source, dest must be an existing directory.
+func Upload(sc *sftp.Client, sources []string, dest string, opts TransferOptions) error {
+	return transfer(localFS{}, remoteFS{sc}, sources, dest, opts)
+}
+
+// Download copies remote files to dest on the local machine. Sources may be
+// glob patterns. If there is more than one source, dest must be an existing directory.
+func Download(sc *sftp.Client, sources []string, dest string, opts TransferOptions) error {
+	return transfer(remoteFS{sc}, localFS{}, sources, dest, opts)
+}
+
+// transferFile is the subset of *os.File and *sftp.File used for copying.
+type transferFile interface {
+	io.Reader
+	io.Writer
+	io.Seeker
+	io.Closer
+}
+
+// fileSystem abstracts the local and remote sides of a transfer, so uploads
+// and downloads share the same copy logic.
+type fileSystem interface {
+	Stat(name string) (os.FileInfo, error)
+	// OpenFile opens name, creating it with the permission bits perm if
+	// flag includes os.O_CREATE and the file system supports it.
+	OpenFile(name string, flag int, perm os.FileMode) (transferFile, error)
+	ReadDir(name string) ([]os.FileInfo, error)
+	Mkdir(name string) error
+	Chmod(name string, mode os.FileMode) error
+	Chtimes(name string, atime, mtime time.Time) error
+	Glob(pattern string) ([]string, error)
+	Join(elem ...string) string
+	Base(name string) string
+	Dir(name string) string
+}
+
+// localFS is the local file system.
+type localFS struct{}
+
+func (localFS) Stat(name string) (os.FileInfo, error) { return os.Stat(name) }
+func (localFS) OpenFile(name string, flag int, perm os.FileMode) (transferFile, error) {
+	return os.OpenFile(name, flag, perm)
+}
+func (localFS) ReadDir(name string) ([]os.FileInfo, error) {
+	entries, err := os.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+func (localFS) Mkdir(name string) error                   { return os.Mkdir(name, 0755) }
+func (localFS) Chmod(name string, mode os.FileMode) error { return os.Chmod(name, mode) }
+func (localFS) Chtimes(name string, atime, mtime time.Time) error {
+	return os.Chtimes(name, atime, mtime)
+}
+func (localFS) Glob(pattern string) ([]string, error) { return filepath.Glob(pattern) }
+func (localFS) Join(elem ...string) string            { return filepath.Join(elem...) }
+func (localFS) Base(name string) string               { return filepath.Base(name) }
+func (localFS) Dir(name string) string                { return filepath.Dir(name) }
+
+// remoteFS is the file system of the remote host, accessed over SFTP.
+// Paths starting with "~/" are resolved relative to the remote home directory.
+// New files get the server's default mode, since SFTP cannot pass one when
+// opening a file; --preserve sets it afterwards.
+type remoteFS struct {
+	sc *sftp.Client
+}
+
+func (r remoteFS) Stat(name string) (os.FileInfo, error) { return r.sc.Stat(remotePath(name)) }
+func (r remoteFS) OpenFile(name string, flag int, perm os.FileMode) (transferFile, error) {
+	return r.sc.OpenFile(remotePath(name), flag)
+}
+func (r remoteFS) ReadDir(name string) ([]os.FileInfo, error) {
+	return r.sc.ReadDir(remotePath(name))
+}
+func (r remoteFS) Mkdir(name string) error { return r.sc.Mkdir(remotePath(name)) }
+func (r remoteFS) Chmod(name string, mode os.FileMode) error {
+	return r.sc.Chmod(remotePath(name), mode)
+}
+func (r remoteFS) Chtimes(name string, atime, mtime time.Time) error {
+	return r.sc.Chtimes(remotePath(name), atime, mtime)
+}
+func (r remoteFS) Glob(pattern string) ([]string, error) { return r.sc.Glob(remotePath(pattern)) }
+func (remoteFS) Join(elem ...string) string              { return path.Join(elem...) }
+func (remoteFS) Base(name string) string                 { return path.Base(name) }
+func (remoteFS) Dir(name string) string                  { return path.Dir(name) }
+
+// remotePath strips a leading "~/" since SFTP paths are already relative to the home directory.
+func remotePath(name string) string {
+	if name == "~" {
+		return "."
+	}
+	return strings.TrimPrefix(name, "~/")
+}
+
+// transfer copies sources on src to dest on dst.
+func transfer(src, dst fileSystem, sources []string, dest string, opts TransferOptions) error {
+	expanded, err := expandSources(src, sources)
+	if err != nil {
+		return err
+	}
+
+	destIsDir := false
+	if info, err := dst.Stat(dest); err == nil && info.IsDir() {
+		destIsDir = true
+	}
+	if len(expanded) > 1 && !destIsDir {
+		return fmt.Errorf("destination %s must be an existing directory when copying multiple files", dest)
+	}
+
+	for _, source := range expanded {
+		target := dest
+		if destIsDir {
+			target = dst.Join(dest, src.Base(source))
+		}
+		if err := copyPath(src, dst, source, target, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expandSources resolves glob patterns in sources. Plain paths are kept as-is.
+func expandSources(src fileSystem, sources []string) ([]string, error) {
+	var expanded []string
+	for _, source := range sources {
+		if !strings.ContainsAny(source, "*?[") {
+			expanded = append(expanded, source)
+			continue
+		}
+		matches, err := src.Glob(source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %w", source, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %s", source)
+		}
+		expanded = append(expanded, matches...)
+	}
+	return expanded, nil
+}
+
+// copyPath copies a single file or, when recursive, a directory tree.
+func copyPath(src, dst fileSystem, source, target string, opts TransferOptions) error {
+	info, err := src.Stat(source)
+	if err != nil {
+		return fmt.Errorf("cannot access %s: %w", source, err)
+	}
+
+	if info.Mode().IsRegular() {
+		return copyFile(src, dst, source, target, info, opts)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("cannot copy %s: %w", source, errNotRegular)
+	}
+
+	if !opts.Recursive {
+		return fmt.Errorf("%s is a directory (use -r to copy directories)", source)
+	}
+
+	if err := dst.Mkdir(target); err != nil {
+		if existing, statErr := dst.Stat(target); statErr != nil || !existing.IsDir() {
+			return fmt.Errorf("failed to create directory %s: %w", target, err)
+		}
+	}
+
+	entries, err := src.ReadDir(source)
+	if err != nil {
+		return fmt.Errorf("failed to read directory %s: %w", source, err)
+	}
+	for _, entry := range entries {
+		// The names come from the other side, which may not be trusted
+		name := entry.Name()
+		child := dst.Join(target, name)
+		if !safeEntryName(name) || dst.Dir(child) != dst.Join(target) {
+			return fmt.Errorf("cannot copy %q from %s: %w", name, source, errUnsafeName)
+		}
+		if err := copyPath(src, dst, src.Join(source, name), child, opts); err != nil {
+			return err
+		}
+	}
+
+	// Directory times are set last, since writing the children changes them
+	return preserve(dst, target, info, opts)
+}
+
+// safeEntryName reports whether name is a plain file name, which stays in the
+// directory it is joined to.
+func safeEntryName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+// copyFile copies one regular file, resuming a partial copy if requested.
+func copyFile(src, dst fileSystem, source, target string, info os.FileInfo, opts TransferOptions) error {
+	var offset int64
+	if opts.Resume {
+		if existing, err := dst.Stat(target); err == nil && !existing.IsDir() {
+			switch {
+			case existing.Size() == info.Size():
+				fmt.Fprintf(os.Stderr, "Skipping %s: already complete\n", target)
+				return preserve(dst, target, info, opts)
+			case existing.Size() < info.Size():
+				offset = existing.Size()
+			}
+		}
+	}
+
+	in, err := src.OpenFile(source, os.O_RDONLY, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", source, err)
+	}
+	defer in.Close()
+
+	flags := os.O_WRONLY | os.O_CREATE
+	if offset == 0 {
+		flags |= os.O_TRUNC
+	}
+	// New files get the permission bits of the source, less the umask
+	out, err := dst.OpenFile(target, flags, info.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", target, err)
+	}
+
+	if offset > 0 {
+		if _, err := in.Seek(offset, io.SeekStart); err != nil {
+			out.Close()
+			return fmt.Errorf("failed to resume %s: %w", source, err)
+		}
+		if _, err := out.Seek(offset, io.SeekStart); err != nil {
+			out.Close()
+			return fmt.Errorf("failed to resume %s: %w", target, err)
+		}
+	}
+
+	progress := utils.NewProgress(src.Base(source), info.Size(), offset, opts.Progress)
+	_, copyErr := copyData(out, in, progress, info.Size()-offset)
+	progress.Finish()
+
+	if err := out.Close(); err != nil && copyErr == nil {
+		copyErr = err
+	}
+	if copyErr != nil {
+		return fmt.Errorf("failed to copy %s to %s: %w", source, target, copyErr)
+	}
+
+	return preserve(dst, target, info, opts)
+}
+
+// copyData copies in to out while reporting progress. Progress is counted on
+// the local side, so the SFTP file keeps its concurrent fast path: reading an
+// *sftp.File via WriteTo, or writing one via ReadFrom with a known size.
+func copyData(out, in transferFile, progress *utils.Progress, size int64) (int64, error) {
+	if _, remote := in.(*sftp.File); remote {
+		return io.Copy(&progressWriter{w: out, progress: progress}, in)
+	}
+	return io.Copy(out, &progressReader{r: in, progress: progress, size: size})
+}
+
+// preserve copies permissions and times from info to target if requested.
+func preserve(dst fileSystem, target string, info os.FileInfo, opts TransferOptions) error {
+	if !opts.Preserve {
+		return nil
+	}
+	if err := dst.Chmod(target, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to preserve permissions of %s: %w", target, err)
+	}
+	if err := dst.Chtimes(target, info.ModTime(), info.ModTime()); err != nil {
+		return fmt.Errorf("failed to preserve times of %s: %w", target, err)
+	}
+	return nil
+}
+
+// progressReader counts bytes read into a progress bar.
+type progressReader struct {
+	r        io.Reader
+	progress *utils.Progress
+	size     int64
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.progress.Add(n)
+	return n, err
+}
+
+// Size reports the number of bytes left to read, which lets sftp write concurrently.
+func (p *progressReader) Size() int64 {
+	return p.size
+}
+
+// progressWriter counts bytes written into a progress bar.
+type progressWriter struct {
+	w        io.Writer
+	progress *utils.Progress
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.progress.Add(n)
+	return n, err
+}
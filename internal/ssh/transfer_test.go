@@ -0,0 +1,114 @@
+package ssh
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// memFile is a file or directory of memFS.
+type memFile struct {
+	name    string
+	data    string
+	mode    os.FileMode
+	entries []memFile // Entries of a directory, as listed
+}
+
+func (f memFile) Name() string       { return f.name }
+func (f memFile) Size() int64        { return int64(len(f.data)) }
+func (f memFile) Mode() os.FileMode  { return f.mode }
+func (f memFile) ModTime() time.Time { return time.Time{} }
+func (f memFile) IsDir() bool        { return f.mode.IsDir() }
+func (f memFile) Sys() interface{}   { return nil }
+
+// memFS is a read-only file system standing in for a remote host, which
+// can list entries under any name.
+type memFS map[string]memFile
+
+// memReader is an open memFile.
+type memReader struct{ *bytes.Reader }
+
+func (memReader) Write([]byte) (int, error) { return 0, errors.New("read-only") }
+func (memReader) Close() error              { return nil }
+
+func (m memFS) Stat(name string) (os.FileInfo, error) {
+	if f, ok := m[name]; ok {
+		return f, nil
+	}
+	return nil, fs.ErrNotExist
+}
+func (m memFS) OpenFile(name string, flag int, perm os.FileMode) (transferFile, error) {
+	return memReader{bytes.NewReader([]byte(m[name].data))}, nil
+}
+func (m memFS) ReadDir(name string) ([]os.FileInfo, error) {
+	var infos []os.FileInfo
+	for _, entry := range m[name].entries {
+		infos = append(infos, entry)
+	}
+	return infos, nil
+}
+func (memFS) Mkdir(name string) error                           { return errors.New("read-only") }
+func (memFS) Chmod(name string, mode os.FileMode) error         { return errors.New("read-only") }
+func (memFS) Chtimes(name string, atime, mtime time.Time) error { return errors.New("read-only") }
+func (memFS) Glob(pattern string) ([]string, error)             { return nil, nil }
+func (memFS) Join(elem ...string) string                        { return path.Join(elem...) }
+func (memFS) Base(name string) string                           { return path.Base(name) }
+func (memFS) Dir(name string) string                            { return path.Dir(name) }
+
+func TestCopyPathRejectsUnsafeNames(t *testing.T) {
+	for _, name := range []string{"..", ".", "", "../escaped", `..\escaped`, "a/b"} {
+		t.Run(name, func(t *testing.T) {
+			ok := memFile{name: "ok", data: "fine", mode: 0644}
+			remote := memFS{
+				"dir":    {name: "dir", mode: fs.ModeDir | 0755, entries: []memFile{ok, {name: name, data: "evil", mode: 0644}}},
+				"dir/ok": ok,
+			}
+			local := t.TempDir()
+			target := filepath.Join(local, "out", "dir")
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			err := copyPath(remote, localFS{}, "dir", target, TransferOptions{Recursive: true})
+			if !errors.Is(err, errUnsafeName) {
+				t.Fatalf("copyPath error = %v, want errUnsafeName", err)
+			}
+			if _, err := os.Stat(filepath.Join(local, "out", "escaped")); err == nil {
+				t.Error("a file was written outside the target directory")
+			}
+			if data, err := os.ReadFile(filepath.Join(target, "ok")); err != nil || string(data) != "fine" {
+				t.Errorf("safe entry = %q, %v, want it copied", data, err)
+			}
+		})
+	}
+}
+
+func TestCopyFileKeepsPermissions(t *testing.T) {
+	secret := memFile{name: "secret", data: "s", mode: 0600}
+	script := memFile{name: "script", data: "#!/bin/sh", mode: 0755}
+	remote := memFS{
+		"dir":        {name: "dir", mode: fs.ModeDir | 0755, entries: []memFile{secret, script}},
+		"dir/secret": secret,
+		"dir/script": script,
+	}
+	target := filepath.Join(t.TempDir(), "dir")
+	if err := copyPath(remote, localFS{}, "dir", target, TransferOptions{Recursive: true}); err != nil {
+		t.Fatalf("copyPath failed: %v", err)
+	}
+
+	// The umask can only take bits away
+	for name, want := range map[string]os.FileMode{"secret": 0600, "script": 0755} {
+		info, err := os.Stat(filepath.Join(target, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode().Perm(); got&^want != 0 || got&0700 != want&0700 {
+			t.Errorf("%s has mode %v, want %v less the umask", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,428 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"sm/internal/config"
+	"sm/internal/models"
+	"sm/internal/ssh"
+	"sm/internal/utils"
+)
+
+// Ways the connection form is used.
+const (
+	formAdd   = "add"
+	formEdit  = "edit"
+	formClone = "clone"
+)
+
+// hostKeyOptions are the choices for StrictHostKeyChecking in the form, with
+// the empty default first.
+var hostKeyOptions = []string{"", models.HostKeyCheckingYes, models.HostKeyCheckingAsk, models.HostKeyCheckingAcceptNew, models.HostKeyCheckingNo}
+
+// connectionsTab lists the saved connections, most frecent first.
+type connectionsTab struct {
+	d       *dashboard
+	filter  *tview.InputField
+	table   *tview.Table
+	preview *tview.TextView
+	layout  *tview.Flex
+	matches []Match
+}
+
+func newConnectionsTab(d *dashboard) *connectionsTab {
+	t := &connectionsTab{
+		d:       d,
+		filter:  tview.NewInputField().SetLabel("/ ").SetFieldBackgroundColor(tcell.ColorDefault),
+		table:   newTable("NAME", "USER@HOST", "PORT", "TAGS", "LAST USED"),
+		preview: tview.NewTextView().SetDynamicColors(true).SetWrap(true),
+	}
+	t.preview.SetBorder(true).SetTitle(" Details ")
+	t.layout = tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(t.filter, 1, 0, false).
+		AddItem(tview.NewFlex().
+			AddItem(t.table, 0, 3, true).
+			AddItem(t.preview, 0, 2, false), 0, 1, true)
+
+	t.filter.SetChangedFunc(func(string) { t.refresh() })
+	t.filter.SetDoneFunc(func(key tcell.Key) {
+		if key == tcell.KeyEscape {
+			t.filter.SetText("")
+		}
+		d.app.SetFocus(t.table)
+	})
+	t.table.SetSelectionChangedFunc(func(row, _ int) { t.showPreview(row) })
+	t.table.SetSelectedFunc(func(int, int) {
+		if conn, ok := t.selected(); ok {
+			t.connect(conn)
+		}
+	})
+	t.table.SetInputCapture(t.handleKey)
+	return t
+}
+
+func (t *connectionsTab) title() string          { return "Connections" }
+func (t *connectionsTab) view() tview.Primitive  { return t.layout }
+func (t *connectionsTab) focus() tview.Primitive { return t.table }
+
+func (t *connectionsTab) hints() string {
+	return "Enter connect  a add  e edit  c clone  d delete  t tag  x test  / filter"
+}
+
+func (t *connectionsTab) refresh() {
+	selected, _ := t.selected()
+	now := time.Now()
+
+	conns := make([]models.Connection, 0, len(t.d.cfg.Connections))
+	for name, conn := range t.d.cfg.Connections {
+		conn.Name = name
+		conns = append(conns, conn)
+	}
+	t.matches = RankConnections(conns, t.filter.GetText(), now)
+
+	t.table.Clear()
+	setHeaders(t.table, "NAME", "USER@HOST", "PORT", "TAGS", "LAST USED")
+	row := 1
+	for i, m := range t.matches {
+		lastUsed := "never"
+		if !m.Conn.LastUsed.IsZero() {
+			lastUsed = timeAgo(now.Sub(m.Conn.LastUsed))
+		}
+		// Show the inherited values, but keep the saved ones for editing
+		effective := t.d.cfg.Resolve(m.Conn).Connection
+		t.table.SetCell(i+1, 0, tview.NewTableCell(highlight(m.Conn.Name, m.NamePositions)).SetExpansion(1))
+		t.table.SetCell(i+1, 1, tview.NewTableCell(tview.Escape(effective.User+"@"+effective.Host)).SetExpansion(1))
+		t.table.SetCell(i+1, 2, tview.NewTableCell(strconv.Itoa(effective.Port)).SetExpansion(1))
+		t.table.SetCell(i+1, 3, tview.NewTableCell(tview.Escape(strings.Join(effective.Tags, ","))).SetTextColor(tcell.ColorTeal).SetExpansion(1))
+		t.table.SetCell(i+1, 4, tview.NewTableCell(lastUsed).SetExpansion(1))
+		if m.Conn.Name == selected.Name {
+			row = i + 1
+		}
+	}
+	t.table.Select(row, 0)
+	t.showPreview(row)
+}
+
+// selected returns the connection on the selected row.
+func (t *connectionsTab) selected() (models.Connection, bool) {
+	row, _ := t.table.GetSelection()
+	if row < 1 || row > len(t.matches) {
+		return models.Connection{}, false
+	}
+	return t.matches[row-1].Conn, true
+}
+
+func (t *connectionsTab) showPreview(row int) {
+	t.preview.Clear()
+	if row >= 1 && row <= len(t.matches) {
+		t.preview.SetText(connectionDetails(t.d.cfg.Resolve(t.matches[row-1].Conn).Connection, time.Now()))
+	}
+}
+
+func (t *connectionsTab) handleKey(event *tcell.EventKey) *tcell.EventKey {
+	if event.Key() != tcell.KeyRune {
+		return t.d.tabKeys(event)
+	}
+	if event.Rune() == 'a' {
+		t.showForm(formAdd, models.Connection{})
+		return nil
+	}
+	if event.Rune() == '/' {
+		t.d.app.SetFocus(t.filter)
+		return nil
+	}
+
+	conn, ok := t.selected()
+	if !ok {
+		return t.d.tabKeys(event)
+	}
+	switch event.Rune() {
+	case 'e':
+		t.showForm(formEdit, conn)
+	case 'c':
+		t.showForm(formClone, conn)
+	case 'd':
+		t.remove(conn)
+	case 't':
+		t.tag(conn)
+	case 'x':
+		t.test(conn)
+	default:
+		return t.d.tabKeys(event)
+	}
+	return nil
+}
+
+// connect opens an SSH session to conn outside the interface.
+func (t *connectionsTab) connect(conn models.Connection) {
+	var err error
+	t.d.suspend(func() {
+		if err := config.RecordUse(conn.Name); err != nil {
+			fmt.Println("Warning: could not update last used time:", err)
+		}
+		resolved := t.d.cfg.Resolve(conn).Connection
+		fmt.Printf("Connecting to %s (%s@%s)...\n", conn.Name, resolved.User, conn.Host)
+		err = ssh.Connect(t.d.cfg, &conn)
+	})
+	t.d.reload()
+	if err != nil {
+		t.d.showError(fmt.Errorf("ssh connection failed: %w", err))
+		return
+	}
+	t.d.flash("Connection to %s closed.", conn.Name)
+}
+
+// test checks that conn can connect and authenticate. It runs outside the
+// interface, as it may ask about the host key or for a passphrase.
+func (t *connectionsTab) test(conn models.Connection) {
+	conn = t.d.cfg.Resolve(conn).Connection
+	var err error
+	var elapsed time.Duration
+	t.d.suspend(func() {
+		fmt.Printf("Testing %s (%s@%s)...\n", conn.Name, conn.User, conn.Host)
+		start := time.Now()
+		client, dialErr := ssh.Dial(t.d.cfg, &conn)
+		elapsed = time.Since(start)
+		if dialErr != nil {
+			err = dialErr
+			return
+		}
+		client.Close()
+	})
+	if err != nil {
+		t.d.showError(fmt.Errorf("%s failed: %w", conn.Name, err))
+		return
+	}
+	t.d.showMessage(fmt.Sprintf("Connected to %s and logged in as %s in %s.", conn.Name, conn.User, elapsed.Round(time.Millisecond)))
+}
+
+// remove deletes conn after asking.
+func (t *connectionsTab) remove(conn models.Connection) {
+	question := fmt.Sprintf("Remove connection '%s'?", conn.Name)
+	for name, c := range t.d.cfg.Connections {
+		for _, jump := range c.JumpHosts {
+			if jump == conn.Name {
+				question += fmt.Sprintf("\nConnection '%s' uses it as a jump host.", name)
+			}
+		}
+	}
+	t.d.confirm(question, func() {
+		removed := t.d.update(fmt.Sprintf("Removed connection '%s'.", conn.Name), func(cfg *models.AppConfig) error {
+			if _, exists := cfg.Connections[conn.Name]; !exists {
+				return errors.New("connection with this name does not exist")
+			}
+			delete(cfg.Connections, conn.Name)
+			return nil
+		})
+		if removed {
+			t.d.tunnels.stopConnection(conn.Name)
+		}
+	})
+}
+
+// tag edits the tags of conn.
+func (t *connectionsTab) tag(conn models.Connection) {
+	form := tview.NewForm().
+		AddInputField("Tags", strings.Join(conn.Tags, ", "), 50, nil, nil)
+	form.AddButton("Save", func() {
+		tags, err := models.CleanTags(splitList(form.GetFormItemByLabel("Tags").(*tview.InputField).GetText()))
+		if err != nil {
+			t.d.showError(err)
+			return
+		}
+		ok := t.d.update(fmt.Sprintf("Updated the tags of '%s'.", conn.Name), func(cfg *models.AppConfig) error {
+			latest, exists := cfg.Connections[conn.Name]
+			if !exists {
+				return errors.New("connection with this name does not exist")
+			}
+			latest.Tags = tags
+			cfg.Connections[conn.Name] = latest
+			return nil
+		})
+		if ok {
+			t.d.closeOverlay()
+		}
+	})
+	form.AddButton("Cancel", t.d.closeOverlay)
+	t.d.showForm("Tags of "+conn.Name+" (comma-separated)", form, 7)
+}
+
+// showForm shows the form that adds a connection, edits conn, or adds a copy
+// of it.
+func (t *connectionsTab) showForm(mode string, conn models.Connection) {
+	form := tview.NewForm().SetItemPadding(0)
+	title := "New connection"
+	switch mode {
+	case formEdit:
+		title = "Edit " + conn.Name
+		form.AddTextView("Name", conn.Name, 40, 1, true, false)
+	case formClone:
+		title = "Copy of " + conn.Name
+		form.AddInputField("Name", conn.Name+"-copy", 40, nil, nil)
+	default:
+		form.AddInputField("Name", "", 40, nil, nil)
+	}
+
+	hostKey := 0
+	for i, mode := range hostKeyOptions {
+		if mode == conn.StrictHostKeyChecking {
+			hostKey = i
+		}
+	}
+	port := ""
+	if conn.Port != 0 {
+		port = strconv.Itoa(conn.Port)
+	}
+	form.AddInputField("Group", conn.Group, 40, nil, nil).
+		AddInputField("Host", conn.Host, 40, nil, nil).
+		AddInputField("Port", port, 6, tview.InputFieldInteger, nil).
+		AddInputField("User", conn.User, 40, nil, nil).
+		AddInputField("Key path", conn.KeyPath, 40, nil, nil).
+		AddPasswordField("Password", "", 40, '*', nil)
+	if conn.Password != "" {
+		form.GetFormItemByLabel("Password").(*tview.InputField).SetPlaceholder("unchanged")
+		if mode == formEdit {
+			form.AddCheckbox("Remove password", false, nil)
+		}
+	}
+	form.AddInputField("Key passphrase", conn.KeyPassphrase, 40, nil, nil).
+		AddDropDown("Host key check", []string{"default (ask)", "yes", "ask", "accept-new", "no"}, hostKey, nil).
+		AddCheckbox("Forward agent", conn.ForwardAgent, nil).
+		AddInputField("Jump hosts", strings.Join(conn.JumpHosts, ", "), 40, nil, nil).
+		AddInputField("Tags", strings.Join(conn.Tags, ", "), 40, nil, nil).
+		AddInputField("Description", conn.Description, 40, nil, nil)
+
+	form.AddButton("Save", func() {
+		if t.saveForm(mode, conn, form) {
+			t.d.closeOverlay()
+		}
+	})
+	form.AddButton("Cancel", t.d.closeOverlay)
+	t.d.showForm(title, form, form.GetFormItemCount()+6)
+}
+
+// saveForm checks the fields of form and saves the connection. It reports
+// whether it was saved.
+func (t *connectionsTab) saveForm(mode string, original models.Connection, form *tview.Form) bool {
+	text := func(label string) string {
+		return strings.TrimSpace(form.GetFormItemByLabel(label).(*tview.InputField).GetText())
+	}
+	checked := func(label string) bool {
+		item, ok := form.GetFormItemByLabel(label).(*tview.Checkbox)
+		return ok && item.IsChecked()
+	}
+
+	name := original.Name
+	if mode != formEdit {
+		name = text("Name")
+	}
+	fields := models.Connection{
+		Name:          name,
+		Group:         text("Group"),
+		Host:          text("Host"),
+		User:          text("User"),
+		KeyPath:       text("Key path"),
+		KeyPassphrase: text("Key passphrase"),
+		ForwardAgent:  checked("Forward agent"),
+		JumpHosts:     splitList(text("Jump hosts")),
+		Description:   text("Description"),
+	}
+	hostKey, _ := form.GetFormItemByLabel("Host key check").(*tview.DropDown).GetCurrentOption()
+	fields.StrictHostKeyChecking = hostKeyOptions[hostKey]
+	password := form.GetFormItemByLabel("Password").(*tview.InputField).GetText()
+
+	tags, tagsErr := models.CleanTags(splitList(text("Tags")))
+	var passphraseErr error
+	if fields.KeyPassphrase != "" {
+		passphraseErr = utils.ValidateSecretRef(fields.KeyPassphrase)
+	}
+	// An empty port or user is inherited from the group
+	port, err := 0, error(nil)
+	if text("Port") != "" {
+		port, err = strconv.Atoi(text("Port"))
+	}
+	switch {
+	case name == "":
+		err = errors.New("name cannot be empty")
+	case fields.Group != "" && !models.ValidGroup(fields.Group):
+		err = fmt.Errorf("invalid group '%s': use names separated by slashes, such as prod/eu", fields.Group)
+	case fields.Host == "":
+		err = errors.New("host cannot be empty")
+	case t.d.cfg.Resolve(fields).User == "":
+		err = errors.New("user cannot be empty unless the group sets one")
+	case err != nil || port < 0 || port > 65535:
+		err = errors.New("invalid port number")
+	case passphraseErr != nil:
+		err = fmt.Errorf("the key passphrase must be a secret reference: %w", passphraseErr)
+	case tagsErr != nil:
+		err = tagsErr
+	}
+	if err != nil {
+		t.d.showError(err)
+		return false
+	}
+	fields.Port, fields.Tags = port, tags
+
+	if password != "" && t.d.cfg.Settings.EncryptPasswords && !utils.IsSecretRef(password) {
+		if err := t.d.unlockKey(); err != nil {
+			t.d.showError(err)
+			return false
+		}
+	}
+
+	return t.d.update(fmt.Sprintf("Saved connection '%s'.", name), func(cfg *models.AppConfig) error {
+		var conn models.Connection
+		if mode == formEdit {
+			// Start from the saved connection, which may have changed since the form opened
+			latest, exists := cfg.Connections[name]
+			if !exists {
+				return errors.New("connection with this name does not exist")
+			}
+			conn = latest
+		} else {
+			if _, exists := cfg.Connections[name]; exists {
+				return errors.New("connection with this name already exists")
+			}
+			if mode == formClone {
+				conn = original
+			}
+			conn.Name = name
+			conn.ID = cfg.NextID
+			conn.CreatedAt = time.Now()
+			conn.LastUsed = time.Time{}
+			conn.UseCount = 0
+		}
+
+		conn.Group, conn.Host, conn.Port, conn.User = fields.Group, fields.Host, fields.Port, fields.User
+		conn.KeyPath, conn.KeyPassphrase = fields.KeyPath, fields.KeyPassphrase
+		conn.StrictHostKeyChecking, conn.ForwardAgent = fields.StrictHostKeyChecking, fields.ForwardAgent
+		conn.JumpHosts, conn.Tags, conn.Description = fields.JumpHosts, fields.Tags, fields.Description
+		switch {
+		case password != "":
+			sealed, err := utils.SealPassword(password, cfg.Settings.EncryptPasswords)
+			if err != nil {
+				return fmt.Errorf("failed to save password: %w", err)
+			}
+			conn.Password = sealed
+		case checked("Remove password"):
+			conn.Password = ""
+		}
+
+		// Make sure the jump hosts exist and do not loop back on themselves
+		if _, err := ssh.JumpChain(cfg, &conn); err != nil {
+			return err
+		}
+
+		if mode != formEdit {
+			cfg.NextID++
+		}
+		cfg.Connections[name] = conn
+		return nil
+	})
+}
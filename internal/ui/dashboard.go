@@ -0,0 +1,295 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"sm/internal/config"
+	"sm/internal/models"
+	"sm/internal/ssh"
+	"sm/internal/utils"
+)
+
+// tab is one page of the dashboard.
+type tab interface {
+	title() string
+	// view is the page, and focus the part of it that has the focus.
+	view() tview.Primitive
+	focus() tview.Primitive
+	// refresh redraws the page from the dashboard's config.
+	refresh()
+	// hints describes the keys of the page for the status line.
+	hints() string
+}
+
+// dashboard is the full-screen interface of 'sm ui'. Every change is saved
+// with config.Update, like the commands, and the page is redrawn from the
+// saved configuration afterwards.
+type dashboard struct {
+	app      *tview.Application
+	pages    *tview.Pages // The tabs, with forms and dialogs on top
+	overlays []tview.Primitive
+	tabView  *tview.Pages
+	header   *tview.TextView
+	status   *tview.TextView
+	tabs     []tab
+	current  int
+	cfg      *models.AppConfig
+	tunnels  *tunnelsTab
+}
+
+// Run shows the dashboard until it is closed with q or Ctrl+C. Tunnels
+// started from it are closed when it exits.
+func Run() error {
+	d, err := newDashboard(tview.NewApplication())
+	if err != nil {
+		return err
+	}
+	defer d.tunnels.stopAll()
+
+	// Warnings from the tunnels are shown in the status line
+	defer func(w io.Writer) { ssh.TunnelWarnings = w }(ssh.TunnelWarnings)
+	ssh.TunnelWarnings = warningWriter(func(msg string) {
+		d.app.QueueUpdateDraw(func() { d.flash("%s", msg) })
+	})
+
+	if err := d.app.Run(); err != nil {
+		return fmt.Errorf("failed to run dashboard: %w", err)
+	}
+	return nil
+}
+
+// newDashboard lays out the dashboard in app.
+func newDashboard(app *tview.Application) (*dashboard, error) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config: %w", err)
+	}
+	useTerminalColors()
+
+	d := &dashboard{
+		app:     app,
+		pages:   tview.NewPages(),
+		tabView: tview.NewPages(),
+		header:  tview.NewTextView().SetDynamicColors(true),
+		status:  tview.NewTextView().SetDynamicColors(true),
+		cfg:     cfg,
+	}
+	d.tunnels = newTunnelsTab(d)
+	d.tabs = []tab{newConnectionsTab(d), newKeysTab(d), d.tunnels}
+	for i, t := range d.tabs {
+		d.tabView.AddPage(fmt.Sprint(i), t.view(), true, i == 0)
+		t.refresh()
+	}
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(d.header, 1, 0, false).
+		AddItem(d.tabView, 0, 1, true).
+		AddItem(d.status, 1, 0, false)
+	d.pages.AddPage("main", layout, true, true)
+	app.SetRoot(d.pages, true)
+	d.switchTab(0)
+	return d, nil
+}
+
+// tabKeys handles the keys shared by all tabs when their list has the focus.
+// It returns nil for keys it used.
+func (d *dashboard) tabKeys(event *tcell.EventKey) *tcell.EventKey {
+	switch event.Key() {
+	case tcell.KeyTab:
+		d.switchTab((d.current + 1) % len(d.tabs))
+		return nil
+	case tcell.KeyBacktab:
+		d.switchTab((d.current + len(d.tabs) - 1) % len(d.tabs))
+		return nil
+	case tcell.KeyRune:
+		switch r := event.Rune(); {
+		case r >= '1' && int(r-'1') < len(d.tabs):
+			d.switchTab(int(r - '1'))
+			return nil
+		case r == 'q':
+			d.app.Stop()
+			return nil
+		}
+	}
+	return event
+}
+
+// switchTab shows the i-th tab.
+func (d *dashboard) switchTab(i int) {
+	d.current = i
+	d.tabView.SwitchToPage(fmt.Sprint(i))
+	var titles []string
+	for j, t := range d.tabs {
+		if j == i {
+			titles = append(titles, fmt.Sprintf("[black:teal] %d %s [-:-]", j+1, t.title()))
+		} else {
+			titles = append(titles, fmt.Sprintf(" %d %s ", j+1, t.title()))
+		}
+	}
+	d.header.SetText(strings.Join(titles, " "))
+	d.app.SetFocus(d.tabs[i].focus())
+	d.showHints()
+}
+
+// showHints puts the keys of the current tab in the status line.
+func (d *dashboard) showHints() {
+	d.status.SetText("[gray]" + d.tabs[d.current].hints() + "  Tab switch  q quit")
+}
+
+// flash shows a message in the status line until the next one.
+func (d *dashboard) flash(format string, args ...interface{}) {
+	d.status.SetText("[green]" + tview.Escape(fmt.Sprintf(format, args...)))
+}
+
+// reload reads the configuration again and redraws every tab.
+func (d *dashboard) reload() {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		d.showError(err)
+		return
+	}
+	d.cfg = cfg
+	for _, t := range d.tabs {
+		t.refresh()
+	}
+}
+
+// update saves a change made by fn, then redraws the tabs and reports done.
+// fn is applied to the configuration as it is on disk, so it must check
+// again anything it relies on.
+func (d *dashboard) update(done string, fn func(cfg *models.AppConfig) error) bool {
+	if err := config.Update(fn); err != nil {
+		d.showError(err)
+		return false
+	}
+	d.reload()
+	d.flash("%s", done)
+	return true
+}
+
+// suspend leaves the full-screen interface while fn runs, so that it can use
+// the terminal, for example for an SSH session or a password prompt.
+func (d *dashboard) suspend(fn func()) {
+	d.app.Suspend(fn)
+}
+
+// unlockKey makes sure the encryption key is available before a password is
+// encrypted, asking for the master password outside the interface if needed.
+func (d *dashboard) unlockKey() error {
+	var err error
+	if d.cfg.Settings.Encryption.KeySource == models.KeySourceMasterPassword {
+		d.suspend(func() { _, err = utils.EncryptionKey() })
+	} else {
+		_, err = utils.EncryptionKey()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get the encryption key: %w", err)
+	}
+	return nil
+}
+
+// showError shows err in a dialog.
+func (d *dashboard) showError(err error) {
+	d.showMessage("Error: " + err.Error())
+}
+
+// showMessage shows text in a dialog that is closed with Enter or Esc.
+func (d *dashboard) showMessage(text string) {
+	modal := tview.NewModal().
+		SetText(text).
+		AddButtons([]string{"OK"}).
+		SetDoneFunc(func(int, string) { d.closeOverlay() })
+	d.showOverlay(modal)
+}
+
+// confirm asks a yes or no question and calls yes if it is confirmed.
+func (d *dashboard) confirm(question string, yes func()) {
+	modal := tview.NewModal().
+		SetText(question).
+		AddButtons([]string{"No", "Yes"}).
+		SetDoneFunc(func(_ int, label string) {
+			d.closeOverlay()
+			if label == "Yes" {
+				yes()
+			}
+		})
+	d.showOverlay(modal)
+}
+
+// showForm shows form in a centered window with title. Esc closes it.
+func (d *dashboard) showForm(title string, form *tview.Form, height int) {
+	form.SetBorder(true).SetTitle(" " + title + " ")
+	form.SetCancelFunc(d.closeOverlay)
+	form.SetFieldBackgroundColor(tcell.ColorDarkSlateGray)
+	form.SetButtonBackgroundColor(tcell.ColorTeal)
+	d.showOverlay(centered(form, 70, height))
+}
+
+// showOverlay shows p on top of the tabs and any other form or dialog, with
+// the focus.
+func (d *dashboard) showOverlay(p tview.Primitive) {
+	d.overlays = append(d.overlays, p)
+	d.pages.AddPage(fmt.Sprintf("overlay-%d", len(d.overlays)), p, true, true)
+	d.app.SetFocus(p)
+}
+
+// closeOverlay removes the topmost form or dialog and gives the focus back to
+// what is below it.
+func (d *dashboard) closeOverlay() {
+	if len(d.overlays) == 0 {
+		return
+	}
+	d.pages.RemovePage(fmt.Sprintf("overlay-%d", len(d.overlays)))
+	d.overlays = d.overlays[:len(d.overlays)-1]
+	if len(d.overlays) > 0 {
+		d.app.SetFocus(d.overlays[len(d.overlays)-1])
+	} else {
+		d.app.SetFocus(d.tabs[d.current].focus())
+	}
+}
+
+// centered places p in the middle of the screen with the given size.
+func centered(p tview.Primitive, width, height int) tview.Primitive {
+	return tview.NewFlex().
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(nil, 0, 1, false).
+			AddItem(p, height, 0, true).
+			AddItem(nil, 0, 1, false), width, 0, true).
+		AddItem(nil, 0, 1, false)
+}
+
+// splitList splits a comma-separated field into its trimmed, non-empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// newTable returns a table of selectable rows with a fixed header row.
+func newTable(headers ...string) *tview.Table {
+	table := tview.NewTable().
+		SetSelectable(true, false).
+		SetFixed(1, 0).
+		SetSelectedStyle(tcell.StyleDefault.Reverse(true))
+	setHeaders(table, headers...)
+	return table
+}
+
+// setHeaders writes the header row of table.
+func setHeaders(table *tview.Table, headers ...string) {
+	for i, h := range headers {
+		table.SetCell(0, i, tview.NewTableCell(h).
+			SetSelectable(false).
+			SetAttributes(tcell.AttrBold).
+			SetExpansion(1))
+	}
+}
@@ -0,0 +1,86 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rivo/tview"
+	"sm/internal/models"
+	"sm/internal/utils"
+)
+
+// connectionDetails describes conn for a preview pane, with tview color tags.
+func connectionDetails(conn models.Connection, now time.Time) string {
+	var b strings.Builder
+	row := func(label, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "[::b]%-12s[::-] %s\n", label, tview.Escape(value))
+		}
+	}
+
+	row("Name", conn.Name)
+	row("ID", fmt.Sprint(conn.ID))
+	row("Group", conn.Group)
+	row("Host", conn.Host)
+	row("Port", fmt.Sprint(conn.Port))
+	row("User", conn.User)
+	row("Key", conn.KeyPath)
+	row("Password", describePassword(conn.Password))
+	row("Jump hosts", strings.Join(conn.JumpHosts, " -> "))
+	for i, f := range conn.Forwards {
+		label := ""
+		if i == 0 {
+			label = "Tunnels"
+		}
+		fmt.Fprintf(&b, "[::b]%-12s[::-] %s\n", label, tview.Escape(fmt.Sprintf("%s (%s %s)", f.Name, f.Type, f.Spec)))
+	}
+	row("Tags", strings.Join(conn.Tags, ", "))
+	row("Description", conn.Description)
+	row("Last used", describeLastUsed(conn, now))
+	if !conn.CreatedAt.IsZero() {
+		row("Created", conn.CreatedAt.Local().Format("2006-01-02 15:04"))
+	}
+	return b.String()
+}
+
+// describePassword says how a password is saved without revealing it.
+func describePassword(value string) string {
+	switch {
+	case value == "":
+		return ""
+	case utils.IsSecretRef(value):
+		return value
+	case utils.IsEncrypted(value):
+		return "saved (encrypted)"
+	default:
+		return "saved (not encrypted)"
+	}
+}
+
+// describeLastUsed gives the last use of conn, relative to now, and how many
+// sessions have been opened.
+func describeLastUsed(conn models.Connection, now time.Time) string {
+	if conn.LastUsed.IsZero() {
+		return "never"
+	}
+	s := fmt.Sprintf("%s (%s)", conn.LastUsed.Local().Format("2006-01-02 15:04"), timeAgo(now.Sub(conn.LastUsed)))
+	if conn.UseCount > 0 {
+		s += fmt.Sprintf(", %d session(s)", conn.UseCount)
+	}
+	return s
+}
+
+// timeAgo describes a duration in the past in the largest whole unit.
+func timeAgo(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%d min ago", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%d h ago", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%d days ago", int(d.Hours()/24))
+	}
+}
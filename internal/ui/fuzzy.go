@@ -0,0 +1,147 @@
+package ui
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"sm/internal/models"
+)
+
+// Scores for fuzzy matches. A matched character is worth more when it follows
+// the previous match directly or starts a word, so "pw" prefers "prod-web"
+// to "payment-api-worker".
+const (
+	scoreMatch       = 1
+	scoreConsecutive = 4
+	scoreWordStart   = 3
+)
+
+// fuzzyMatch reports whether the characters of pattern appear in s in order,
+// ignoring case. score is higher for better matches, and positions are the
+// indexes of the matched runes of s.
+func fuzzyMatch(pattern, s string) (score int, positions []int, ok bool) {
+	p := []rune(strings.ToLower(pattern))
+	r := []rune(strings.ToLower(s))
+	if len(p) == 0 {
+		return 0, nil, true
+	}
+
+	// Try every place the first character occurs and keep the best match
+	best := -1
+	for start := range r {
+		if r[start] != p[0] {
+			continue
+		}
+		score, pos := matchFrom(p, r, start)
+		if pos != nil && score > best {
+			best, positions = score, pos
+		}
+	}
+	if best < 0 {
+		return 0, nil, false
+	}
+	return best, positions, true
+}
+
+// matchFrom matches p against r greedily, starting with p[0] at r[start].
+func matchFrom(p, r []rune, start int) (int, []int) {
+	score := 0
+	positions := make([]int, 0, len(p))
+	j := 0
+	for i := start; i < len(r) && j < len(p); i++ {
+		if r[i] != p[j] {
+			continue
+		}
+		score += scoreMatch
+		if len(positions) > 0 && positions[len(positions)-1] == i-1 {
+			score += scoreConsecutive
+		}
+		if i == 0 || !unicode.IsLetter(r[i-1]) && !unicode.IsDigit(r[i-1]) {
+			score += scoreWordStart
+		}
+		positions = append(positions, i)
+		j++
+	}
+	if j < len(p) {
+		return 0, nil
+	}
+	return score, positions
+}
+
+// Match is a connection that matches a picker query.
+type Match struct {
+	Conn models.Connection
+	// NamePositions are the indexes of the runes of the name that matched,
+	// for highlighting.
+	NamePositions []int
+	score         int
+	frecency      float64
+}
+
+// searchFields are the fields of conn that queries match against.
+func searchFields(conn models.Connection) []string {
+	return []string{conn.Name, conn.Host, conn.User, strings.Join(conn.Tags, " "), conn.Description}
+}
+
+// RankConnections returns the connections that match query, most frecent
+// first. The query is split into words, and each word must fuzzily match the
+// name, host, user, tags or description. Connections that are equally frecent
+// are ordered by how well they match, then by name.
+func RankConnections(conns []models.Connection, query string, now time.Time) []Match {
+	terms := strings.Fields(query)
+	var matches []Match
+	for _, conn := range conns {
+		m := Match{Conn: conn, frecency: conn.Frecency(now)}
+		ok := true
+		for _, term := range terms {
+			best, found := -1, false
+			for i, field := range searchFields(conn) {
+				score, positions, matched := fuzzyMatch(term, field)
+				if !matched || score <= best {
+					continue
+				}
+				best, found = score, true
+				if i == 0 {
+					m.NamePositions = mergePositions(m.NamePositions, positions)
+				}
+			}
+			if !found {
+				ok = false
+				break
+			}
+			m.score += best
+		}
+		if ok {
+			matches = append(matches, m)
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.frecency != b.frecency {
+			return a.frecency > b.frecency
+		}
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		return a.Conn.Name < b.Conn.Name
+	})
+	return matches
+}
+
+// mergePositions adds positions to the sorted set a.
+func mergePositions(a, positions []int) []int {
+	seen := make(map[int]bool, len(a))
+	for _, p := range a {
+		seen[p] = true
+	}
+	for _, p := range positions {
+		if !seen[p] {
+			a = append(a, p)
+		}
+	}
+	sort.Ints(a)
+	return a
+}
@@ -0,0 +1,77 @@
+package ui
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"sm/internal/models"
+)
+
+func TestFuzzyMatch(t *testing.T) {
+	tests := []struct {
+		pattern   string
+		s         string
+		ok        bool
+		positions []int
+	}{
+		{"", "web", true, nil},
+		{"web", "prod-web", true, []int{5, 6, 7}},
+		{"PW", "prod-web", true, []int{0, 5}},
+		{"wp", "prod-web", false, nil},
+		{"dbx", "db", false, nil},
+		// The later, consecutive match is preferred to the first scattered one
+		{"ab", "a-x-ab", true, []int{4, 5}},
+	}
+	for _, tt := range tests {
+		_, positions, ok := fuzzyMatch(tt.pattern, tt.s)
+		if ok != tt.ok || !reflect.DeepEqual(positions, tt.positions) {
+			t.Errorf("fuzzyMatch(%q, %q) = %v, %v, want %v, %v", tt.pattern, tt.s, positions, ok, tt.positions, tt.ok)
+		}
+	}
+
+	// Word starts and runs score higher than scattered characters
+	tight, _, _ := fuzzyMatch("web", "prod-web")
+	loose, _, _ := fuzzyMatch("web", "wide-area-bus")
+	if tight <= loose {
+		t.Errorf("score of prod-web = %d, want more than wide-area-bus's %d", tight, loose)
+	}
+}
+
+func TestRankConnections(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	conns := []models.Connection{
+		{Name: "payment-api-worker", Host: "10.0.0.3"},
+		{Name: "prod-web", Host: "10.0.0.1", Tags: []string{"frontend"}},
+		{Name: "prod-db", Host: "10.0.0.2", User: "postgres", LastUsed: now.Add(-time.Hour * 48), UseCount: 2},
+		{Name: "staging", Host: "10.0.1.1", Description: "pre-production web", LastUsed: now.Add(-time.Minute), UseCount: 1},
+	}
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		// Frecency first, then match quality, then name
+		{"", []string{"staging", "prod-db", "payment-api-worker", "prod-web"}},
+		{"pw", []string{"staging", "payment-api-worker", "prod-web"}},
+		{"web", []string{"staging", "prod-web"}},
+		{"prod postgres", []string{"prod-db"}},
+		{"postgres", []string{"prod-db"}},
+		{"front", []string{"prod-web"}},
+		{"10.0.1", []string{"staging", "prod-web"}},
+		{"nothing", nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, m := range RankConnections(conns, tt.query, now) {
+			got = append(got, m.Conn.Name)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("RankConnections(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+
+	matches := RankConnections(conns, "pw", now)
+	if last := matches[len(matches)-1]; !reflect.DeepEqual(last.NamePositions, []int{0, 5}) {
+		t.Errorf("name positions of %s = %v, want [0 5]", last.Conn.Name, last.NamePositions)
+	}
+}
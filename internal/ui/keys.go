@@ -0,0 +1,195 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"sm/internal/config"
+	"sm/internal/models"
+	"sm/internal/ssh"
+)
+
+// keysTab lists the SSH keys managed by sm.
+type keysTab struct {
+	d     *dashboard
+	table *tview.Table
+	keys  []models.SSHKey
+}
+
+func newKeysTab(d *dashboard) *keysTab {
+	t := &keysTab{
+		d:     d,
+		table: newTable("NAME", "TYPE", "PATH", "USED BY"),
+	}
+	t.table.SetInputCapture(t.handleKey)
+	return t
+}
+
+func (t *keysTab) title() string          { return "Keys" }
+func (t *keysTab) view() tview.Primitive  { return t.table }
+func (t *keysTab) focus() tview.Primitive { return t.table }
+
+func (t *keysTab) hints() string {
+	return "g generate ed25519  d remove"
+}
+
+func (t *keysTab) refresh() {
+	selected, _ := t.selected()
+
+	t.keys = t.keys[:0]
+	for name, key := range t.d.cfg.SSHKeys {
+		key.Name = name
+		t.keys = append(t.keys, key)
+	}
+	sort.Slice(t.keys, func(i, j int) bool { return t.keys[i].Name < t.keys[j].Name })
+
+	t.table.Clear()
+	setHeaders(t.table, "NAME", "TYPE", "PATH", "USED BY")
+	row := 1
+	for i, key := range t.keys {
+		path := tview.NewTableCell(tview.Escape(key.Path)).SetExpansion(2)
+		if _, err := os.Stat(key.Path); err != nil {
+			path.SetText(tview.Escape(key.Path + " (missing)")).SetTextColor(tcell.ColorRed)
+		}
+		t.table.SetCell(i+1, 0, tview.NewTableCell(tview.Escape(key.Name)).SetExpansion(1))
+		t.table.SetCell(i+1, 1, tview.NewTableCell(tview.Escape(key.Type)).SetExpansion(1))
+		t.table.SetCell(i+1, 2, path)
+		t.table.SetCell(i+1, 3, tview.NewTableCell(tview.Escape(strings.Join(t.usedBy(key), ","))).SetExpansion(1))
+		if key.Name == selected.Name {
+			row = i + 1
+		}
+	}
+	t.table.Select(row, 0)
+}
+
+// usedBy returns the names of the connections that use key, sorted.
+func (t *keysTab) usedBy(key models.SSHKey) []string {
+	var names []string
+	for name, conn := range t.d.cfg.Connections {
+		if conn.KeyPath == key.Path {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// selected returns the key on the selected row.
+func (t *keysTab) selected() (models.SSHKey, bool) {
+	row, _ := t.table.GetSelection()
+	if row < 1 || row > len(t.keys) {
+		return models.SSHKey{}, false
+	}
+	return t.keys[row-1], true
+}
+
+func (t *keysTab) handleKey(event *tcell.EventKey) *tcell.EventKey {
+	if event.Key() != tcell.KeyRune {
+		return t.d.tabKeys(event)
+	}
+	switch event.Rune() {
+	case 'g':
+		t.showGenerateForm()
+	case 'd':
+		if key, ok := t.selected(); ok {
+			t.remove(key)
+		}
+	default:
+		return t.d.tabKeys(event)
+	}
+	return nil
+}
+
+// remove stops managing key after asking. The key files are kept.
+func (t *keysTab) remove(key models.SSHKey) {
+	question := fmt.Sprintf("Stop managing key '%s'? The files in %s are kept.", key.Name, filepath.Dir(key.Path))
+	t.d.confirm(question, func() {
+		t.d.update(fmt.Sprintf("Removed key '%s'.", key.Name), func(cfg *models.AppConfig) error {
+			if _, exists := cfg.SSHKeys[key.Name]; !exists {
+				return errors.New("SSH key with this name does not exist")
+			}
+			delete(cfg.SSHKeys, key.Name)
+			return nil
+		})
+	})
+}
+
+// showGenerateForm shows the form that generates an ed25519 key pair in ~/.ssh.
+func (t *keysTab) showGenerateForm() {
+	form := tview.NewForm().
+		AddInputField("Name", "", 30, nil, nil)
+	form.AddButton("Generate", func() {
+		name := strings.TrimSpace(form.GetFormItemByLabel("Name").(*tview.InputField).GetText())
+		if err := t.generate(name); err != nil {
+			t.d.showError(err)
+			return
+		}
+		t.d.closeOverlay()
+	})
+	form.AddButton("Cancel", t.d.closeOverlay)
+	t.d.showForm("Generate ed25519 key", form, 7)
+}
+
+// generate writes a new ed25519 key pair to ~/.ssh/<name> and manages it.
+func (t *keysTab) generate(name string) error {
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return errors.New("the key name must be a file name, such as id_work")
+	}
+	if _, exists := t.d.cfg.SSHKeys[name]; exists {
+		return errors.New("SSH key with this name already exists")
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("failed to get user home directory: %w", err)
+	}
+	sshDir := filepath.Join(homeDir, ".ssh")
+	if err := os.MkdirAll(sshDir, 0700); err != nil {
+		return fmt.Errorf("failed to create .ssh directory: %w", err)
+	}
+	privateKeyPath := filepath.Join(sshDir, name)
+	publicKeyPath := privateKeyPath + ".pub"
+	for _, path := range []string{privateKeyPath, publicKeyPath} {
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("%s already exists", path)
+		}
+	}
+
+	privateKey, err := ssh.GenerateEd25519Key()
+	if err != nil {
+		return fmt.Errorf("failed to generate key: %w", err)
+	}
+	if err := ssh.WritePrivateKey(privateKey, privateKeyPath); err != nil {
+		return fmt.Errorf("failed to write private key: %w", err)
+	}
+	if err := ssh.WritePublicKey(privateKey, publicKeyPath); err != nil {
+		os.Remove(privateKeyPath)
+		return fmt.Errorf("failed to write public key: %w", err)
+	}
+
+	err = config.Update(func(cfg *models.AppConfig) error {
+		if _, exists := cfg.SSHKeys[name]; exists {
+			return errors.New("SSH key with this name already exists")
+		}
+		if cfg.SSHKeys == nil {
+			cfg.SSHKeys = make(map[string]models.SSHKey)
+		}
+		cfg.SSHKeys[name] = models.SSHKey{Name: name, Path: privateKeyPath, Type: "ed25519"}
+		return nil
+	})
+	if err != nil {
+		// Do not leave files behind that sm does not know about
+		os.Remove(privateKeyPath)
+		os.Remove(publicKeyPath)
+		return err
+	}
+	t.d.reload()
+	t.d.flash("Generated ed25519 key '%s' at %s.", name, privateKeyPath)
+	return nil
+}
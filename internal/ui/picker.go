@@ -0,0 +1,142 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"sm/internal/models"
+)
+
+// Pick shows a full-screen fuzzy finder over conns, starting with query, and
+// returns the connection chosen with Enter. ok is false if the picker was
+// closed with Esc or Ctrl+C instead.
+func Pick(conns []models.Connection, query string) (conn models.Connection, ok bool, err error) {
+	useTerminalColors()
+	now := time.Now()
+
+	app := tview.NewApplication()
+	input := tview.NewInputField().
+		SetLabel("> ").
+		SetText(query).
+		SetFieldBackgroundColor(tcell.ColorDefault)
+	table := tview.NewTable().
+		SetSelectable(true, false).
+		SetSelectedStyle(tcell.StyleDefault.Reverse(true))
+	preview := tview.NewTextView().
+		SetDynamicColors(true).
+		SetWrap(true)
+	preview.SetBorder(true).SetTitle(" Details ")
+	status := tview.NewTextView().
+		SetDynamicColors(true)
+
+	var matches []Match
+	showPreview := func(row int) {
+		preview.Clear()
+		if row >= 0 && row < len(matches) {
+			preview.SetText(connectionDetails(matches[row].Conn, now))
+		}
+	}
+	refresh := func(query string) {
+		matches = RankConnections(conns, query, now)
+		table.Clear()
+		for i, m := range matches {
+			table.SetCell(i, 0, tview.NewTableCell(highlight(m.Conn.Name, m.NamePositions)))
+			table.SetCell(i, 1, tview.NewTableCell(tview.Escape(fmt.Sprintf("%s@%s", m.Conn.User, m.Conn.Host))).SetTextColor(tcell.ColorGray))
+			table.SetCell(i, 2, tview.NewTableCell(tview.Escape(strings.Join(m.Conn.Tags, ","))).SetTextColor(tcell.ColorTeal))
+		}
+		table.Select(0, 0).ScrollToBeginning()
+		showPreview(0)
+		status.SetText(fmt.Sprintf("[gray]%d/%d  ↑↓ move  Enter connect  Esc cancel", len(matches), len(conns)))
+	}
+	table.SetSelectionChangedFunc(func(row, column int) { showPreview(row) })
+	input.SetChangedFunc(refresh)
+
+	// The input keeps the focus; the keys that move through the results are
+	// passed on to the table.
+	input.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyUp, tcell.KeyCtrlP:
+			moveSelection(table, -1)
+		case tcell.KeyDown, tcell.KeyCtrlN:
+			moveSelection(table, 1)
+		case tcell.KeyPgUp:
+			_, _, _, height := table.GetInnerRect()
+			moveSelection(table, -height)
+		case tcell.KeyPgDn:
+			_, _, _, height := table.GetInnerRect()
+			moveSelection(table, height)
+		case tcell.KeyEnter:
+			if row, _ := table.GetSelection(); row >= 0 && row < len(matches) {
+				conn, ok = matches[row].Conn, true
+				app.Stop()
+			}
+		case tcell.KeyEscape, tcell.KeyCtrlC:
+			app.Stop()
+		default:
+			return event
+		}
+		return nil
+	})
+
+	results := tview.NewFlex().
+		AddItem(table, 0, 3, false).
+		AddItem(preview, 0, 2, false)
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(input, 1, 0, true).
+		AddItem(results, 0, 1, false).
+		AddItem(status, 1, 0, false)
+
+	refresh(query)
+	if err := app.SetRoot(layout, true).Run(); err != nil {
+		return models.Connection{}, false, fmt.Errorf("failed to run picker: %w", err)
+	}
+	return conn, ok, nil
+}
+
+// moveSelection moves the selected row of table by delta, within bounds.
+func moveSelection(table *tview.Table, delta int) {
+	rows := table.GetRowCount()
+	if rows == 0 {
+		return
+	}
+	row, _ := table.GetSelection()
+	row += delta
+	if row < 0 {
+		row = 0
+	}
+	if row >= rows {
+		row = rows - 1
+	}
+	table.Select(row, 0)
+}
+
+// highlight marks the runes of s at positions, for tview.
+func highlight(s string, positions []int) string {
+	if len(positions) == 0 {
+		return tview.Escape(s)
+	}
+	marked := make(map[int]bool, len(positions))
+	for _, p := range positions {
+		marked[p] = true
+	}
+	var b strings.Builder
+	for i, r := range []rune(s) {
+		if marked[i] {
+			b.WriteString("[yellow::b]" + tview.Escape(string(r)) + "[-::-]")
+		} else {
+			b.WriteString(tview.Escape(string(r)))
+		}
+	}
+	return b.String()
+}
+
+// useTerminalColors makes tview draw on the terminal's own background and
+// text colors instead of its default black theme.
+func useTerminalColors() {
+	tview.Styles.PrimitiveBackgroundColor = tcell.ColorDefault
+	tview.Styles.ContrastBackgroundColor = tcell.ColorDefault
+	tview.Styles.PrimaryTextColor = tcell.ColorDefault
+}
@@ -0,0 +1,328 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	gossh "golang.org/x/crypto/ssh"
+	"sm/internal/models"
+	"sm/internal/ssh"
+)
+
+// forwardTypes are the choices for the type of a new tunnel.
+var forwardTypes = []string{models.ForwardLocal, models.ForwardRemote, models.ForwardDynamic}
+
+// savedTunnel is a saved forward together with its connection.
+type savedTunnel struct {
+	conn    string
+	forward models.Forward
+}
+
+// key identifies the tunnel among all connections.
+func (s savedTunnel) key() string {
+	return s.conn + "/" + s.forward.Name
+}
+
+// runningTunnel is a tunnel started from the dashboard.
+type runningTunnel struct {
+	client *gossh.Client
+	closer io.Closer
+}
+
+// tunnelsTab lists the saved tunnels of every connection. Tunnels started
+// from it stay up until they are stopped or the dashboard exits.
+type tunnelsTab struct {
+	d     *dashboard
+	table *tview.Table
+	rows  []savedTunnel
+
+	mu      sync.Mutex
+	running map[string]runningTunnel
+}
+
+func newTunnelsTab(d *dashboard) *tunnelsTab {
+	t := &tunnelsTab{
+		d:       d,
+		table:   newTable("CONNECTION", "NAME", "FORWARD", "STATUS"),
+		running: make(map[string]runningTunnel),
+	}
+	t.table.SetSelectedFunc(func(int, int) {
+		if s, ok := t.selected(); ok {
+			t.toggle(s)
+		}
+	})
+	t.table.SetInputCapture(t.handleKey)
+	return t
+}
+
+func (t *tunnelsTab) title() string          { return "Tunnels" }
+func (t *tunnelsTab) view() tview.Primitive  { return t.table }
+func (t *tunnelsTab) focus() tview.Primitive { return t.table }
+
+func (t *tunnelsTab) hints() string {
+	return "Enter start/stop  a add  d delete"
+}
+
+func (t *tunnelsTab) refresh() {
+	selected, _ := t.selected()
+
+	t.rows = t.rows[:0]
+	for name, conn := range t.d.cfg.Connections {
+		for _, f := range conn.Forwards {
+			t.rows = append(t.rows, savedTunnel{conn: name, forward: f})
+		}
+	}
+	sort.Slice(t.rows, func(i, j int) bool { return t.rows[i].key() < t.rows[j].key() })
+
+	t.table.Clear()
+	setHeaders(t.table, "CONNECTION", "NAME", "FORWARD", "STATUS")
+	row := 1
+	for i, s := range t.rows {
+		forward := s.forward.Type + " " + s.forward.Spec
+		if parsed, err := ssh.ParseForward(s.forward); err == nil {
+			forward = parsed.String()
+		}
+		status := tview.NewTableCell("stopped").SetTextColor(tcell.ColorGray)
+		if t.isRunning(s.key()) {
+			status = tview.NewTableCell("running").SetTextColor(tcell.ColorGreen)
+		}
+		t.table.SetCell(i+1, 0, tview.NewTableCell(tview.Escape(s.conn)).SetExpansion(1))
+		t.table.SetCell(i+1, 1, tview.NewTableCell(tview.Escape(s.forward.Name)).SetExpansion(1))
+		t.table.SetCell(i+1, 2, tview.NewTableCell(tview.Escape(forward)).SetExpansion(2))
+		t.table.SetCell(i+1, 3, status.SetExpansion(1))
+		if s.key() == selected.key() {
+			row = i + 1
+		}
+	}
+	t.table.Select(row, 0)
+}
+
+// selected returns the tunnel on the selected row.
+func (t *tunnelsTab) selected() (savedTunnel, bool) {
+	row, _ := t.table.GetSelection()
+	if row < 1 || row > len(t.rows) {
+		return savedTunnel{}, false
+	}
+	return t.rows[row-1], true
+}
+
+func (t *tunnelsTab) handleKey(event *tcell.EventKey) *tcell.EventKey {
+	if event.Key() != tcell.KeyRune {
+		return t.d.tabKeys(event)
+	}
+	switch event.Rune() {
+	case 'a':
+		t.showForm()
+	case 'd':
+		if s, ok := t.selected(); ok {
+			t.remove(s)
+		}
+	default:
+		return t.d.tabKeys(event)
+	}
+	return nil
+}
+
+func (t *tunnelsTab) isRunning(key string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, ok := t.running[key]
+	return ok
+}
+
+// toggle starts s, or stops it if it is running.
+func (t *tunnelsTab) toggle(s savedTunnel) {
+	if t.isRunning(s.key()) {
+		t.stop(s.key())
+		t.refresh()
+		t.d.flash("Stopped tunnel '%s' of %s.", s.forward.Name, s.conn)
+		return
+	}
+
+	tunnel, err := ssh.ParseForward(s.forward)
+	if err != nil {
+		t.d.showError(err)
+		return
+	}
+	saved, exists := t.d.cfg.Connections[s.conn]
+	if !exists {
+		t.d.showError(fmt.Errorf("connection '%s' does not exist", s.conn))
+		return
+	}
+	conn := t.d.cfg.Resolve(saved).Connection
+
+	// Connecting may ask about the host key or for a passphrase
+	var client *gossh.Client
+	t.d.suspend(func() {
+		fmt.Printf("Connecting to %s (%s@%s)...\n", conn.Name, conn.User, conn.Host)
+		client, err = ssh.Dial(t.d.cfg, &conn)
+	})
+	if err != nil {
+		t.d.showError(fmt.Errorf("ssh connection failed: %w", err))
+		return
+	}
+	closer, err := ssh.StartTunnel(client, tunnel)
+	if err != nil {
+		client.Close()
+		t.d.showError(err)
+		return
+	}
+
+	t.mu.Lock()
+	t.running[s.key()] = runningTunnel{client: client, closer: closer}
+	t.mu.Unlock()
+	go ssh.KeepAlive(client)
+	go func() {
+		// Mark the tunnel stopped if the server goes away
+		client.Wait()
+		if t.stop(s.key()) {
+			t.d.app.QueueUpdateDraw(func() {
+				t.refresh()
+				t.d.flash("Tunnel '%s' of %s closed: the connection was lost.", s.forward.Name, s.conn)
+			})
+		}
+	}()
+
+	t.refresh()
+	t.d.flash("Forwarding %s", tunnel)
+}
+
+// stop closes a running tunnel and reports whether it was running.
+func (t *tunnelsTab) stop(key string) bool {
+	t.mu.Lock()
+	r, ok := t.running[key]
+	delete(t.running, key)
+	t.mu.Unlock()
+	if ok {
+		r.closer.Close()
+		r.client.Close()
+	}
+	return ok
+}
+
+// stopConnection stops the running tunnels of a connection.
+func (t *tunnelsTab) stopConnection(conn string) {
+	t.mu.Lock()
+	var keys []string
+	for key := range t.running {
+		if strings.HasPrefix(key, conn+"/") {
+			keys = append(keys, key)
+		}
+	}
+	t.mu.Unlock()
+	for _, key := range keys {
+		t.stop(key)
+	}
+}
+
+// stopAll stops every running tunnel.
+func (t *tunnelsTab) stopAll() {
+	t.mu.Lock()
+	var keys []string
+	for key := range t.running {
+		keys = append(keys, key)
+	}
+	t.mu.Unlock()
+	for _, key := range keys {
+		t.stop(key)
+	}
+}
+
+// remove deletes the saved tunnel s after asking, stopping it if it runs.
+func (t *tunnelsTab) remove(s savedTunnel) {
+	t.d.confirm(fmt.Sprintf("Remove tunnel '%s' from connection '%s'?", s.forward.Name, s.conn), func() {
+		t.stop(s.key())
+		t.d.update(fmt.Sprintf("Removed tunnel '%s' from connection '%s'.", s.forward.Name, s.conn), func(cfg *models.AppConfig) error {
+			conn, exists := cfg.Connections[s.conn]
+			if !exists {
+				return fmt.Errorf("connection '%s' does not exist", s.conn)
+			}
+			var kept []models.Forward
+			for _, f := range conn.Forwards {
+				if f.Name != s.forward.Name {
+					kept = append(kept, f)
+				}
+			}
+			if len(kept) == len(conn.Forwards) {
+				return fmt.Errorf("connection '%s' has no saved tunnel named '%s'", s.conn, s.forward.Name)
+			}
+			conn.Forwards = kept
+			cfg.Connections[s.conn] = conn
+			return nil
+		})
+	})
+}
+
+// showForm shows the form that saves a new tunnel on a connection.
+func (t *tunnelsTab) showForm() {
+	names := make([]string, 0, len(t.d.cfg.Connections))
+	for name := range t.d.cfg.Connections {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		t.d.showMessage("Add a connection first.")
+		return
+	}
+	sort.Strings(names)
+	current := 0
+	if s, ok := t.selected(); ok {
+		current = sort.SearchStrings(names, s.conn)
+	}
+
+	form := tview.NewForm().SetItemPadding(0).
+		AddDropDown("Connection", names, current, nil).
+		AddInputField("Name", "", 30, nil, nil).
+		AddDropDown("Type", forwardTypes, 0, nil).
+		AddInputField("Spec", "", 40, nil, nil)
+	form.AddButton("Save", func() {
+		_, connName := form.GetFormItemByLabel("Connection").(*tview.DropDown).GetCurrentOption()
+		_, forwardType := form.GetFormItemByLabel("Type").(*tview.DropDown).GetCurrentOption()
+		f := models.Forward{
+			Name: strings.TrimSpace(form.GetFormItemByLabel("Name").(*tview.InputField).GetText()),
+			Type: forwardType,
+			Spec: strings.TrimSpace(form.GetFormItemByLabel("Spec").(*tview.InputField).GetText()),
+		}
+		if f.Name == "" {
+			t.d.showError(errors.New("name cannot be empty"))
+			return
+		}
+		if _, err := ssh.ParseForward(f); err != nil {
+			t.d.showError(err)
+			return
+		}
+
+		saved := t.d.update(fmt.Sprintf("Saved tunnel '%s' on connection '%s'.", f.Name, connName), func(cfg *models.AppConfig) error {
+			conn, exists := cfg.Connections[connName]
+			if !exists {
+				return fmt.Errorf("connection '%s' does not exist", connName)
+			}
+			for _, existing := range conn.Forwards {
+				if existing.Name == f.Name {
+					return fmt.Errorf("connection '%s' already has a tunnel named '%s'", connName, f.Name)
+				}
+			}
+			conn.Forwards = append(conn.Forwards, f)
+			cfg.Connections[connName] = conn
+			return nil
+		})
+		if saved {
+			t.d.closeOverlay()
+		}
+	})
+	form.AddButton("Cancel", t.d.closeOverlay)
+	t.d.showForm("New tunnel (spec as for ssh -L, -R or -D)", form, 10)
+}
+
+// warningWriter passes each write to a function, as one message.
+type warningWriter func(msg string)
+
+func (w warningWriter) Write(p []byte) (int, error) {
+	w(strings.TrimSpace(string(p)))
+	return len(p), nil
+}
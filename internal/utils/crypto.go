@@ -4,58 +4,323 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"os"
+	"strings"
+	"sync"
 
 	"github.com/99designs/keyring"
+	"golang.org/x/crypto/ssh/terminal"
+	"sm/internal/models"
 )
 
 const (
 	keyringService = "ssh-manager"
-	keyringUser    = "encryption-key"
+	keyringUser    = "encryption-key" // Retired keys are kept as encryption-key-<id>
+	keyIDLength    = 8                // Hex characters
+	// encryptedPrefix marks an encrypted password and its format version.
+	encryptedPrefix = "enc:v1:"
+	// minCiphertextLength is the size of an AES-GCM nonce and tag.
+	minCiphertextLength = 12 + 16
 )
 
-// getEncryptionKey retrieves or generates a 32-byte AES key from the system keyring.
-func getEncryptionKey() ([]byte, error) {
+// ErrLocked is returned when passwords are encrypted with a master password
+// that has not been unlocked and cannot be asked for.
+var ErrLocked = errors.New("passwords are encrypted with a master password: run 'sm unlock' first")
+
+// ErrUndecryptable is returned when a password cannot be decrypted, because
+// it is not a ciphertext or was encrypted with a key that is not available.
+var ErrUndecryptable = errors.New("cannot decrypt password")
+
+var (
+	keyMu      sync.Mutex
+	encryption models.EncryptionSettings
+	masterKey  []byte // Master key unlocked by this process
+)
+
+// SetEncryptionSettings selects the key source used by Encrypt and Decrypt.
+// It is called whenever the configuration is loaded.
+func SetEncryptionSettings(settings models.EncryptionSettings) {
+	keyMu.Lock()
+	defer keyMu.Unlock()
+	if settings != encryption {
+		masterKey = nil
+	}
+	encryption = settings
+}
+
+// EncryptionKey returns the 32-byte AES key of the configured key source. In
+// master password mode the key is taken from the unlock agent, or the master
+// password is asked for once per process when running in a terminal.
+func EncryptionKey() ([]byte, error) {
+	keyMu.Lock()
+	defer keyMu.Unlock()
+
+	if encryption.KeySource != models.KeySourceMasterPassword {
+		return KeyringKey()
+	}
+	if masterKey != nil {
+		return masterKey, nil
+	}
+
+	key, err := AgentKey(encryption.Salt)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+			return nil, ErrLocked
+		}
+		password, err := ReadPassword("Master password: ")
+		if err != nil {
+			return nil, err
+		}
+		key, err = DeriveMasterKey(encryption, password)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	masterKey = key
+	return key, nil
+}
+
+// KeyringKey retrieves or generates a 32-byte AES key from the system keyring.
+func KeyringKey() ([]byte, error) {
+	key, err := LookupKeyringKey()
+	if err != nil || key != nil {
+		return key, err
+	}
+
+	// Key not found, generate a new one
+	key, err = NewKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := SetKeyringKey(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// LookupKeyringKey returns the current keyring key, or nil if there is none
+// yet. Unlike KeyringKey, it never creates one.
+func LookupKeyringKey() ([]byte, error) {
+	kr, err := openKeyring()
+	if err != nil {
+		return nil, err
+	}
+	item, err := kr.Get(keyringUser)
+	if err == keyring.ErrKeyNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get encryption key from keyring: %w", err)
+	}
+	return item.Data, nil
+}
+
+// NewKey generates a random 32-byte AES key.
+func NewKey() ([]byte, error) {
+	key := make([]byte, keyLength)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, fmt.Errorf("failed to generate encryption key: %w", err)
+	}
+	return key, nil
+}
+
+// KeyringKeyByID returns a key kept in the keyring under its ID by
+// SaveKeyringKey, or nil if there is none.
+func KeyringKeyByID(id string) ([]byte, error) {
+	kr, err := openKeyring()
+	if err != nil {
+		return nil, err
+	}
+	item, err := kr.Get(keyringUser + "-" + id)
+	if err == keyring.ErrKeyNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get encryption key %s from keyring: %w", id, err)
+	}
+	return item.Data, nil
+}
+
+// SaveKeyringKey keeps key in the keyring under its ID, so passwords
+// encrypted with it can still be decrypted once it is no longer current.
+func SaveKeyringKey(key []byte) error {
+	kr, err := openKeyring()
+	if err != nil {
+		return err
+	}
+	if err := kr.Set(keyring.Item{Key: keyringUser + "-" + KeyID(key), Data: key}); err != nil {
+		return fmt.Errorf("failed to save encryption key to keyring: %w", err)
+	}
+	return nil
+}
+
+// SetKeyringKey makes key the current keyring key.
+func SetKeyringKey(key []byte) error {
+	kr, err := openKeyring()
+	if err != nil {
+		return err
+	}
+	if err := kr.Set(keyring.Item{Key: keyringUser, Data: key}); err != nil {
+		return fmt.Errorf("failed to save encryption key to keyring: %w", err)
+	}
+	return nil
+}
+
+// DeleteKeyringKey removes the key saved under id by SaveKeyringKey.
+func DeleteKeyringKey(id string) error {
+	kr, err := openKeyring()
+	if err != nil {
+		return err
+	}
+	if err := kr.Remove(keyringUser + "-" + id); err != nil && err != keyring.ErrKeyNotFound {
+		return fmt.Errorf("failed to remove encryption key %s from keyring: %w", id, err)
+	}
+	return nil
+}
+
+// openKeyring opens the system keyring. It is a variable so tests can use
+// an in-memory keyring.
+var openKeyring = func() (keyring.Keyring, error) {
 	kr, err := keyring.Open(keyring.Config{
 		ServiceName: keyringService,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to open keyring: %w", err)
 	}
+	return kr, nil
+}
 
-	key, err := kr.Get(keyringUser)
-	if err == keyring.ErrKeyNotFound {
-		// Key not found, generate a new one
-		keyBytes := make([]byte, 32) // AES-256 key
-		if _, err := io.ReadFull(rand.Reader, keyBytes); err != nil {
-			return nil, fmt.Errorf("failed to generate encryption key: %w", err)
+// KeyID returns a short identifier of key. It is stored in front of every
+// ciphertext to record which key encrypted it, and is derived with a hash so
+// it reveals nothing about the key itself.
+func KeyID(key []byte) string {
+	sum := sha256.Sum256(append([]byte("sm key id:"), key...))
+	return hex.EncodeToString(sum[:])[:keyIDLength]
+}
+
+// CiphertextKeyID returns the ID of the key ciphertext was encrypted with,
+// or "" if it has none, like ciphertexts written by older versions of sm.
+func CiphertextKeyID(ciphertext string) string {
+	id, _ := splitCiphertext(ciphertext)
+	return id
+}
+
+// splitCiphertext separates the marker and key ID from the encoded ciphertext.
+func splitCiphertext(ciphertext string) (id, data string) {
+	ciphertext = strings.TrimPrefix(ciphertext, encryptedPrefix)
+	if len(ciphertext) > keyIDLength && ciphertext[keyIDLength] == ':' {
+		if _, err := hex.DecodeString(ciphertext[:keyIDLength]); err == nil {
+			return ciphertext[:keyIDLength], ciphertext[keyIDLength+1:]
 		}
+	}
+	return "", ciphertext
+}
+
+// IsEncrypted reports whether value is marked as an encrypted password.
+// Only marked values are decrypted. Ciphertexts written by older versions of
+// sm are marked by the config migration or by 'sm secrets encrypt-all'.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, "enc:")
+}
+
+// MaybeUnmarkedCiphertext reports whether value has the form of a password
+// that an older version of sm encrypted without the enc: marker. Plaintext
+// passwords can have that form too, so only conversions use it, to pick the
+// values worth trying to decrypt with DecryptUnmarked.
+func MaybeUnmarkedCiphertext(value string) bool {
+	if IsEncrypted(value) {
+		return false
+	}
+	_, data := splitCiphertext(value)
+	decoded, err := base64.StdEncoding.DecodeString(data)
+	return err == nil && len(decoded) >= minCiphertextLength
+}
 
-		err = kr.Set(keyring.Item{
-			Key:  keyringUser,
-			Data: keyBytes,
-		})
+// DecryptUnmarked decrypts a password that an older version of sm encrypted
+// without the enc: marker. It fails with ErrUndecryptable if value does not
+// decrypt with an available key, in which case it is a plaintext password.
+func DecryptUnmarked(value string) (string, error) {
+	if !MaybeUnmarkedCiphertext(value) {
+		return "", fmt.Errorf("%w: not a ciphertext", ErrUndecryptable)
+	}
+	return Decrypt(value)
+}
+
+// DecryptUnmarkedWithKeyring is DecryptUnmarked with the keys in the
+// keyring, for the config migration, which must not create a key. Without
+// one nothing was ever encrypted, so it fails with ErrUndecryptable and the
+// value is left as it is.
+func DecryptUnmarkedWithKeyring(value string) (string, error) {
+	if !MaybeUnmarkedCiphertext(value) {
+		return "", fmt.Errorf("%w: not a ciphertext", ErrUndecryptable)
+	}
+	key, err := LookupKeyringKey()
+	if err != nil {
+		return "", err
+	}
+	if id := CiphertextKeyID(value); id != "" && (key == nil || id != KeyID(key)) {
+		retired, err := KeyringKeyByID(id)
 		if err != nil {
-			return nil, fmt.Errorf("failed to save encryption key to keyring: %w", err)
+			return "", err
+		}
+		if retired != nil {
+			key = retired
 		}
-		return keyBytes, nil
-	} else if err != nil {
-		return nil, fmt.Errorf("failed to get encryption key from keyring: %w", err)
 	}
+	if key == nil {
+		return "", fmt.Errorf("%w: there is no encryption key in the keyring", ErrUndecryptable)
+	}
+	return DecryptWithKey(key, value)
+}
 
-	return key.Data, nil
+// MarkEncrypted adds the enc:v1: marker to a ciphertext that DecryptUnmarked
+// decrypted.
+func MarkEncrypted(ciphertext string) string {
+	return encryptedPrefix + ciphertext
+}
+
+// SealPassword prepares a password for the configuration file: encrypted if
+// encrypt is set (settings.encrypt_passwords), and as it is otherwise. Secret
+// references are always saved as they are, once checked.
+func SealPassword(password string, encrypt bool) (string, error) {
+	if password == "" {
+		return password, nil
+	}
+	if IsSecretRef(password) {
+		if err := ValidateSecretRef(password); err != nil {
+			return "", err
+		}
+		return password, nil
+	}
+	if encrypt {
+		return Encrypt(password)
+	}
+	if IsEncrypted(password) {
+		return "", errors.New("a plaintext password cannot start with 'enc:'. Enable settings.encrypt_passwords to save it")
+	}
+	return password, nil
 }
 
 // Encrypt encrypts plaintext using AES-256-GCM.
 func Encrypt(plaintext string) (string, error) {
-	key, err := getEncryptionKey()
+	key, err := EncryptionKey()
 	if err != nil {
 		return "", err
 	}
+	return EncryptWithKey(key, plaintext)
+}
 
+// EncryptWithKey encrypts plaintext using AES-256-GCM with the given key. The
+// result is marked as encrypted and records the key's ID: enc:v1:<id>:<base64>.
+func EncryptWithKey(key []byte, plaintext string) (string, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return "", fmt.Errorf("failed to create cipher: %w", err)
@@ -72,19 +337,51 @@ func Encrypt(plaintext string) (string, error) {
 	}
 
 	ciphertext := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
-	return base64.StdEncoding.EncodeToString(ciphertext), nil
+	return encryptedPrefix + KeyID(key) + ":" + base64.StdEncoding.EncodeToString(ciphertext), nil
 }
 
-// Decrypt decrypts ciphertext using AES-256-GCM.
+// Decrypt decrypts ciphertext using AES-256-GCM. Ciphertexts of a retired
+// keyring key are decrypted with that key, if it is still in the keyring.
 func Decrypt(ciphertext string) (string, error) {
-	key, err := getEncryptionKey()
+	key, err := EncryptionKey()
 	if err != nil {
 		return "", err
 	}
 
-	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	id := CiphertextKeyID(ciphertext)
+	if id != "" && id != KeyID(key) && keySource() != models.KeySourceMasterPassword {
+		retired, err := KeyringKeyByID(id)
+		if err != nil {
+			return "", err
+		}
+		if retired != nil {
+			key = retired
+		}
+	}
+	return DecryptWithKey(key, ciphertext)
+}
+
+// keySource returns the configured key source.
+func keySource() string {
+	keyMu.Lock()
+	defer keyMu.Unlock()
+	return encryption.KeySource
+}
+
+// DecryptWithKey decrypts ciphertext using AES-256-GCM with the given key.
+// It fails with ErrUndecryptable if ciphertext was encrypted with another key.
+func DecryptWithKey(key []byte, ciphertext string) (string, error) {
+	if IsEncrypted(ciphertext) && !strings.HasPrefix(ciphertext, encryptedPrefix) {
+		return "", fmt.Errorf("%w: unsupported encryption format, written by a newer version of sm", ErrUndecryptable)
+	}
+	id, encoded := splitCiphertext(ciphertext)
+	if id != "" && id != KeyID(key) {
+		return "", fmt.Errorf("%w: encrypted with key %s, which is not available", ErrUndecryptable, id)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(encoded)
 	if err != nil {
-		return "", fmt.Errorf("failed to decode base64 ciphertext: %w", err)
+		return "", fmt.Errorf("%w: not a base64 ciphertext: %v", ErrUndecryptable, err)
 	}
 
 	block, err := aes.NewCipher(key)
@@ -99,14 +396,14 @@ func Decrypt(ciphertext string) (string, error) {
 
 	nonceSize := gcm.NonceSize()
 	if len(data) < nonceSize {
-		return "", errors.New("ciphertext too short")
+		return "", fmt.Errorf("%w: ciphertext too short", ErrUndecryptable)
 	}
 
 	nonce, ciphertextBytes := data[:nonceSize], data[nonceSize:]
 	plaintextBytes, err := gcm.Open(nil, nonce, ciphertextBytes, nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to decrypt: %w", err)
+		return "", fmt.Errorf("%w: %v", ErrUndecryptable, err)
 	}
 
 	return string(plaintextBytes), nil
-}
\ No newline at end of file
+}
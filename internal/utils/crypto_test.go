@@ -0,0 +1,195 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/99designs/keyring"
+)
+
+// useTestKeyring replaces the system keyring with an empty in-memory one.
+func useTestKeyring(t *testing.T) *keyring.ArrayKeyring {
+	t.Helper()
+	kr := keyring.NewArrayKeyring(nil)
+	original := openKeyring
+	openKeyring = func() (keyring.Keyring, error) { return kr, nil }
+	t.Cleanup(func() { openKeyring = original })
+	return kr
+}
+
+func TestEncryptWithKeyRoundTrip(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	other := bytes.Repeat([]byte{2}, 32)
+
+	ciphertext, err := EncryptWithKey(key, "hunter2")
+	if err != nil {
+		t.Fatalf("EncryptWithKey failed: %v", err)
+	}
+	if !strings.HasPrefix(ciphertext, encryptedPrefix+KeyID(key)+":") {
+		t.Fatalf("EncryptWithKey() = %q, want the enc:v1: marker and key ID", ciphertext)
+	}
+	if !IsEncrypted(ciphertext) || MaybeUnmarkedCiphertext(ciphertext) {
+		t.Errorf("a marked ciphertext must count as encrypted and not as unmarked")
+	}
+	if got := CiphertextKeyID(ciphertext); got != KeyID(key) {
+		t.Errorf("CiphertextKeyID() = %q, want %q", got, KeyID(key))
+	}
+
+	plaintext, err := DecryptWithKey(key, ciphertext)
+	if err != nil || plaintext != "hunter2" {
+		t.Errorf("DecryptWithKey() = %q, %v, want hunter2", plaintext, err)
+	}
+	if _, err := DecryptWithKey(other, ciphertext); !errors.Is(err, ErrUndecryptable) {
+		t.Errorf("DecryptWithKey with another key: error = %v, want ErrUndecryptable", err)
+	}
+
+	// Older versions of sm wrote the same ciphertext without the marker,
+	// first without and later with the key ID
+	withID := strings.TrimPrefix(ciphertext, encryptedPrefix)
+	withoutID := strings.TrimPrefix(withID, KeyID(key)+":")
+	for _, legacy := range []string{withID, withoutID} {
+		if !MaybeUnmarkedCiphertext(legacy) {
+			t.Errorf("MaybeUnmarkedCiphertext(%q) = false, want true", legacy)
+		}
+		if plaintext, err := DecryptWithKey(key, legacy); err != nil || plaintext != "hunter2" {
+			t.Errorf("DecryptWithKey(%q) = %q, %v, want hunter2", legacy, plaintext, err)
+		}
+	}
+}
+
+func TestMaybeUnmarkedCiphertext(t *testing.T) {
+	long := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, minCiphertextLength))
+	short := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, minCiphertextLength-1))
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{"", false},
+		{"hunter2", false},
+		{"deadbeef:hunter2", false},
+		{"pass:word123", false},
+		{short, false},
+		{long, true},
+		{"deadbeef:" + long, true},
+		{"enc:v1:" + long, false},
+		{"enc:v1:deadbeef:" + long, false},
+		// A plaintext password can look like a ciphertext, which is why only
+		// conversions that can check it by decrypting use this
+		{"Abcdefghijklmnopqrstuvwxyz0123456789ABCD", true},
+	}
+	for _, tt := range tests {
+		if got := MaybeUnmarkedCiphertext(tt.value); got != tt.want {
+			t.Errorf("MaybeUnmarkedCiphertext(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestDecryptUnmarkedPlaintext(t *testing.T) {
+	for _, value := range []string{"", "hunter2", "deadbeef:hunter2", "enc:v1:deadbeef:abc"} {
+		if _, err := DecryptUnmarked(value); !errors.Is(err, ErrUndecryptable) {
+			t.Errorf("DecryptUnmarked(%q) error = %v, want ErrUndecryptable", value, err)
+		}
+	}
+}
+
+func TestDecryptUnmarkedWithKeyring(t *testing.T) {
+	current := bytes.Repeat([]byte{1}, 32)
+	retired := bytes.Repeat([]byte{2}, 32)
+	legacy := func(key []byte, withID bool) string {
+		ciphertext, err := EncryptWithKey(key, "hunter2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ciphertext = strings.TrimPrefix(ciphertext, encryptedPrefix)
+		if !withID {
+			ciphertext = strings.TrimPrefix(ciphertext, KeyID(key)+":")
+		}
+		return ciphertext
+	}
+
+	tests := []struct {
+		name  string
+		keys  []keyring.Item
+		value string
+		err   error
+	}{
+		{"current key", []keyring.Item{{Key: keyringUser, Data: current}}, legacy(current, false), nil},
+		{"retired key", []keyring.Item{{Key: keyringUser, Data: current}, {Key: keyringUser + "-" + KeyID(retired), Data: retired}}, legacy(retired, true), nil},
+		{"retired key without a current one", []keyring.Item{{Key: keyringUser + "-" + KeyID(retired), Data: retired}}, legacy(retired, true), nil},
+		{"other key", []keyring.Item{{Key: keyringUser, Data: current}}, legacy(retired, false), ErrUndecryptable},
+		{"no key", nil, legacy(current, false), ErrUndecryptable},
+		{"plaintext", []keyring.Item{{Key: keyringUser, Data: current}}, "hunter2", ErrUndecryptable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kr := useTestKeyring(t)
+			for _, item := range tt.keys {
+				kr.Set(item)
+			}
+
+			plaintext, err := DecryptUnmarkedWithKeyring(tt.value)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Errorf("DecryptUnmarkedWithKeyring error = %v, want %v", err, tt.err)
+				}
+			} else if err != nil || plaintext != "hunter2" {
+				t.Errorf("DecryptUnmarkedWithKeyring() = %q, %v, want hunter2", plaintext, err)
+			}
+
+			// Looking for a key never creates one
+			if keys, _ := kr.Keys(); len(keys) != len(tt.keys) {
+				t.Errorf("the keyring holds %q, want only the %d keys it started with", keys, len(tt.keys))
+			}
+		})
+	}
+}
+
+func TestKeyringKeyCreatesOnce(t *testing.T) {
+	useTestKeyring(t)
+	if key, err := LookupKeyringKey(); err != nil || key != nil {
+		t.Fatalf("LookupKeyringKey() = %x, %v, want no key", key, err)
+	}
+	created, err := KeyringKey()
+	if err != nil || len(created) != keyLength {
+		t.Fatalf("KeyringKey() = %x, %v, want a new key", created, err)
+	}
+	again, err := KeyringKey()
+	if err != nil || !bytes.Equal(again, created) {
+		t.Errorf("KeyringKey() = %x, %v, want the key it created", again, err)
+	}
+	if found, err := LookupKeyringKey(); err != nil || !bytes.Equal(found, created) {
+		t.Errorf("LookupKeyringKey() = %x, %v, want the created key", found, err)
+	}
+}
+
+func TestSealPasswordWithoutEncryption(t *testing.T) {
+	tests := []struct {
+		password string
+		want     string
+		err      string
+	}{
+		{"", "", ""},
+		{"hunter2", "hunter2", ""},
+		{"pass:word123", "pass:word123", ""},
+		{"env:HOME", "env:HOME", ""},
+		{"ref:env:SM_PASSWORD", "ref:env:SM_PASSWORD", ""},
+		{"ref:nope:x", "", "invalid secret reference"},
+		{"ref:env:", "", "empty env: reference"},
+		{"enc:v1:deadbeef:abc", "", "cannot start with 'enc:'"},
+	}
+	for _, tt := range tests {
+		got, err := SealPassword(tt.password, false)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("SealPassword(%q) error = %v, want it to contain %q", tt.password, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("SealPassword(%q) = %q, %v, want %q", tt.password, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/ssh/terminal"
+	"sm/internal/models"
+)
+
+// Argon2id parameters for new master keys, following the RFC 9106 second
+// recommended option. They are stored with the salt, so they can be raised
+// later without breaking existing configurations.
+const (
+	argonTime    = 3
+	argonMemory  = 64 * 1024 // KiB
+	argonThreads = 4
+	saltLength   = 16
+	keyLength    = 32 // AES-256
+)
+
+// masterCheckMessage is authenticated with the derived key to detect a wrong
+// master password without storing anything that helps to guess it.
+const masterCheckMessage = "sm master password check"
+
+// ErrWrongPassword is returned when a master password does not match the configuration.
+var ErrWrongPassword = errors.New("wrong master password")
+
+// NewMasterKey derives a key from a new master password with a fresh salt
+// and returns the settings needed to derive it again.
+func NewMasterKey(password string) (models.EncryptionSettings, []byte, error) {
+	salt := make([]byte, saltLength)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return models.EncryptionSettings{}, nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	settings := models.EncryptionSettings{
+		KeySource:    models.KeySourceMasterPassword,
+		Salt:         base64.StdEncoding.EncodeToString(salt),
+		ArgonTime:    argonTime,
+		ArgonMemory:  argonMemory,
+		ArgonThreads: argonThreads,
+	}
+	key := argon2.IDKey([]byte(password), salt, settings.ArgonTime, settings.ArgonMemory, settings.ArgonThreads, keyLength)
+	settings.Check = base64.StdEncoding.EncodeToString(masterCheck(key))
+	return settings, key, nil
+}
+
+// DeriveMasterKey derives the key for settings from password, returning
+// ErrWrongPassword if it does not match.
+func DeriveMasterKey(settings models.EncryptionSettings, password string) ([]byte, error) {
+	salt, err := base64.StdEncoding.DecodeString(settings.Salt)
+	if err != nil || len(salt) == 0 {
+		return nil, errors.New("invalid master password salt in config")
+	}
+	check, err := base64.StdEncoding.DecodeString(settings.Check)
+	if err != nil {
+		return nil, errors.New("invalid master password check in config")
+	}
+
+	key := argon2.IDKey([]byte(password), salt, settings.ArgonTime, settings.ArgonMemory, settings.ArgonThreads, keyLength)
+	if !hmac.Equal(masterCheck(key), check) {
+		return nil, ErrWrongPassword
+	}
+	return key, nil
+}
+
+func masterCheck(key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(masterCheckMessage))
+	return mac.Sum(nil)
+}
+
+// ReadPassword asks for a password on the terminal without echoing it.
+func ReadPassword(prompt string) (string, error) {
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return "", errors.New("cannot ask for a password: stdin is not a terminal")
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	password, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	return string(password), nil
+}
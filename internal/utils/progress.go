@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	progressBarWidth    = 30
+	progressRedrawEvery = 100 * time.Millisecond
+)
+
+// Progress renders a single-line progress bar for a file transfer on stderr.
+// A disabled Progress accepts updates but never draws anything.
+type Progress struct {
+	name     string
+	total    int64
+	done     int64
+	resumed  int64
+	start    time.Time
+	lastDraw time.Time
+	out      io.Writer
+	enabled  bool
+}
+
+// NewProgress creates a progress bar for a transfer of total bytes, of which
+// done bytes were already transferred earlier (e.g. when resuming).
+func NewProgress(name string, total, done int64, enabled bool) *Progress {
+	return &Progress{
+		name:    name,
+		total:   total,
+		done:    done,
+		resumed: done,
+		start:   time.Now(),
+		out:     os.Stderr,
+		enabled: enabled,
+	}
+}
+
+// Add records n more transferred bytes and redraws the bar if enough time has passed.
+func (p *Progress) Add(n int) {
+	p.done += int64(n)
+	if p.enabled && time.Since(p.lastDraw) >= progressRedrawEvery {
+		p.draw()
+	}
+}
+
+// Finish draws the final state of the bar and ends its line.
+func (p *Progress) Finish() {
+	if !p.enabled {
+		return
+	}
+	p.draw()
+	fmt.Fprintln(p.out)
+}
+
+func (p *Progress) draw() {
+	p.lastDraw = time.Now()
+
+	ratio := 1.0
+	if p.total > 0 {
+		ratio = float64(p.done) / float64(p.total)
+	}
+	if ratio > 1 {
+		ratio = 1
+	}
+	filled := int(ratio * progressBarWidth)
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled)
+
+	rate := 0.0
+	if elapsed := time.Since(p.start).Seconds(); elapsed > 0 {
+		rate = float64(p.done-p.resumed) / elapsed
+	}
+
+	fmt.Fprintf(p.out, "\r%-24s [%s] %3.0f%%  %s / %s  %s/s ",
+		truncateName(p.name, 24), bar, ratio*100,
+		FormatBytes(p.done), FormatBytes(p.total), FormatBytes(int64(rate)))
+}
+
+// truncateName shortens s to at most n characters, keeping its end.
+func truncateName(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return "..." + s[len(s)-n+3:]
+}
+
+// FormatBytes formats a byte count using binary units, e.g. "12.3 MiB".
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,304 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/99designs/keyring"
+)
+
+// A saved password can be a reference to a secret kept outside the
+// configuration file, written as ref:<scheme>:<reference>, for example
+// ref:env:DB_PASSWORD. The ref: marker tells it apart from a password, as enc:
+// does for encrypted ones; it may be left out where only a reference is
+// accepted, such as the passphrase of a key. The reference is resolved by the
+// SecretProvider registered for its scheme when the password is needed.
+
+// SecretProvider resolves references of one scheme to the secrets they point to.
+type SecretProvider interface {
+	// Resolve returns the secret ref points to. ref does not include the scheme.
+	Resolve(ref string) (string, error)
+}
+
+// SecretProviderFunc adapts an ordinary function to a SecretProvider.
+type SecretProviderFunc func(ref string) (string, error)
+
+// Resolve calls f(ref).
+func (f SecretProviderFunc) Resolve(ref string) (string, error) {
+	return f(ref)
+}
+
+// secretRefPrefix marks a secret reference.
+const secretRefPrefix = "ref:"
+
+// keyringSecretPrefix keeps secrets apart from sm's own keys in the keyring.
+const keyringSecretPrefix = "secret:"
+
+// secretRefEnv passes the reference to command providers.
+const secretRefEnv = "SM_SECRET_REF"
+
+var schemePattern = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+var (
+	providersMu     sync.RWMutex
+	secretProviders = map[string]SecretProvider{
+		"keyring": SecretProviderFunc(resolveKeyringSecret),
+		"env":     SecretProviderFunc(resolveEnvSecret),
+		"file":    SecretProviderFunc(resolveFileSecret),
+		"pass":    SecretProviderFunc(resolvePassSecret),
+		"cmd":     SecretProviderFunc(resolveCommandSecret),
+	}
+)
+
+// RegisterSecretProvider makes references of scheme resolve through p. Scheme
+// names are lowercase letters, digits and dashes; "enc" and "ref" are reserved
+// for the markers of encrypted passwords and references.
+func RegisterSecretProvider(scheme string, p SecretProvider) error {
+	if !schemePattern.MatchString(scheme) || scheme == "enc" || scheme == "ref" {
+		return fmt.Errorf("invalid secret provider name %q", scheme)
+	}
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	secretProviders[scheme] = p
+	return nil
+}
+
+// SecretSchemes returns the registered schemes, sorted.
+func SecretSchemes() []string {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	schemes := make([]string, 0, len(secretProviders))
+	for scheme := range secretProviders {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// ParseSecretRef splits value into the scheme and reference of a secret
+// reference, with or without the ref: marker. ok is false if value does not
+// start with a registered scheme.
+func ParseSecretRef(value string) (scheme, ref string, ok bool) {
+	value = strings.TrimPrefix(value, secretRefPrefix)
+	i := strings.IndexByte(value, ':')
+	if i <= 0 {
+		return "", "", false
+	}
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	if _, ok := secretProviders[value[:i]]; !ok {
+		return "", "", false
+	}
+	return value[:i], value[i+1:], true
+}
+
+// IsSecretRef reports whether a saved password is marked as a reference to a
+// secret. Only marked values are resolved; any other value is a password.
+func IsSecretRef(value string) bool {
+	return strings.HasPrefix(value, secretRefPrefix)
+}
+
+// ValidateSecretRef checks that value is a secret reference of a registered
+// scheme. The ref: marker may be left out.
+func ValidateSecretRef(value string) error {
+	scheme, ref, ok := ParseSecretRef(value)
+	if !ok {
+		return fmt.Errorf("invalid secret reference %q: write it as ref:<scheme>:<reference>, such as ref:env:NAME. Known schemes: %s", value, strings.Join(SecretSchemes(), ", "))
+	}
+	if ref == "" {
+		return fmt.Errorf("empty %s: reference", scheme)
+	}
+	return nil
+}
+
+// ResolveSecret returns the secret that the reference value points to. The
+// ref: marker may be left out.
+func ResolveSecret(value string) (string, error) {
+	if err := ValidateSecretRef(value); err != nil {
+		return "", err
+	}
+	scheme, ref, _ := ParseSecretRef(value)
+
+	providersMu.RLock()
+	p := secretProviders[scheme]
+	providersMu.RUnlock()
+
+	secret, err := p.Resolve(ref)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s:%s: %w", scheme, ref, err)
+	}
+	return secret, nil
+}
+
+// ResolvePassword returns the plaintext of a saved password: the secret a
+// reference points to, the decrypted value of a password marked as encrypted,
+// or the value itself.
+func ResolvePassword(value string) (string, error) {
+	if IsSecretRef(value) {
+		return ResolveSecret(value)
+	}
+	if IsEncrypted(value) {
+		return Decrypt(value)
+	}
+	return value, nil
+}
+
+// CommandSecretProvider returns a provider that runs command through the
+// shell with the reference in $SM_SECRET_REF and returns its output.
+func CommandSecretProvider(command string) SecretProvider {
+	return commandSecretProvider(command)
+}
+
+// commandSecretProvider is a provider from settings.secret_providers.
+type commandSecretProvider string
+
+func (command commandSecretProvider) Resolve(ref string) (string, error) {
+	return runSecretCommand(string(command), ref)
+}
+
+// RunsCommand reports whether resolving the secret reference value runs a
+// shell command: a cmd: reference, or one of a provider that runs a command,
+// such as those in settings.secret_providers. References of unknown schemes
+// count too, as a provider of that name may be added later.
+func RunsCommand(value string) bool {
+	scheme, _, _ := strings.Cut(strings.TrimPrefix(value, secretRefPrefix), ":")
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	p, known := secretProviders[scheme]
+	_, command := p.(commandSecretProvider)
+	return !known || command || scheme == "cmd"
+}
+
+// SetKeyringSecret saves secret in the OS keyring, for ref:keyring:<name>.
+func SetKeyringSecret(name, secret string) error {
+	kr, err := openKeyring()
+	if err != nil {
+		return err
+	}
+	if err := kr.Set(keyring.Item{Key: keyringSecretPrefix + name, Data: []byte(secret)}); err != nil {
+		return fmt.Errorf("failed to save secret to keyring: %w", err)
+	}
+	return nil
+}
+
+// DeleteKeyringSecret removes a secret saved by SetKeyringSecret.
+func DeleteKeyringSecret(name string) error {
+	kr, err := openKeyring()
+	if err != nil {
+		return err
+	}
+	if err := kr.Remove(keyringSecretPrefix + name); err != nil {
+		if err == keyring.ErrKeyNotFound {
+			return fmt.Errorf("no secret named %s in the keyring", name)
+		}
+		return fmt.Errorf("failed to remove secret from keyring: %w", err)
+	}
+	return nil
+}
+
+func resolveKeyringSecret(name string) (string, error) {
+	kr, err := openKeyring()
+	if err != nil {
+		return "", err
+	}
+	item, err := kr.Get(keyringSecretPrefix + name)
+	if err == keyring.ErrKeyNotFound {
+		return "", fmt.Errorf("no secret named %s in the keyring (save it with 'sm secrets set %s')", name, name)
+	} else if err != nil {
+		return "", fmt.Errorf("failed to get secret from keyring: %w", err)
+	}
+	return string(item.Data), nil
+}
+
+func resolveEnvSecret(name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
+
+func resolveFileSecret(path string) (string, error) {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(home, path[1:])
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return trimNewlines(string(data)), nil
+}
+
+// resolvePassSecret reads the first line of a password-store entry, where
+// pass keeps the password.
+func resolvePassSecret(entry string) (string, error) {
+	cmd := exec.Command("pass", "show", entry)
+	out, err := runSecretHelper(cmd)
+	if err != nil {
+		return "", err
+	}
+	line, _, _ := strings.Cut(out, "\n")
+	return trimNewlines(line), nil
+}
+
+func resolveCommandSecret(command string) (string, error) {
+	return runSecretCommand(command, "")
+}
+
+// runSecretCommand runs command through the shell and returns its output.
+func runSecretCommand(command, ref string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Env = append(os.Environ(), secretRefEnv+"="+ref)
+
+	out, err := runSecretHelper(cmd)
+	if err != nil {
+		return "", err
+	}
+	return trimNewlines(out), nil
+}
+
+// runSecretHelper runs a helper that prints a secret. It may prompt on the
+// terminal, for example for a GPG passphrase, so stdin and stderr are shared.
+func runSecretHelper(cmd *exec.Cmd) (string, error) {
+	var stdout bytes.Buffer
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return "", fmt.Errorf("%s exited with status %d", filepath.Base(cmd.Path), exitErr.ExitCode())
+		}
+		return "", err
+	}
+	if stdout.Len() == 0 {
+		return "", fmt.Errorf("%s printed nothing", filepath.Base(cmd.Path))
+	}
+	return stdout.String(), nil
+}
+
+// trimNewlines removes the line ending that files and commands usually add.
+// Other whitespace may be part of the secret and is kept.
+func trimNewlines(s string) string {
+	return strings.TrimRight(s, "\r\n")
+}
@@ -0,0 +1,169 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+// registerTestProvider adds a provider from settings for the test.
+func registerTestProvider(t *testing.T, scheme, command string) {
+	t.Helper()
+	if err := RegisterSecretProvider(scheme, CommandSecretProvider(command)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		providersMu.Lock()
+		delete(secretProviders, scheme)
+		providersMu.Unlock()
+	})
+}
+
+func TestParseSecretRef(t *testing.T) {
+	registerTestProvider(t, "vault", "true")
+	tests := []struct {
+		value  string
+		scheme string
+		ref    string
+		ok     bool
+	}{
+		{"ref:env:NAME", "env", "NAME", true},
+		{"env:NAME", "env", "NAME", true},
+		{"ref:file:/run/secrets/db:ro", "file", "/run/secrets/db:ro", true},
+		{"ref:cmd:op read op://vault/db", "cmd", "op read op://vault/db", true},
+		{"ref:vault:kv/db", "vault", "kv/db", true},
+		{"ref:env:", "env", "", true},
+		{"ref:nope:x", "", "", false},
+		{"pass:word123", "pass", "word123", true},
+		{"hunter2", "", "", false},
+		{":env", "", "", false},
+		{"ref:", "", "", false},
+		{"", "", "", false},
+	}
+	for _, tt := range tests {
+		scheme, ref, ok := ParseSecretRef(tt.value)
+		if scheme != tt.scheme || ref != tt.ref || ok != tt.ok {
+			t.Errorf("ParseSecretRef(%q) = %q, %q, %v, want %q, %q, %v", tt.value, scheme, ref, ok, tt.scheme, tt.ref, tt.ok)
+		}
+	}
+}
+
+func TestIsSecretRef(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{"ref:env:NAME", true},
+		{"ref:nope:x", true},
+		// Only marked values are references, so passwords such as these are
+		// not mistaken for one
+		{"env:NAME", false},
+		{"pass:word123", false},
+		{"enc:v1:deadbeef:abc", false},
+		{"hunter2", false},
+	}
+	for _, tt := range tests {
+		if got := IsSecretRef(tt.value); got != tt.want {
+			t.Errorf("IsSecretRef(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestValidateSecretRef(t *testing.T) {
+	tests := []struct {
+		value string
+		err   string
+	}{
+		{"ref:env:NAME", ""},
+		{"keyring:db", ""},
+		{"ref:nope:x", "invalid secret reference"},
+		{"hunter2", "invalid secret reference"},
+		{"ref:keyring:", "empty keyring: reference"},
+	}
+	for _, tt := range tests {
+		err := ValidateSecretRef(tt.value)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("ValidateSecretRef(%q) = %v, want nil", tt.value, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("ValidateSecretRef(%q) = %v, want an error containing %q", tt.value, err, tt.err)
+		}
+	}
+}
+
+func TestResolveSecret(t *testing.T) {
+	t.Setenv("SM_TEST_SECRET", "s3cret")
+	registerTestProvider(t, "echo", `printf '%s\n' "got $SM_SECRET_REF"`)
+	tests := []struct {
+		value string
+		want  string
+		err   string
+	}{
+		{"ref:env:SM_TEST_SECRET", "s3cret", ""},
+		{"env:SM_TEST_SECRET", "s3cret", ""},
+		{"ref:echo:db", "got db", ""},
+		{"ref:cmd:printf 'line\\n\\n'", "line", ""},
+		{"ref:env:SM_TEST_MISSING", "", "SM_TEST_MISSING is not set"},
+		{"ref:env:", "", "empty env: reference"},
+		{"hunter2", "", "invalid secret reference"},
+	}
+	for _, tt := range tests {
+		got, err := ResolveSecret(tt.value)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ResolveSecret(%q) error = %v, want it to contain %q", tt.value, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ResolveSecret(%q) = %q, %v, want %q", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestRunsCommand(t *testing.T) {
+	registerTestProvider(t, "vault", "true")
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{"ref:env:NAME", false},
+		{"ref:keyring:db", false},
+		{"ref:file:/run/secrets/db", false},
+		{"ref:pass:db", false},
+		{"ref:cmd:echo hi", true},
+		{"cmd:echo hi", true},
+		{"ref:vault:kv/db", true},
+		{"ref:unknown:x", true},
+	}
+	for _, tt := range tests {
+		if got := RunsCommand(tt.value); got != tt.want {
+			t.Errorf("RunsCommand(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestRegisterSecretProviderReservedNames(t *testing.T) {
+	for _, scheme := range []string{"enc", "ref", "", "Vault", "1pw", "a_b"} {
+		if err := RegisterSecretProvider(scheme, CommandSecretProvider("true")); err == nil {
+			t.Errorf("RegisterSecretProvider(%q) succeeded, want an error", scheme)
+		}
+	}
+}
+
+func TestResolvePassword(t *testing.T) {
+	t.Setenv("SM_TEST_SECRET", "s3cret")
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"hunter2", "hunter2"},
+		{"env:SM_TEST_SECRET", "env:SM_TEST_SECRET"},
+		{"ref:env:SM_TEST_SECRET", "s3cret"},
+	}
+	for _, tt := range tests {
+		got, err := ResolvePassword(tt.value)
+		if err != nil || got != tt.want {
+			t.Errorf("ResolvePassword(%q) = %q, %v, want %q", tt.value, got, err, tt.want)
+		}
+	}
+}
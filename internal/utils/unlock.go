@@ -0,0 +1,276 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// The unlock agent is a small background process that keeps unlocked master
+// keys in memory for a limited time, so the master password does not have to
+// be typed for every command. It listens on a Unix socket in a directory only
+// the user can access, and exits once every key has expired or on 'sm lock'.
+
+const (
+	agentDialTimeout = time.Second
+	// agentIdleTimeout is how long a new agent waits for its first key.
+	agentIdleTimeout = 30 * time.Second
+)
+
+// Agent operations.
+const (
+	agentOpGet  = "get"
+	agentOpSet  = "set"
+	agentOpLock = "lock"
+)
+
+type agentRequest struct {
+	Op      string `json:"op"`
+	ID      string `json:"id,omitempty"` // The salt of the configuration the key belongs to
+	Key     []byte `json:"key,omitempty"`
+	Timeout int64  `json:"timeout,omitempty"` // Seconds
+}
+
+type agentResponse struct {
+	Key     []byte    `json:"key,omitempty"`
+	Expires time.Time `json:"expires,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// AgentSocketPath returns the path of the unlock agent's socket.
+func AgentSocketPath() (string, error) {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir != "" {
+		dir = filepath.Join(dir, "sm")
+	} else {
+		dir = filepath.Join(os.TempDir(), fmt.Sprintf("sm-%d", os.Getuid()))
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("could not create agent directory: %w", err)
+	}
+	// MkdirAll keeps the permissions of an existing directory
+	if err := os.Chmod(dir, 0700); err != nil {
+		return "", fmt.Errorf("could not secure agent directory: %w", err)
+	}
+	return filepath.Join(dir, "agent.sock"), nil
+}
+
+// callAgent sends one request to the running agent. It returns a nil
+// response without an error if no agent is running.
+func callAgent(req agentRequest) (*agentResponse, error) {
+	socket, err := AgentSocketPath()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialTimeout("unix", socket, agentDialTimeout)
+	if err != nil {
+		return nil, nil
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, fmt.Errorf("failed to talk to unlock agent: %w", err)
+	}
+	var resp agentResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to talk to unlock agent: %w", err)
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	return &resp, nil
+}
+
+// AgentRunning reports whether an unlock agent is listening.
+func AgentRunning() bool {
+	socket, err := AgentSocketPath()
+	if err != nil {
+		return false
+	}
+	conn, err := net.DialTimeout("unix", socket, agentDialTimeout)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// AgentKey returns the unlocked key for id, or nil if the agent is not
+// running or does not hold it.
+func AgentKey(id string) ([]byte, error) {
+	resp, err := callAgent(agentRequest{Op: agentOpGet, ID: id})
+	if err != nil || resp == nil {
+		return nil, err
+	}
+	return resp.Key, nil
+}
+
+// AgentExpiry returns when the key for id will be forgotten, or the zero time
+// if it is not unlocked.
+func AgentExpiry(id string) (time.Time, error) {
+	resp, err := callAgent(agentRequest{Op: agentOpGet, ID: id})
+	if err != nil || resp == nil || resp.Key == nil {
+		return time.Time{}, err
+	}
+	return resp.Expires, nil
+}
+
+// AgentStore hands key to the running agent, which keeps it for timeout.
+func AgentStore(id string, key []byte, timeout time.Duration) error {
+	resp, err := callAgent(agentRequest{Op: agentOpSet, ID: id, Key: key, Timeout: int64(timeout / time.Second)})
+	if err != nil {
+		return err
+	}
+	if resp == nil {
+		return errors.New("unlock agent is not running")
+	}
+	return nil
+}
+
+// AgentLock makes the agent forget every key and exit. It reports whether an
+// agent was running.
+func AgentLock() (bool, error) {
+	resp, err := callAgent(agentRequest{Op: agentOpLock})
+	return resp != nil, err
+}
+
+// agentKey is a key held by the agent.
+type agentKey struct {
+	key     []byte
+	expires time.Time
+}
+
+// agentState is the memory of a running agent.
+type agentState struct {
+	mu   sync.Mutex
+	keys map[string]agentKey
+	done chan struct{}
+	once sync.Once
+}
+
+// ServeAgent runs the unlock agent until it is locked or every key expires.
+func ServeAgent() error {
+	socket, err := AgentSocketPath()
+	if err != nil {
+		return err
+	}
+	if AgentRunning() {
+		return errors.New("unlock agent is already running")
+	}
+	os.Remove(socket) // Left behind by an agent that did not exit cleanly
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return fmt.Errorf("failed to start unlock agent: %w", err)
+	}
+	defer os.Remove(socket)
+	os.Chmod(socket, 0600)
+
+	state := &agentState{keys: make(map[string]agentKey), done: make(chan struct{})}
+	go state.expire(time.Now().Add(agentIdleTimeout))
+	go func() {
+		<-state.done
+		listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-state.done:
+				return nil
+			default:
+				return fmt.Errorf("unlock agent stopped: %w", err)
+			}
+		}
+		go state.handle(conn)
+	}
+}
+
+// handle answers a single request.
+func (s *agentState) handle(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	var req agentRequest
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		return
+	}
+
+	var resp agentResponse
+	s.mu.Lock()
+	switch req.Op {
+	case agentOpGet:
+		if k, ok := s.keys[req.ID]; ok && time.Now().Before(k.expires) {
+			// Copied, since expire may wipe the key before the response is written
+			resp.Key, resp.Expires = append([]byte(nil), k.key...), k.expires
+		}
+	case agentOpSet:
+		if req.ID == "" || len(req.Key) == 0 || req.Timeout <= 0 {
+			resp.Error = "invalid unlock request"
+			break
+		}
+		s.keys[req.ID] = agentKey{key: req.Key, expires: time.Now().Add(time.Duration(req.Timeout) * time.Second)}
+	case agentOpLock:
+		s.forgetAll()
+		s.once.Do(func() { close(s.done) })
+	default:
+		resp.Error = fmt.Sprintf("unknown operation %q", req.Op)
+	}
+	s.mu.Unlock()
+
+	json.NewEncoder(conn).Encode(resp)
+}
+
+// expire forgets keys once they time out and stops the agent when none are
+// left. An agent that never receives a key stops at idleUntil.
+func (s *agentState) expire(idleUntil time.Time) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case now := <-ticker.C:
+			s.mu.Lock()
+			for id, k := range s.keys {
+				if now.After(k.expires) {
+					zero(k.key)
+					delete(s.keys, id)
+				}
+			}
+			empty := len(s.keys) == 0
+			s.mu.Unlock()
+
+			if empty && now.After(idleUntil) {
+				s.once.Do(func() { close(s.done) })
+				return
+			}
+			if !empty {
+				// Once a key was stored, stop as soon as the last one expires
+				idleUntil = time.Time{}
+			}
+		}
+	}
+}
+
+// forgetAll wipes every key. The caller holds s.mu.
+func (s *agentState) forgetAll() {
+	for id, k := range s.keys {
+		zero(k.key)
+		delete(s.keys, id)
+	}
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}